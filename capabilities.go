@@ -0,0 +1,322 @@
+package rtapi
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a version of rTorrent or libtorrent, e.g. 0.9.8. Forks may
+// append to it, what follows the numbers is kept in Suffix.
+type Version struct {
+	Major, Minor, Patch int
+	Suffix              string
+}
+
+// ParseVersion parses versions like "0.9.8", "0.13" or "0.9.8-jesec".
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	rest := strings.TrimSpace(s)
+	for i, n := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		digits := 0
+		for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+			digits++
+		}
+		if digits == 0 {
+			return Version{}, fmt.Errorf("rtapi: invalid version %q", s)
+		}
+
+		var err error
+		if *n, err = strconv.Atoi(rest[:digits]); err != nil {
+			return Version{}, fmt.Errorf("rtapi: invalid version %q", s)
+		}
+		rest = rest[digits:]
+
+		if i == 2 || len(rest) < 2 || rest[0] != '.' || rest[1] < '0' || rest[1] > '9' {
+			break
+		}
+		rest = rest[1:]
+	}
+
+	v.Suffix = rest
+	return v, nil
+}
+
+// Compare returns -1, 0 or +1 as v is older, the same or newer than w.
+// Suffixes are ignored.
+func (v Version) Compare(w Version) int {
+	if c := cmp.Compare(v.Major, w.Major); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.Minor, w.Minor); c != 0 {
+		return c
+	}
+	return cmp.Compare(v.Patch, w.Patch)
+}
+
+// AtLeast reports whether v is major.minor.patch or newer.
+func (v Version) AtLeast(major, minor, patch int) bool {
+	return v.Compare(Version{Major: major, Minor: minor, Patch: patch}) >= 0
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d%s", v.Major, v.Minor, v.Patch, v.Suffix)
+}
+
+// ClientVersion returns the parsed version of rTorrent, zero if it
+// couldn't be parsed.
+func (r *Rtorrent) ClientVersion() Version {
+	return r.client
+}
+
+// LibraryVersion returns the parsed version of libtorrent, zero if it
+// couldn't be parsed.
+func (r *Rtorrent) LibraryVersion() Version {
+	return r.library
+}
+
+// setVersion parses the "client/library" version.
+func (r *Rtorrent) setVersion(version string) {
+	r.Version = version
+	client, library, _ := strings.Cut(version, "/")
+	r.client, _ = ParseVersion(client)
+	r.library, _ = ParseVersion(library)
+}
+
+// legacyCommands maps the commands this package sends to the names they
+// had before rTorrent 0.9, which 0.9.7 dropped.
+var legacyCommands = map[string]string{
+	"d.multicall2":         "d.multicall",
+	"d.name":               "d.get_name",
+	"d.hash":               "d.get_hash",
+	"d.down.rate":          "d.get_down_rate",
+	"d.up.rate":            "d.get_up_rate",
+	"d.size_chunks":        "d.get_size_chunks",
+	"d.chunk_size":         "d.get_chunk_size",
+	"d.completed_chunks":   "d.get_completed_chunks",
+	"d.ratio":              "d.get_ratio",
+	"d.message":            "d.get_message",
+	"d.base_path":          "d.get_base_path",
+	"d.connection_current": "d.get_connection_current",
+	"d.complete":           "d.get_complete",
+	"d.hashing":            "d.get_hashing",
+	"d.state":              "d.get_state",
+	"d.custom1":            "d.get_custom1",
+	"d.custom2":            "d.get_custom2",
+	"d.custom3":            "d.get_custom3",
+	"d.custom4":            "d.get_custom4",
+	"d.custom5":            "d.get_custom5",
+	"d.peers_complete":     "d.get_peers_complete",
+	"d.peers_accounted":    "d.get_peers_accounted",
+	"d.priority":           "d.get_priority",
+	"d.directory":          "d.get_directory",
+	"d.left_bytes":         "d.get_left_bytes",
+	"d.skip.total":         "d.get_skip_total",
+	"d.throttle_name":      "d.get_throttle_name",
+	"d.up.total":           "d.get_up_total",
+	"d.down.total":         "d.get_down_total",
+	"d.size_bytes":         "d.get_size_bytes",
+	"d.completed_bytes":    "d.get_completed_bytes",
+	"d.bytes_done":         "d.get_bytes_done",
+	"d.creation_date":      "d.get_creation_date",
+	"d.custom1.set":        "d.set_custom1",
+	"d.directory.set":      "d.set_directory",
+
+	"f.path":             "f.get_path",
+	"f.size_bytes":       "f.get_size_bytes",
+	"f.size_chunks":      "f.get_size_chunks",
+	"f.completed_chunks": "f.get_completed_chunks",
+	"f.priority":         "f.get_priority",
+
+	"t.url":               "t.get_url",
+	"t.scrape_complete":   "t.get_scrape_complete",
+	"t.scrape_incomplete": "t.get_scrape_incomplete",
+
+	"p.address":           "p.get_address",
+	"p.port":              "p.get_port",
+	"p.client_version":    "p.get_client_version",
+	"p.down_rate":         "p.get_down_rate",
+	"p.up_rate":           "p.get_up_rate",
+	"p.completed_percent": "p.get_completed_percent",
+
+	"throttle.global_down.rate":     "get_down_rate",
+	"throttle.global_up.rate":       "get_up_rate",
+	"throttle.global_down.total":    "get_down_total",
+	"throttle.global_up.total":      "get_up_total",
+	"throttle.global_down.max_rate": "get_download_rate",
+	"throttle.global_up.max_rate":   "get_upload_rate",
+	"directory.default":             "get_directory",
+
+	"load.normal":        "load",
+	"load.verbose":       "load_verbose",
+	"load.start":         "load_start",
+	"load.start_verbose": "load_start_verbose",
+	"load.raw":           "load_raw",
+	"load.raw_start":     "load_raw_start",
+}
+
+// optionalCommands are torrent fields which some rTorrent versions know
+// under neither name, e.g. d.timestamp.finished before 0.9. cat, which
+// answers an empty string, is sent in their place so that the row keeps its
+// shape, and parseTorrent falls back on what it can derive.
+var optionalCommands = map[string]bool{
+	"d.timestamp.finished": true,
+	"d.size_bytes":         true,
+	"d.completed_bytes":    true,
+	"d.up.total":           true,
+	"d.down.total":         true,
+}
+
+// legacyTargetless are the legacy commands which took no target, their
+// current names take an empty one first.
+var legacyTargetless = map[string]bool{
+	"d.multicall":        true,
+	"load":               true,
+	"load_verbose":       true,
+	"load_start":         true,
+	"load_start_verbose": true,
+	"load_raw":           true,
+	"load_raw_start":     true,
+}
+
+// Supports reports whether rTorrent knows method, as listed by
+// system.listMethods. The list is fetched on the first call, false is
+// returned while it can't be.
+func (r *Rtorrent) Supports(method string) bool {
+	methods, err := r.listMethods(context.Background())
+	return err == nil && methods[method]
+}
+
+// listMethods returns the methods rTorrent knows, fetching them once. It
+// also picks the command names to send, see legacyCommands.
+func (r *Rtorrent) listMethods(ctx context.Context) (map[string]bool, error) {
+	r.probe.Lock()
+	defer r.probe.Unlock()
+	if r.methods != nil {
+		return r.methods, nil
+	}
+
+	req := buildCallRequest("system.listMethods")
+	resp, err := r.execute(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	values, err := resp.arrayParam()
+	if err != nil {
+		return nil, err
+	}
+
+	methods := make(map[string]bool, len(values))
+	for _, v := range values {
+		if name, err := v.stringValue(); err == nil {
+			methods[name] = true
+		}
+	}
+
+	// rename whichever of the two names rTorrent doesn't know, so that
+	// Call works with either.
+	renames := make(map[string]string)
+	for current, legacy := range legacyCommands {
+		switch {
+		case !methods[current] && methods[legacy]:
+			renames[current] = legacy
+		case !methods[legacy] && methods[current]:
+			renames[legacy] = current
+		}
+	}
+	for current := range optionalCommands {
+		if methods["cat"] && !methods[current] && !methods[legacyCommands[current]] {
+			renames[current] = "cat"
+		}
+	}
+
+	r.methods = methods
+	r.renames.Store(&renames)
+	return methods, nil
+}
+
+// rename rewrites req with the command names rTorrent knows. Requests are
+// built with the current names, so this only costs with old versions.
+func (r *Rtorrent) rename(req xmlrpcMethodCall) xmlrpcMethodCall {
+	renames := r.renames.Load()
+	if renames == nil || len(*renames) == 0 {
+		return req
+	}
+
+	params := make([]xmlrpcValue, len(req.Params))
+	for i := range req.Params {
+		params[i] = req.Params[i].Value
+	}
+	method, params := renameCall(*renames, req.MethodName, params)
+
+	renamed := xmlrpcMethodCall{MethodName: method, Params: make([]xmlrpcParam, len(params))}
+	for i, v := range params {
+		renamed.Params[i] = xmlrpcParam{Value: v}
+	}
+	return renamed
+}
+
+// renameCall renames method and the commands in its params, e.g. the fields
+// of d.multicall2 or the calls of system.multicall.
+func renameCall(renames map[string]string, method string, params []xmlrpcValue) (string, []xmlrpcValue) {
+	if name, ok := renames[method]; ok {
+		switch {
+		case legacyTargetless[name] && len(params) > 0:
+			if target, err := params[0].stringValue(); err == nil && target == "" {
+				params = params[1:]
+			}
+		case legacyTargetless[method]:
+			params = append([]xmlrpcValue{newStringValue("")}, params...)
+		}
+		method = name
+	}
+
+	renamed := make([]xmlrpcValue, len(params))
+	for i, v := range params {
+		renamed[i] = renameValue(renames, v)
+	}
+	return method, renamed
+}
+
+func renameValue(renames map[string]string, v xmlrpcValue) xmlrpcValue {
+	switch {
+	case v.String != nil || v.untyped():
+		s, _ := v.stringValue()
+		if cmd, args, ok := strings.Cut(s, "="); ok {
+			if name, ok := renames[cmd]; ok {
+				return newStringValue(name + "=" + args)
+			}
+		}
+	case v.Array != nil:
+		values := make([]xmlrpcValue, len(v.Array.Values))
+		for i := range v.Array.Values {
+			values[i] = renameValue(renames, v.Array.Values[i])
+		}
+		return newArrayValue(values...)
+	case v.Struct != nil:
+		return renameMulticall(renames, v)
+	}
+	return v
+}
+
+// renameMulticall renames a {methodName, params} struct of system.multicall.
+func renameMulticall(renames map[string]string, v xmlrpcValue) xmlrpcValue {
+	var method string
+	var params []xmlrpcValue
+	for _, m := range v.Struct.Members {
+		switch m.Name {
+		case "methodName":
+			method, _ = m.Value.stringValue()
+		case "params":
+			params, _ = m.Value.arrayValues()
+		}
+	}
+	if method == "" {
+		return v
+	}
+
+	method, params = renameCall(renames, method, params)
+	return newMethodCallValues(method, params...)
+}
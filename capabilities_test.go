@@ -0,0 +1,137 @@
+package rtapi
+
+import (
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/pyed/rtapi/rtapitest"
+)
+
+func TestParseVersion(t *testing.T) {
+	testCases := []struct {
+		s        string
+		expected Version
+		err      bool
+	}{
+		{"0.9.8", Version{0, 9, 8, ""}, false},
+		{"0.13.8", Version{0, 13, 8, ""}, false},
+		{"0.13", Version{0, 13, 0, ""}, false},
+		{" 0.9.8-jesec ", Version{0, 9, 8, "-jesec"}, false},
+		{"0.9.", Version{0, 9, 0, "."}, false},
+		{"v0.9.8", Version{}, true},
+		{"", Version{}, true},
+		{"99999999999999999999.1", Version{}, true},
+	}
+
+	for i, test := range testCases {
+		v, err := ParseVersion(test.s)
+		if v != test.expected || (err != nil) != test.err {
+			t.Errorf("Case %d: Expected %+v, error %t, got: %+v, %v", i, test.expected, test.err, v, err)
+		}
+	}
+
+	v := Version{Major: 0, Minor: 9, Patch: 8, Suffix: "-jesec"}
+	if v.String() != "0.9.8-jesec" {
+		t.Errorf("Expected 0.9.8-jesec, got: %s", v)
+	}
+	if !v.AtLeast(0, 9, 7) || v.AtLeast(0, 10, 0) || !v.AtLeast(0, 9, 8) {
+		t.Errorf("Unexpected AtLeast results for %s", v)
+	}
+	if c := v.Compare(Version{Major: 0, Minor: 9, Patch: 8}); c != 0 {
+		t.Errorf("Expected suffixes to be ignored, got: %d", c)
+	}
+}
+
+func TestSupports(t *testing.T) {
+	fake := rtapitest.NewServer()
+	defer fake.Close()
+
+	rt, err := NewRtorrent(fake.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := rt.ClientVersion(); v != (Version{Major: 0, Minor: 9, Patch: 8}) {
+		t.Errorf("Expected client version 0.9.8, got: %s", v)
+	}
+	if v := rt.LibraryVersion(); v != (Version{Major: 0, Minor: 13, Patch: 8}) {
+		t.Errorf("Expected library version 0.13.8, got: %s", v)
+	}
+	if n := fake.CallCount("system.listMethods"); n != 0 {
+		t.Errorf("Expected no probe for 0.9.8, got %d", n)
+	}
+
+	if !rt.Supports("d.multicall2") || rt.Supports("d.multicall.filtered") {
+		t.Error("Expected d.multicall2 to be supported, and d.multicall.filtered not to be")
+	}
+	rt.Supports("load.raw_start")
+	if n := fake.CallCount("system.listMethods"); n != 1 {
+		t.Errorf("Expected a single probe, got %d", n)
+	}
+}
+
+func TestLegacyVersion(t *testing.T) {
+	fake := rtapitest.NewServer()
+	defer fake.Close()
+	session := rtapitest.DefaultSession
+	session.ClientVersion = "0.8.9"
+	fake.SetSession(session)
+	fake.AddTorrent(&rtapitest.Torrent{Hash: "8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648", Name: "ubuntu.iso"})
+
+	rt, err := NewRtorrent(fake.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.CallCount("system.listMethods"); n != 1 {
+		t.Errorf("Expected old versions to be probed, got %d probes", n)
+	}
+
+	// the fake only knows the current names.
+	name, err := rt.Call("d.get_name", "8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648")
+	if err != nil || name != "ubuntu.iso" {
+		t.Errorf("Expected the legacy name to be mapped to d.name, got: %v, %v", name, err)
+	}
+	if _, err := rt.Call("load_start", "magnet:?xt=urn:btih:02ca77a6a047fd37f04337437d18f82e61861084"); err != nil {
+		t.Errorf("Expected load_start to be mapped to load.start with a target, got: %v", err)
+	}
+	if fake.Torrent("02CA77A6A047FD37F04337437D18F82E61861084") == nil {
+		t.Error("Expected the magnet link to be loaded")
+	}
+}
+
+func TestRename(t *testing.T) {
+	rt := &Rtorrent{}
+	renames := maps.Clone(legacyCommands)
+	renames["d.timestamp.finished"] = "cat" // unknown before 0.9
+	rt.renames.Store(&renames)
+
+	req := mustBuildRequest(rt.rename(buildTorrentsRequest()))
+	expected := mustBuildCallRequest("d.multicall", "main",
+		"d.get_name=", "d.get_hash=", "d.get_down_rate=", "d.get_up_rate=", "d.get_size_chunks=",
+		"d.get_chunk_size=", "d.get_completed_chunks=", "d.get_ratio=", "d.load_date=", "d.get_message=",
+		"d.get_base_path=", "d.is_active=", "d.get_connection_current=", "d.get_complete=", "d.get_hashing=",
+		"d.get_custom1=", "cat=", "d.get_creation_date=", "d.get_size_bytes=", "d.get_completed_bytes=",
+		"d.get_up_total=", "d.get_down_total=", "d.is_open=", "d.get_state=", "d.is_hash_checking=")
+	if req != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, req)
+	}
+
+	req = mustBuildRequest(rt.rename(buildDownloadWithOptionsRequest("magnet:?xt=urn:btih:x&a=b", "/data", "Linux")))
+	for _, s := range []string{"<string>load_start</string>", "<array><data><value><string>magnet:?xt=urn:btih:x&amp;a=b", "d.set_directory=", "d.set_custom1=Linux"} {
+		if !strings.Contains(req, s) {
+			t.Errorf("Expected %s in:\n%s", s, req)
+		}
+	}
+
+	req = mustBuildRequest(rt.rename(buildTransferRequest()))
+	for _, s := range []string{"<methodName>system.multicall</methodName>", "<string>get_down_rate</string>", "<string>get_up_rate</string>"} {
+		if !strings.Contains(req, s) {
+			t.Errorf("Expected %s in:\n%s", s, req)
+		}
+	}
+
+	// nothing to rename, the request is sent as is.
+	if req := mustBuildRequest((&Rtorrent{}).rename(buildTorrentsRequest())); req != mustBuildTorrentsRequest() {
+		t.Errorf("Expected the request as is, got: %s", req)
+	}
+}
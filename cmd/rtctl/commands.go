@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pyed/rtapi"
+)
+
+var errNoHashes = errors.New("at least one hash is required")
+
+func runList(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	sortSpec := fs.String("sort", "", "sort by comma separated keys, prefix one with - to reverse it: "+strings.Join(rtapi.SortKeys(), ", "))
+	state := fs.String("state", "", "only show torrents in this state, e.g. Seeding")
+	label := fs.String("label", "", "only show torrents with this label")
+	name := fs.String("name", "", "only show torrents whose name contains this text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	torrents, err := rt.Torrents()
+	if err != nil {
+		return err
+	}
+
+	torrents = filterTorrents(torrents, *state, *label, *name)
+	if *sortSpec != "" {
+		if err := sortTorrents(torrents, *sortSpec); err != nil {
+			return err
+		}
+	}
+
+	return p.torrents(torrents)
+}
+
+// filterTorrents returns the torrents matching every non-empty filter, state
+// and label are compared case-insensitively, name is a substring match.
+func filterTorrents(ts rtapi.Torrents, state, label, name string) rtapi.Torrents {
+	name = strings.ToLower(name)
+
+	filtered := make(rtapi.Torrents, 0, len(ts))
+	for _, t := range ts {
+		if state != "" && !strings.EqualFold(t.State.String(), state) {
+			continue
+		}
+		if label != "" && !strings.EqualFold(t.Label, label) {
+			continue
+		}
+		if name != "" && !strings.Contains(strings.ToLower(t.Name), name) {
+			continue
+		}
+		filtered = append(filtered, t)
+	}
+	return filtered
+}
+
+// sortTorrents sorts ts by spec, a comma separated list of the keys of
+// rtapi.ParseSort. A key is reversed by a "-" prefix or, as before specs, a
+// "-rev" suffix.
+func sortTorrents(ts rtapi.Torrents, spec string) error {
+	keys := strings.Split(spec, ",")
+	for i, key := range keys {
+		if name, ok := strings.CutSuffix(strings.TrimSpace(key), "-rev"); ok {
+			keys[i] = "-" + name
+		}
+	}
+
+	c, err := rtapi.ParseSort(strings.Join(keys, ","))
+	if err != nil {
+		return err
+	}
+	ts.SortFunc(c)
+	return nil
+}
+
+func runInfo(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	if len(args) != 1 {
+		return errors.New("exactly one hash is required")
+	}
+
+	t, err := rt.GetTorrent(args[0])
+	if err != nil {
+		return err
+	}
+	if err := rt.Extend(t); err != nil {
+		return err
+	}
+
+	return p.torrent(t)
+}
+
+func runAdd(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	dir := fs.String("dir", "", "download directory, defaults to rTorrent's default directory")
+	label := fs.String("label", "", "label to assign (d.custom1)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("at least one url, magnet or path is required")
+	}
+
+	for _, link := range fs.Args() {
+		link = resolveLink(link)
+
+		var err error
+		if *dir != "" || *label != "" {
+			err = rt.DownloadWithOptions(&rtapi.DotTorrentWithOptions{
+				Link:  link,
+				Dir:   *dir,
+				Label: *label,
+			})
+		} else {
+			err = rt.Download(link)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveLink makes local .torrent paths absolute, since rTorrent resolves
+// them relative to its own working directory.
+func resolveLink(link string) string {
+	if strings.Contains(link, ":") || filepath.IsAbs(link) {
+		return link
+	}
+
+	abs, err := filepath.Abs(link)
+	if err != nil {
+		return link
+	}
+	return abs
+}
+
+func hashesToTorrents(hashes []string) rtapi.Torrents {
+	ts := make(rtapi.Torrents, len(hashes))
+	for i := range hashes {
+		ts[i] = &rtapi.Torrent{Hash: hashes[i]}
+	}
+	return ts
+}
+
+func runStart(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	fs := flag.NewFlagSet("start", flag.ContinueOnError)
+	force := fs.Bool("force", false, "also open and resume queued or paused torrents")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errNoHashes
+	}
+	if *force {
+		return rt.ForceStart(hashesToTorrents(fs.Args())...)
+	}
+	return rt.Start(hashesToTorrents(fs.Args())...)
+}
+
+func runStop(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errNoHashes
+	}
+	return rt.Stop(hashesToTorrents(args)...)
+}
+
+func runPause(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errNoHashes
+	}
+	return rt.Pause(hashesToTorrents(args)...)
+}
+
+func runResume(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errNoHashes
+	}
+	return rt.Resume(hashesToTorrents(args)...)
+}
+
+func runCheck(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errNoHashes
+	}
+	return rt.Check(hashesToTorrents(args)...)
+}
+
+func runRemove(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	withData := fs.Bool("data", false, "also delete the downloaded data")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return errNoHashes
+	}
+
+	ts := hashesToTorrents(fs.Args())
+	if *withData {
+		// the path is needed to delete the data.
+		var err error
+		if ts, err = rt.GetTorrents(fs.Args()...); err != nil {
+			return err
+		}
+	}
+
+	return rt.Delete(*withData, ts...)
+}
+
+func runSpeeds(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	tr, err := rt.Transfer(context.Background())
+	if err != nil {
+		return err
+	}
+	return p.speeds(tr.DownRate, tr.UpRate)
+}
+
+func runStats(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	st, err := rt.Stats()
+	if err != nil {
+		return err
+	}
+
+	return p.record(st,
+		[]string{"ThrottleUp", "ThrottleDown", "TotalUp", "TotalDown", "Port", "Directory", "FreeDiskSpace", "OpenSockets", "DHT", "Torrents", "Uptime"},
+		[]string{
+			p.rate(st.ThrottleUp),
+			p.rate(st.ThrottleDown),
+			p.bytes(st.TotalUp),
+			p.bytes(st.TotalDown),
+			fmt.Sprint(st.Port),
+			st.Directory,
+			p.bytes(st.FreeDiskSpace),
+			fmt.Sprint(st.OpenSockets),
+			fmt.Sprintf("%s (%d nodes)", st.DHT.Mode, st.DHT.Nodes),
+			fmt.Sprintf("%d (%d active)", st.Torrents.Total, st.Torrents.Active),
+			st.Uptime.String(),
+		},
+	)
+}
+
+func runCall(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("a method is required")
+	}
+
+	v, err := rt.Call(args[0], args[1:]...)
+	if err != nil {
+		return err
+	}
+
+	return p.value(v)
+}
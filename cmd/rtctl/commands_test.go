@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pyed/rtapi"
+)
+
+var testTorrents = rtapi.Torrents{
+	&rtapi.Torrent{Name: "debian-8.7.1-amd64-netinst.iso", State: rtapi.Seeding, Label: "Software", Size: 300},
+	&rtapi.Torrent{Name: "ubuntu-17.04-server-amd64.iso", State: rtapi.Leeching, Label: "software", Size: 700},
+	&rtapi.Torrent{Name: "archlinux-2017.04.01-x86_64.iso", State: rtapi.Seeding, Size: 500},
+}
+
+func TestFilterTorrents(t *testing.T) {
+	testCases := []struct {
+		state, label, name string
+		expected           int
+	}{
+		{"", "", "", 3},
+		{"seeding", "", "", 2},
+		{"", "Software", "", 2},
+		{"Seeding", "software", "", 1},
+		{"", "", "ISO", 3},
+		{"", "", "arch", 1},
+		{rtapi.Stopped.String(), "", "", 0},
+	}
+
+	for i, test := range testCases {
+		got := filterTorrents(testTorrents, test.state, test.label, test.name)
+		if len(got) != test.expected {
+			t.Errorf("Case %d: Expected %d torrents, got: %d", i, test.expected, len(got))
+		}
+	}
+}
+
+func TestSortTorrents(t *testing.T) {
+	ts := append(rtapi.Torrents(nil), testTorrents...)
+
+	for _, spec := range []string{"size-rev", "-size", "-size,name"} {
+		if err := sortTorrents(ts, spec); err != nil {
+			t.Fatalf("%q: %v", spec, err)
+		}
+		if ts[0].Size != 700 || ts[2].Size != 300 {
+			t.Errorf("%q: Expected sizes 700, 500, 300, got: %d, %d, %d", spec, ts[0].Size, ts[1].Size, ts[2].Size)
+		}
+	}
+
+	for _, key := range rtapi.SortKeys() {
+		if err := sortTorrents(ts, key+"-rev,"+key); err != nil {
+			t.Errorf("Expected %q to be a known sort key, got: %v", key, err)
+		}
+	}
+
+	if err := sortTorrents(ts, "name,colour"); err == nil {
+		t.Error("Expected colour to be an unknown sort key")
+	}
+}
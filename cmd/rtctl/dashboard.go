@@ -0,0 +1,526 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pyed/rtapi"
+)
+
+// action is what the dashboard asks the event loop to do after a key press.
+type action int
+
+const (
+	actNone action = iota
+	actQuit
+	actRefresh
+	actStart
+	actStop
+	actPause
+	actResume
+	actCheck
+	actDelete
+	actDeleteData
+)
+
+// stateFilters are cycled through with "f", the zero state shows all.
+var stateFilters = append([]rtapi.State{0}, rtapi.States...)
+
+// column is a single column of the torrents list.
+type column struct {
+	title string
+	sort  string // key of rtapi.ParseSort, empty if not sortable
+	width int    // 0 for the flexible name column
+	value func(t *rtapi.Torrent) string
+}
+
+var columns = []column{
+	{"NAME", "name", 0, func(t *rtapi.Torrent) string { return t.Name }},
+	{"STATE", "state", 12, func(t *rtapi.Torrent) string { return t.State.String() }},
+	{"SIZE", "size", 10, func(t *rtapi.Torrent) string { return humanBytes(t.Size) }},
+	{"DONE", "percent", 6, func(t *rtapi.Torrent) string { return t.Percent }},
+	{"DOWN", "down", 12, func(t *rtapi.Torrent) string { return humanBytes(t.DownRate) + "/s" }},
+	{"UP", "up", 12, func(t *rtapi.Torrent) string { return humanBytes(t.UpRate) + "/s" }},
+	{"RATIO", "ratio", 6, func(t *rtapi.Torrent) string { return strconv.FormatFloat(t.Ratio, 'f', 2, 64) }},
+	{"UPLOADED", "uptotal", 10, func(t *rtapi.Torrent) string { return humanBytes(t.UpTotal) }},
+	{"ADDED", "age", 10, func(t *rtapi.Torrent) string { return t.AddedAt.Format("2006-01-02") }},
+	{"LABEL", "label", 10, func(t *rtapi.Torrent) string { return t.Label }},
+}
+
+// details holds what the detail pane shows for a single torrent.
+type details struct {
+	hash     string
+	files    []*rtapi.File
+	trackers []*rtapi.Tracker
+	peers    []*rtapi.Peer
+}
+
+// snapshot is the result of polling rTorrent once.
+type snapshot struct {
+	torrents rtapi.Torrents
+	down, up uint64
+	details  *details
+	err      error
+}
+
+// dashboard is the state of the full-screen view, it does no I/O.
+type dashboard struct {
+	torrents   rtapi.Torrents
+	down, up   uint64
+	details    *details
+	showDetail bool
+
+	sortCol int // index into columns, always a sortable one
+	sortRev bool
+	state   int // index into stateFilters
+	label   string
+
+	hash   string // selected torrent
+	offset int    // first visible row of the list
+
+	status  string
+	confirm action // pending action waiting for "y"
+}
+
+func (d *dashboard) update(s snapshot) {
+	if s.err != nil {
+		d.status = "error: " + s.err.Error()
+		return
+	}
+
+	d.torrents, d.down, d.up = s.torrents, s.down, s.up
+	if s.details != nil {
+		d.details = s.details
+	}
+}
+
+// rows returns the filtered and sorted torrents shown in the list.
+func (d *dashboard) rows() rtapi.Torrents {
+	rows := filterTorrents(d.torrents, stateFilters[d.state].String(), d.label, "")
+
+	spec := columns[d.sortCol].sort
+	if d.sortRev {
+		spec = "-" + spec
+	}
+	sortTorrents(rows, spec+",name")
+
+	return rows
+}
+
+// selected returns the index of the selected torrent within rows, or -1.
+func (d *dashboard) selected(rows rtapi.Torrents) int {
+	if len(rows) == 0 {
+		return -1
+	}
+	for i, t := range rows {
+		if t.Hash == d.hash {
+			return i
+		}
+	}
+	return 0
+}
+
+// selectedTorrent returns the selected torrent, or nil if the list is empty.
+func (d *dashboard) selectedTorrent() *rtapi.Torrent {
+	rows := d.rows()
+	if i := d.selected(rows); i >= 0 {
+		return rows[i]
+	}
+	return nil
+}
+
+// detailHash returns the hash to fetch details for, or "" if the pane is closed.
+func (d *dashboard) detailHash() string {
+	if !d.showDetail {
+		return ""
+	}
+	if t := d.selectedTorrent(); t != nil {
+		return t.Hash
+	}
+	return ""
+}
+
+func (d *dashboard) move(delta int) {
+	rows := d.rows()
+	i := d.selected(rows)
+	if i < 0 {
+		return
+	}
+
+	i += delta
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(rows) {
+		i = len(rows) - 1
+	}
+	d.hash = rows[i].Hash
+}
+
+func (d *dashboard) cycleSort(delta int) {
+	for i := 0; i < len(columns); i++ {
+		d.sortCol = (d.sortCol + delta + len(columns)) % len(columns)
+		if columns[d.sortCol].sort != "" {
+			return
+		}
+	}
+}
+
+// labels returns the distinct labels in the snapshot, sorted.
+func (d *dashboard) labels() []string {
+	seen := make(map[string]bool)
+	labels := []string{""}
+	for _, t := range d.torrents {
+		if t.Label != "" && !seen[t.Label] {
+			seen[t.Label] = true
+			labels = append(labels, t.Label)
+		}
+	}
+	sort.Strings(labels[1:])
+	return labels
+}
+
+func (d *dashboard) cycleLabel() {
+	labels := d.labels()
+	for i := range labels {
+		if labels[i] == d.label {
+			d.label = labels[(i+1)%len(labels)]
+			return
+		}
+	}
+	d.label = ""
+}
+
+// handleKey applies a key press, and returns what the event loop should do.
+func (d *dashboard) handleKey(key string) action {
+	if d.confirm != actNone {
+		act := d.confirm
+		d.confirm, d.status = actNone, ""
+		if key == "y" || key == "Y" {
+			return act
+		}
+		return actNone
+	}
+
+	d.status = ""
+	switch key {
+	case "q", "ctrl-c":
+		return actQuit
+	case "up", "k":
+		d.move(-1)
+	case "down", "j":
+		d.move(1)
+	case "pgup":
+		d.move(-10)
+	case "pgdown":
+		d.move(10)
+	case "home", "g":
+		d.move(-len(d.torrents))
+	case "end", "G":
+		d.move(len(d.torrents))
+	case "left", "<":
+		d.cycleSort(-1)
+	case "right", ">":
+		d.cycleSort(1)
+	case "r":
+		d.sortRev = !d.sortRev
+	case "f":
+		d.state = (d.state + 1) % len(stateFilters)
+	case "l":
+		d.cycleLabel()
+	case "enter":
+		d.showDetail = !d.showDetail
+		if d.showDetail {
+			return actRefresh
+		}
+	case "esc":
+		d.showDetail = false
+	case "s":
+		return d.onSelected(actStart)
+	case "t":
+		return d.onSelected(actStop)
+	case "p":
+		if t := d.selectedTorrent(); t != nil && t.State == rtapi.Paused {
+			return actResume
+		}
+		return d.onSelected(actPause)
+	case "c":
+		return d.onSelected(actCheck)
+	case "d", "D":
+		t := d.selectedTorrent()
+		if t == nil {
+			return actNone
+		}
+		d.confirm = actDelete
+		d.status = fmt.Sprintf("Delete %s? (y/n)", t.Name)
+		if key == "D" {
+			d.confirm = actDeleteData
+			d.status = fmt.Sprintf("Delete %s and its data? (y/n)", t.Name)
+		}
+	}
+	return actNone
+}
+
+func (d *dashboard) onSelected(act action) action {
+	if d.selectedTorrent() == nil {
+		return actNone
+	}
+	return act
+}
+
+const helpLine = "q quit  ↑↓ select  ←→ sort  r reverse  f state  l label  enter details  s start  t stop  p pause/resume  c check  d/D delete"
+
+// render returns the screen as width x height lines.
+func (d *dashboard) render(width, height int) []string {
+	if width < 20 || height < 6 {
+		return []string{fit("terminal too small", width)}
+	}
+
+	rows := d.rows()
+	sel := d.selected(rows)
+
+	lines := make([]string, 0, height)
+	lines = append(lines, fit(d.header(len(rows)), width))
+	lines = append(lines, "\x1b[1m"+fit(d.columnsLine(width), width)+"\x1b[0m")
+
+	listHeight := height - 3
+	var pane []string
+	if d.showDetail {
+		paneHeight := height / 2
+		listHeight -= paneHeight
+		pane = d.detailLines(rows, sel, width, paneHeight)
+	}
+
+	// keep the selection visible.
+	if sel >= 0 {
+		if sel < d.offset {
+			d.offset = sel
+		}
+		if sel >= d.offset+listHeight {
+			d.offset = sel - listHeight + 1
+		}
+	}
+	if d.offset > len(rows)-listHeight {
+		d.offset = len(rows) - listHeight
+	}
+	if d.offset < 0 {
+		d.offset = 0
+	}
+
+	for i := d.offset; i < d.offset+listHeight; i++ {
+		if i >= len(rows) {
+			lines = append(lines, "")
+			continue
+		}
+		line := fit(d.rowLine(rows[i], width), width)
+		if i == sel {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, pane...)
+
+	footer := d.status
+	if footer == "" {
+		footer = helpLine
+	}
+	lines = append(lines, fit(footer, width))
+
+	return lines
+}
+
+func (d *dashboard) header(shown int) string {
+	state, label := stateFilters[d.state].String(), d.label
+	if state == "" {
+		state = "All"
+	}
+	if label == "" {
+		label = "All"
+	}
+
+	dir := "▲"
+	if d.sortRev {
+		dir = "▼"
+	}
+
+	return fmt.Sprintf("rtctl  ↓ %s/s  ↑ %s/s  torrents: %d/%d  sort: %s%s  state: %s  label: %s",
+		humanBytes(d.down), humanBytes(d.up), shown, len(d.torrents),
+		strings.ToLower(columns[d.sortCol].title), dir, state, label)
+}
+
+// nameWidth returns the width left for the flexible name column.
+func nameWidth(width int) int {
+	w := width
+	for _, c := range columns {
+		w -= c.width + 1
+	}
+	if w < 10 {
+		w = 10
+	}
+	return w
+}
+
+func (d *dashboard) columnsLine(width int) string {
+	cells := make([]string, len(columns))
+	for i, c := range columns {
+		title := c.title
+		if i == d.sortCol {
+			if d.sortRev {
+				title += "▼"
+			} else {
+				title += "▲"
+			}
+		}
+		cells[i] = title
+	}
+	return joinCells(cells, width)
+}
+
+func (d *dashboard) rowLine(t *rtapi.Torrent, width int) string {
+	cells := make([]string, len(columns))
+	for i, c := range columns {
+		cells[i] = c.value(t)
+	}
+	return joinCells(cells, width)
+}
+
+func joinCells(cells []string, width int) string {
+	var b strings.Builder
+	for i, c := range columns {
+		w := c.width
+		if w == 0 {
+			w = nameWidth(width)
+		}
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(fit(cells[i], w))
+	}
+	return b.String()
+}
+
+func (d *dashboard) detailLines(rows rtapi.Torrents, sel, width, height int) []string {
+	lines := []string{fit("── details "+strings.Repeat("─", width), width)}
+
+	if sel < 0 {
+		lines = append(lines, "no torrent selected")
+	} else {
+		t := rows[sel]
+		tracker := ""
+		if t.Tracker != nil {
+			tracker = t.Tracker.String()
+		}
+		lines = append(lines,
+			"Name:    "+t.Name,
+			"Hash:    "+t.Hash,
+			"Path:    "+t.Path,
+			"Tracker: "+tracker,
+		)
+		if t.Message != "" {
+			lines = append(lines, "Message: "+t.Message)
+		}
+
+		if d.details == nil || d.details.hash != t.Hash {
+			lines = append(lines, "loading...")
+		} else {
+			lines = append(lines, fmt.Sprintf("Files (%d):", len(d.details.files)))
+			for _, f := range d.details.files {
+				percent := 100.0
+				if f.SizeChunks > 0 {
+					percent = float64(f.CompletedChunks) / float64(f.SizeChunks) * 100
+				}
+				lines = append(lines, fmt.Sprintf("  %5.1f%%  %10s  %s", percent, humanBytes(f.Size), f.Path))
+			}
+
+			lines = append(lines, fmt.Sprintf("Trackers (%d):", len(d.details.trackers)))
+			for _, tr := range d.details.trackers {
+				enabled := "off"
+				if tr.Enabled {
+					enabled = "on "
+				}
+				lines = append(lines, fmt.Sprintf("  %s  seeders: %d  leechers: %d  %s", enabled, tr.Seeders, tr.Leechers, tr.URL))
+			}
+
+			lines = append(lines, fmt.Sprintf("Peers (%d):", len(d.details.peers)))
+			for _, p := range d.details.peers {
+				lines = append(lines, fmt.Sprintf("  %s:%d  %3d%%  ↓ %s/s  ↑ %s/s  %s",
+					p.Address, p.Port, p.Percent, humanBytes(p.DownRate), humanBytes(p.UpRate), p.Client))
+			}
+		}
+	}
+
+	for i := range lines {
+		lines[i] = fit(lines[i], width)
+	}
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	return lines[:height]
+}
+
+// fit truncates or pads s with spaces to exactly width runes.
+func fit(s string, width int) string {
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		runes := []rune(s)
+		if width > 1 {
+			return string(runes[:width-1]) + "…"
+		}
+		return string(runes[:width])
+	}
+	return s + strings.Repeat(" ", width-n)
+}
+
+// parseKeys splits raw terminal input into key names, printable keys are
+// returned as is.
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		switch {
+		case b[0] == 0x1b && len(b) >= 3 && (b[1] == '[' || b[1] == 'O'):
+			n := 3
+			switch b[2] {
+			case 'A':
+				keys = append(keys, "up")
+			case 'B':
+				keys = append(keys, "down")
+			case 'C':
+				keys = append(keys, "right")
+			case 'D':
+				keys = append(keys, "left")
+			case 'H':
+				keys = append(keys, "home")
+			case 'F':
+				keys = append(keys, "end")
+			case '5', '6':
+				if len(b) >= 4 && b[3] == '~' {
+					n = 4
+					if b[2] == '5' {
+						keys = append(keys, "pgup")
+					} else {
+						keys = append(keys, "pgdown")
+					}
+				}
+			}
+			b = b[n:]
+			continue
+		case b[0] == 0x1b:
+			keys = append(keys, "esc")
+		case b[0] == '\r' || b[0] == '\n':
+			keys = append(keys, "enter")
+		case b[0] == 0x03:
+			keys = append(keys, "ctrl-c")
+		default:
+			r, size := utf8.DecodeRune(b)
+			keys = append(keys, string(r))
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
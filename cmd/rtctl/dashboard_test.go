@@ -0,0 +1,166 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/pyed/rtapi"
+)
+
+func newTestDashboard() *dashboard {
+	d := new(dashboard)
+	d.update(snapshot{
+		torrents: rtapi.Torrents{
+			&rtapi.Torrent{Name: "debian", Hash: "D", State: rtapi.Seeding, Label: "Software", Size: 300, Ratio: 1.2},
+			&rtapi.Torrent{Name: "ubuntu", Hash: "U", State: rtapi.Leeching, Label: "Linux", Size: 700, Ratio: 0.1},
+			&rtapi.Torrent{Name: "archlinux", Hash: "A", State: rtapi.Seeding, Size: 500, Ratio: 3.4},
+		},
+		down: 2048,
+		up:   1024,
+	})
+	return d
+}
+
+func names(ts rtapi.Torrents) []string {
+	names := make([]string, len(ts))
+	for i := range ts {
+		names[i] = ts[i].Name
+	}
+	return names
+}
+
+func TestDashboardSorting(t *testing.T) {
+	d := newTestDashboard()
+
+	if got := names(d.rows()); !reflect.DeepEqual(got, []string{"archlinux", "debian", "ubuntu"}) {
+		t.Errorf("Expected rows sorted by name, got: %v", got)
+	}
+
+	d.handleKey("right")
+	if columns[d.sortCol].title != "STATE" {
+		t.Fatalf("Expected sort column STATE, got: %s", columns[d.sortCol].title)
+	}
+	if got := names(d.rows()); !reflect.DeepEqual(got, []string{"ubuntu", "archlinux", "debian"}) {
+		t.Errorf("Expected rows sorted by state then name, got: %v", got)
+	}
+
+	d.handleKey("right")
+	if columns[d.sortCol].title != "SIZE" {
+		t.Fatalf("Expected sort column SIZE, got: %s", columns[d.sortCol].title)
+	}
+	d.handleKey("r")
+	if got := names(d.rows()); !reflect.DeepEqual(got, []string{"ubuntu", "archlinux", "debian"}) {
+		t.Errorf("Expected rows sorted by size descending, got: %v", got)
+	}
+
+	d.handleKey("left")
+	d.handleKey("left")
+	d.handleKey("left")
+	if columns[d.sortCol].title != "LABEL" {
+		t.Errorf("Expected left to wrap around to LABEL, got: %s", columns[d.sortCol].title)
+	}
+}
+
+func TestDashboardFilters(t *testing.T) {
+	d := newTestDashboard()
+
+	d.handleKey("f") // Leeching
+	if got := names(d.rows()); !reflect.DeepEqual(got, []string{"ubuntu"}) {
+		t.Errorf("Expected only leeching torrents, got: %v", got)
+	}
+	d.handleKey("f") // Seeding
+	if got := names(d.rows()); !reflect.DeepEqual(got, []string{"archlinux", "debian"}) {
+		t.Errorf("Expected only seeding torrents, got: %v", got)
+	}
+
+	d.handleKey("l") // Linux
+	if len(d.rows()) != 0 || d.label != "Linux" {
+		t.Errorf("Expected no seeding torrent labeled Linux, got: %v", names(d.rows()))
+	}
+	d.handleKey("l") // Software
+	d.handleKey("l") // All
+	if d.label != "" {
+		t.Errorf("Expected label filter to cycle back to all, got: %q", d.label)
+	}
+}
+
+func TestDashboardActions(t *testing.T) {
+	d := newTestDashboard()
+
+	d.handleKey("down")
+	if d.selectedTorrent().Name != "debian" {
+		t.Fatalf("Expected debian to be selected, got: %s", d.selectedTorrent().Name)
+	}
+
+	if act := d.handleKey("s"); act != actStart {
+		t.Errorf("Expected s to start, got: %v", act)
+	}
+	if act := d.handleKey("p"); act != actPause {
+		t.Errorf("Expected p to pause, got: %v", act)
+	}
+	d.selectedTorrent().State = rtapi.Paused
+	if act := d.handleKey("p"); act != actResume {
+		t.Errorf("Expected p to resume a paused torrent, got: %v", act)
+	}
+	if act := d.handleKey("d"); act != actNone || !strings.Contains(d.status, "debian") {
+		t.Errorf("Expected d to ask for confirmation, got: %v, %q", act, d.status)
+	}
+	if act := d.handleKey("n"); act != actNone {
+		t.Errorf("Expected n to cancel the deletion, got: %v", act)
+	}
+	d.handleKey("D")
+	if act := d.handleKey("y"); act != actDeleteData {
+		t.Errorf("Expected y to confirm the deletion, got: %v", act)
+	}
+	if act := d.handleKey("enter"); act != actRefresh || d.detailHash() != "D" {
+		t.Errorf("Expected enter to open the details of D, got: %v, %q", act, d.detailHash())
+	}
+	if act := d.handleKey("q"); act != actQuit {
+		t.Errorf("Expected q to quit, got: %v", act)
+	}
+}
+
+func TestDashboardRender(t *testing.T) {
+	d := newTestDashboard()
+	d.handleKey("enter")
+	d.update(snapshot{
+		torrents: d.torrents,
+		down:     2048,
+		details: &details{
+			hash:  "A",
+			files: []*rtapi.File{{Path: "archlinux.iso", Size: 500, SizeChunks: 2, CompletedChunks: 1}},
+			peers: []*rtapi.Peer{{Address: "10.0.0.2", Port: 51413, Client: "Transmission 2.92"}},
+		},
+	})
+
+	lines := d.render(120, 30)
+	if len(lines) != 30 {
+		t.Fatalf("Expected 30 lines, got: %d", len(lines))
+	}
+
+	screen := strings.Join(lines, "\n")
+	for _, s := range []string{"↓ 2.0 KiB/s", "torrents: 3/3", "NAME▲", "archlinux.iso", "Peers (1):", "10.0.0.2:51413"} {
+		if !strings.Contains(screen, s) {
+			t.Errorf("Expected screen to contain %q, got:\n%s", s, screen)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	if got := fit("abc", 5); got != "abc  " {
+		t.Errorf("Expected padding, got: %q", got)
+	}
+	if got := fit("↓ abcdef", 4); got != "↓ a…" || utf8.RuneCountInString(got) != 4 {
+		t.Errorf("Expected truncation to 4 runes, got: %q", got)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("j\x1b[A\x1b[6~\r\x1bq\x03"))
+	expected := []string{"j", "up", "pgdown", "enter", "esc", "q", "ctrl-c"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got: %v", expected, got)
+	}
+}
@@ -0,0 +1,203 @@
+// Command rtctl is a command-line client for rTorrent built on rtapi.
+//
+// Usage:
+//
+//	rtctl [-addr address] [-network auto|tcp|unix] [-o table|json|csv] [-record dir] <command> [arguments]
+//
+// The address, network and output format can also be set through the
+// RTCTL_ADDR, RTCTL_NETWORK and RTCTL_OUTPUT environment variables, flags
+// take precedence over the environment.
+//
+// With -record, the traffic with rTorrent is saved as golden files that
+// rtapitest.NewReplayer can serve, info hashes and the home directory are
+// scrubbed so the files can be attached to bug reports.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pyed/rtapi"
+	"github.com/pyed/rtapi/rtapitest"
+)
+
+const usageHeader = `Usage: rtctl [flags] <command> [arguments]
+
+Commands:
+`
+
+// command is a single rtctl subcommand.
+type command struct {
+	usage string
+	run   func(rt *rtapi.Rtorrent, p *printer, args []string) error
+}
+
+var commands = map[string]command{
+	"list":   {"list [-sort key] [-state state] [-label label] [-name text]", runList},
+	"info":   {"info <hash>", runInfo},
+	"add":    {"add [-dir dir] [-label label] <url|magnet|path>...", runAdd},
+	"start":  {"start [-force] <hash>...", runStart},
+	"stop":   {"stop <hash>...", runStop},
+	"pause":  {"pause <hash>...", runPause},
+	"resume": {"resume <hash>...", runResume},
+	"check":  {"check <hash>...", runCheck},
+	"rm":     {"rm [-data] <hash>...", runRemove},
+	"speeds": {"speeds", runSpeeds},
+	"stats":  {"stats", runStats},
+	"call":   {"call <method> [args]...", runCall},
+	"top":    {"top [-interval 2s]", runTop},
+}
+
+// config holds the global settings shared by every command.
+type config struct {
+	addr    string
+	network string
+	output  string
+	record  string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	cfg, args, err := parseConfig(args, os.Getenv, stderr)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "rtctl: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	p, err := newPrinter(stdout, cfg.output)
+	if err != nil {
+		fmt.Fprintln(stderr, "rtctl:", err)
+		return 2
+	}
+
+	rt, err := connect(cfg)
+	if err != nil {
+		fmt.Fprintln(stderr, "rtctl:", err)
+		return 1
+	}
+
+	if err := cmd.run(rt, p, args[1:]); err != nil {
+		fmt.Fprintf(stderr, "rtctl %s: %s\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// parseConfig reads the global flags, falling back to the environment looked
+// up by getenv, and returns the remaining arguments.
+func parseConfig(args []string, getenv func(string) string, stderr io.Writer) (*config, []string, error) {
+	cfg := &config{
+		addr:    envOr(getenv, "RTCTL_ADDR", "localhost:5000"),
+		network: envOr(getenv, "RTCTL_NETWORK", "auto"),
+		output:  envOr(getenv, "RTCTL_OUTPUT", "table"),
+	}
+
+	fs := flag.NewFlagSet("rtctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { usage(stderr) }
+	fs.StringVar(&cfg.addr, "addr", cfg.addr, "rTorrent scgi address, host:port or /path/to/socket, or an http(s) URL")
+	fs.StringVar(&cfg.network, "network", cfg.network, "network to reach rTorrent: auto, tcp or unix")
+	fs.StringVar(&cfg.output, "o", cfg.output, "output format: table, json or csv")
+	fs.StringVar(&cfg.record, "record", "", "record the traffic with rTorrent to golden files in this directory")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	switch cfg.network {
+	case "auto", "tcp", "unix":
+	default:
+		err := fmt.Errorf("unknown network %q", cfg.network)
+		fmt.Fprintln(stderr, "rtctl:", err)
+		return nil, nil, err
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+func envOr(getenv func(string) string, key, fallback string) string {
+	if v := getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func connect(cfg *config) (*rtapi.Rtorrent, error) {
+	var opts []rtapi.Option
+	if cfg.network != "auto" {
+		opts = append(opts, rtapi.WithNetwork(cfg.network))
+	}
+	if cfg.record != "" {
+		opts = append(opts, rtapi.WithTransport(recorder(cfg)))
+	}
+	return rtapi.NewRtorrent(cfg.addr, opts...)
+}
+
+// recorder returns a transport saving the traffic to cfg.record.
+func recorder(cfg *config) *rtapitest.Recorder {
+	network := cfg.network
+	if network == "auto" {
+		network = "tcp"
+		if _, err := os.Stat(cfg.addr); err == nil {
+			network = "unix"
+		}
+	}
+
+	var t rtapi.Transport = &rtapi.SCGITransport{Network: network, Address: cfg.addr}
+	if strings.HasPrefix(cfg.addr, "http://") || strings.HasPrefix(cfg.addr, "https://") {
+		t = &rtapi.HTTPTransport{URL: cfg.addr}
+	}
+
+	rec := &rtapitest.Recorder{
+		Transport:   t,
+		Dir:         cfg.record,
+		ScrubHashes: true,
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "/" {
+		rec.ScrubPaths = map[string]string{home: "/home/user"}
+	}
+	return rec
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, usageHeader)
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+
+	fmt.Fprint(w, `
+Flags:
+  -addr string     rTorrent scgi address, host:port or /path/to/socket, or an http(s) URL ($RTCTL_ADDR, default "localhost:5000")
+  -network string  network to reach rTorrent: auto, tcp or unix ($RTCTL_NETWORK, default "auto")
+  -o string        output format: table, json or csv ($RTCTL_OUTPUT, default "table")
+  -record dir      record the traffic with rTorrent to golden files in dir
+`)
+}
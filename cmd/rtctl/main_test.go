@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pyed/rtapi/rtapitest"
+)
+
+func TestParseConfig(t *testing.T) {
+	env := map[string]string{
+		"RTCTL_ADDR":   "/tmp/rtorrent.sock",
+		"RTCTL_OUTPUT": "json",
+	}
+	getenv := func(key string) string { return env[key] }
+
+	cfg, args, err := parseConfig([]string{"-o", "csv", "list", "-sort", "name"}, getenv, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.addr != "/tmp/rtorrent.sock" {
+		t.Errorf("Expected addr from the environment, got: %q", cfg.addr)
+	}
+	if cfg.network != "auto" {
+		t.Errorf("Expected default network auto, got: %q", cfg.network)
+	}
+	if cfg.output != "csv" {
+		t.Errorf("Expected -o to override RTCTL_OUTPUT, got: %q", cfg.output)
+	}
+	if len(args) != 3 || args[0] != "list" {
+		t.Errorf("Expected remaining args [list -sort name], got: %v", args)
+	}
+}
+
+func TestParseConfigUnknownNetwork(t *testing.T) {
+	getenv := func(string) string { return "" }
+
+	if _, _, err := parseConfig([]string{"-network", "udp", "list"}, getenv, io.Discard); err == nil {
+		t.Error("Expected an error for an unknown network")
+	}
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	if code := run([]string{"frobnicate"}, io.Discard, io.Discard); code != 2 {
+		t.Errorf("Expected exit code 2, got: %d", code)
+	}
+}
+
+func TestRunRecord(t *testing.T) {
+	srv := rtapitest.NewServer()
+	defer srv.Close()
+	srv.AddTorrent(&rtapitest.Torrent{
+		Hash:     "02CA77A6A047FD37F04337437D18F82E61861084",
+		Name:     "archlinux.iso",
+		Size:     1 << 20,
+		Trackers: []rtapitest.Tracker{{URL: "udp://tracker.archlinux.org:6969"}},
+	})
+
+	dir := t.TempDir()
+	out := new(bytes.Buffer)
+	if code := run([]string{"-addr", srv.Addr, "-record", dir, "-o", "json", "list"}, out, io.Discard); code != 0 {
+		t.Fatalf("Expected exit code 0, got: %d", code)
+	}
+	if !strings.Contains(out.String(), "02CA77A6A047FD37F04337437D18F82E61861084") {
+		t.Errorf("Expected the real hash in the output, got: %s", out)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.response"))
+	if len(files) != 3 {
+		t.Errorf("Expected 3 recorded responses, got: %v", files)
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+// printer writes command results in one of the supported formats.
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	switch format {
+	case "table", "json", "csv":
+		return &printer{w: w, format: format}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// torrentView is the JSON shape of a torrent, Tracker is flattened to a string.
+type torrentView struct {
+	Name      string  `json:"name"`
+	Hash      string  `json:"hash"`
+	DownRate  uint64  `json:"down_rate"`
+	UpRate    uint64  `json:"up_rate"`
+	Size      uint64  `json:"size"`
+	Completed uint64  `json:"completed"`
+	Percent   string  `json:"percent"`
+	ETA       uint64  `json:"eta"`
+	Ratio     float64 `json:"ratio"`
+	Age       uint64  `json:"age"`
+	UpTotal   uint64  `json:"up_total"`
+	DownTotal uint64  `json:"down_total"`
+	State     string  `json:"state"`
+	Message   string  `json:"message"`
+	Tracker   string  `json:"tracker"`
+	Path      string  `json:"path"`
+	Label     string  `json:"label"`
+
+	Extended *extendedView `json:"extended,omitempty"`
+}
+
+// extendedView is the JSON shape of rtapi.Extended.
+type extendedView struct {
+	Seeders       uint64    `json:"seeders"`
+	Leechers      uint64    `json:"leechers"`
+	SeedersTotal  uint64    `json:"seeders_total"`
+	LeechersTotal uint64    `json:"leechers_total"`
+	Priority      int64     `json:"priority"`
+	Private       bool      `json:"private"`
+	MultiFile     bool      `json:"multi_file"`
+	Directory     string    `json:"directory"`
+	Left          uint64    `json:"left"`
+	Done          uint64    `json:"done"`
+	Skipped       uint64    `json:"skipped"`
+	Throttle      string    `json:"throttle"`
+	Custom        [5]string `json:"custom"`
+}
+
+func newTorrentView(t *rtapi.Torrent) torrentView {
+	v := torrentView{
+		Name:      t.Name,
+		Hash:      t.Hash,
+		DownRate:  t.DownRate,
+		UpRate:    t.UpRate,
+		Size:      t.Size,
+		Completed: t.Completed,
+		Percent:   t.Percent,
+		ETA:       t.ETA,
+		Ratio:     t.Ratio,
+		Age:       t.Age,
+		UpTotal:   t.UpTotal,
+		DownTotal: t.DownTotal,
+		State:     t.State.String(),
+		Message:   t.Message,
+		Path:      t.Path,
+		Label:     t.Label,
+	}
+	if t.Tracker != nil {
+		v.Tracker = t.Tracker.String()
+	}
+	if ext := t.Extended; ext != nil {
+		e := extendedView(*ext)
+		v.Extended = &e
+	}
+	return v
+}
+
+var torrentHeader = []string{"HASH", "NAME", "STATE", "SIZE", "DONE", "DOWN", "UP", "RATIO", "LABEL"}
+
+func (p *printer) torrents(ts rtapi.Torrents) error {
+	views := make([]torrentView, len(ts))
+	rows := make([][]string, len(ts))
+	for i, t := range ts {
+		views[i] = newTorrentView(t)
+		rows[i] = []string{
+			t.Hash,
+			t.Name,
+			t.State.String(),
+			p.bytes(t.Size),
+			t.Percent,
+			p.rate(t.DownRate),
+			p.rate(t.UpRate),
+			strconv.FormatFloat(t.Ratio, 'f', 2, 64),
+			t.Label,
+		}
+	}
+	return p.table(views, torrentHeader, rows)
+}
+
+func (p *printer) torrent(t *rtapi.Torrent) error {
+	v := newTorrentView(t)
+	keys := []string{"Name", "Hash", "State", "Size", "Completed", "Percent", "ETA", "DownRate",
+		"UpRate", "Ratio", "UpTotal", "DownTotal", "Age", "Finished", "Created", "Label", "Tracker", "Path", "Message"}
+	values := []string{
+		v.Name,
+		v.Hash,
+		v.State,
+		p.bytes(v.Size),
+		p.bytes(v.Completed),
+		v.Percent,
+		t.TimeLeft.String(),
+		p.rate(v.DownRate),
+		p.rate(v.UpRate),
+		strconv.FormatFloat(v.Ratio, 'f', 2, 64),
+		p.bytes(v.UpTotal),
+		p.bytes(v.DownTotal),
+		strconv.FormatUint(v.Age, 10),
+		p.date(t.FinishedAt),
+		p.date(t.CreatedAt),
+		v.Label,
+		v.Tracker,
+		v.Path,
+		v.Message,
+	}
+	if ext := t.Extended; ext != nil {
+		keys = append(keys, "Seeders", "Leechers", "Priority", "Private", "MultiFile", "Directory", "Left", "Throttle")
+		values = append(values,
+			fmt.Sprintf("%d (%d)", ext.Seeders, ext.SeedersTotal),
+			fmt.Sprintf("%d (%d)", ext.Leechers, ext.LeechersTotal),
+			priorityName(ext.Priority),
+			strconv.FormatBool(ext.Private),
+			strconv.FormatBool(ext.MultiFile),
+			ext.Directory,
+			p.bytes(ext.Left),
+			ext.Throttle,
+		)
+	}
+	return p.record(v, keys, values)
+}
+
+// priorityName names the d.priority values.
+func priorityName(priority int64) string {
+	switch priority {
+	case 0:
+		return "off"
+	case 1:
+		return "low"
+	case 2:
+		return "normal"
+	case 3:
+		return "high"
+	}
+	return strconv.FormatInt(priority, 10)
+}
+
+func (p *printer) speeds(down, up uint64) error {
+	v := struct {
+		Down uint64 `json:"down"`
+		Up   uint64 `json:"up"`
+	}{down, up}
+	return p.table(v, []string{"DOWN", "UP"}, [][]string{{p.rate(down), p.rate(up)}})
+}
+
+// value prints a value returned by rtapi's Call, scalars are printed as is
+// and anything else as indented JSON, in csv a list of lists becomes rows.
+func (p *printer) value(v interface{}) error {
+	switch p.format {
+	case "json":
+		return p.json(v)
+	case "csv":
+		cw := csv.NewWriter(p.w)
+		for _, row := range valueRows(v) {
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	switch v.(type) {
+	case []interface{}, map[string]interface{}:
+		return p.json(v)
+	}
+	_, err := fmt.Fprintln(p.w, v)
+	return err
+}
+
+func valueRows(v interface{}) [][]string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return [][]string{{fmt.Sprint(v)}}
+	}
+
+	rows := make([][]string, 0, len(list))
+	for _, item := range list {
+		cells, ok := item.([]interface{})
+		if !ok {
+			rows = append(rows, []string{fmt.Sprint(item)})
+			continue
+		}
+		row := make([]string, len(cells))
+		for i := range cells {
+			row[i] = fmt.Sprint(cells[i])
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// table prints v as JSON, or header and rows as an aligned table or CSV.
+func (p *printer) table(v interface{}, header []string, rows [][]string) error {
+	switch p.format {
+	case "json":
+		return p.json(v)
+	case "csv":
+		cw := csv.NewWriter(p.w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	writeTabbed(tw, header)
+	for _, row := range rows {
+		writeTabbed(tw, row)
+	}
+	return tw.Flush()
+}
+
+// record prints a single item, as "key: value" lines in table format.
+func (p *printer) record(v interface{}, keys, values []string) error {
+	switch p.format {
+	case "json":
+		return p.json(v)
+	case "csv":
+		return p.table(v, keys, [][]string{values})
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 1, ' ', 0)
+	for i := range keys {
+		fmt.Fprintf(tw, "%s:\t%s\n", keys[i], values[i])
+	}
+	return tw.Flush()
+}
+
+func (p *printer) json(v interface{}) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeTabbed(w io.Writer, cells []string) {
+	for i, cell := range cells {
+		if i > 0 {
+			io.WriteString(w, "\t")
+		}
+		io.WriteString(w, cell)
+	}
+	io.WriteString(w, "\n")
+}
+
+// bytes formats n for humans in table format, and as a plain number otherwise.
+func (p *printer) bytes(n uint64) string {
+	if p.format != "table" {
+		return strconv.FormatUint(n, 10)
+	}
+	return humanBytes(n)
+}
+
+// rate is like bytes, with a "/s" suffix in table format.
+func (p *printer) rate(n uint64) string {
+	if p.format != "table" {
+		return strconv.FormatUint(n, 10)
+	}
+	return humanBytes(n) + "/s"
+}
+
+// date formats t for humans in table format, and as RFC 3339 otherwise.
+// Unknown dates are empty.
+func (p *printer) date(t time.Time) string {
+	switch {
+	case t.IsZero():
+		return ""
+	case p.format != "table":
+		return t.Format(time.RFC3339)
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// humanBytes formats n using binary prefixes, e.g. 1536 -> "1.5 KiB".
+func humanBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
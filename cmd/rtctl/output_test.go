@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pyed/rtapi"
+)
+
+func TestHumanBytes(t *testing.T) {
+	testCases := []struct {
+		n        uint64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{996 * 262144, "249.0 MiB"},
+		{5 << 40, "5.0 TiB"},
+	}
+
+	for i, test := range testCases {
+		if got := humanBytes(test.n); got != test.expected {
+			t.Errorf("Case %d: Expected %q, got: %q", i, test.expected, got)
+		}
+	}
+}
+
+func TestPrinterFormats(t *testing.T) {
+	tracker, _ := url.Parse("udp://tracker.archlinux.org:6969")
+	ts := rtapi.Torrents{
+		&rtapi.Torrent{
+			Name:    "archlinux-2017.04.01-x86_64.iso",
+			Hash:    "02CA77A6A047FD37F04337437D18F82E61861084",
+			Size:    956 * 524288,
+			Percent: "12.0%",
+			State:   rtapi.Leeching,
+			Tracker: tracker,
+		},
+	}
+
+	testCases := []struct {
+		format   string
+		expected []string
+	}{
+		{"table", []string{"HASH", "archlinux-2017.04.01-x86_64.iso", "478.0 MiB", "12.0%"}},
+		{"csv", []string{"HASH,NAME,STATE", "02CA77A6A047FD37F04337437D18F82E61861084,archlinux", ",501219328,"}},
+		{"json", []string{`"hash": "02CA77A6A047FD37F04337437D18F82E61861084"`, `"tracker": "udp://tracker.archlinux.org:6969"`}},
+	}
+
+	for _, test := range testCases {
+		buf := new(bytes.Buffer)
+		p, err := newPrinter(buf, test.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.torrents(ts); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, s := range test.expected {
+			if !strings.Contains(buf.String(), s) {
+				t.Errorf("%s: Expected output to contain %q, got:\n%s", test.format, s, buf)
+			}
+		}
+	}
+
+	if _, err := newPrinter(new(bytes.Buffer), "yaml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestPrinterValue(t *testing.T) {
+	buf := new(bytes.Buffer)
+	p, _ := newPrinter(buf, "csv")
+
+	v := []interface{}{
+		[]interface{}{"debian", int64(1)},
+		[]interface{}{"ubuntu", int64(0)},
+	}
+	if err := p.value(v); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "debian,1\nubuntu,0\n"; buf.String() != expected {
+		t.Errorf("Expected %q, got: %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import "errors"
+
+var errNoTerminal = errors.New("terminal mode is not supported on this platform")
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errNoTerminal
+}
+
+func termSize(fd int) (width, height int, err error) {
+	return 0, 0, errNoTerminal
+}
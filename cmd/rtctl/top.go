@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+func runTop(rt *rtapi.Rtorrent, p *printer, args []string) error {
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	interval := fs.Duration("interval", 2*time.Second, "refresh interval")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	restore, err := makeRaw(in)
+	if err != nil {
+		return fmt.Errorf("top needs a terminal: %w", err)
+	}
+	defer restore()
+
+	w := bufio.NewWriter(os.Stdout)
+	// alternate screen, hidden cursor.
+	w.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		w.WriteString("\x1b[?25h\x1b[?1049l")
+		w.Flush()
+	}()
+
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+
+	snapshots := make(chan snapshot, 1)
+	fetching := false
+	fetch := func(hash string) {
+		if fetching {
+			return
+		}
+		fetching = true
+		go func() { snapshots <- takeSnapshot(rt, hash) }()
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	d := new(dashboard)
+	fetch("")
+	for {
+		width, height, err := termSize(out)
+		if err != nil {
+			width, height = 80, 24
+		}
+		draw(w, d.render(width, height))
+
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			switch act := d.handleKey(key); act {
+			case actNone:
+			case actQuit:
+				return nil
+			case actRefresh:
+				fetch(d.detailHash())
+			default:
+				if err := perform(rt, act, d.selectedTorrent()); err != nil {
+					d.status = "error: " + err.Error()
+				}
+				fetch(d.detailHash())
+			}
+		case s := <-snapshots:
+			fetching = false
+			d.update(s)
+		case <-ticker.C:
+			fetch(d.detailHash())
+		}
+	}
+}
+
+// takeSnapshot polls rTorrent, fetching the details of the torrent with the
+// given hash too, unless it's empty.
+func takeSnapshot(rt *rtapi.Rtorrent, hash string) snapshot {
+	var s snapshot
+	if s.torrents, s.err = rt.Torrents(); s.err != nil {
+		return s
+	}
+	tr, err := rt.Transfer(context.Background())
+	if err != nil {
+		s.err = err
+		return s
+	}
+	s.down, s.up = tr.DownRate, tr.UpRate
+
+	if hash == "" {
+		return s
+	}
+
+	t := &rtapi.Torrent{Hash: hash}
+	det := &details{hash: hash}
+	if det.files, s.err = rt.Files(t); s.err != nil {
+		return s
+	}
+	if det.trackers, s.err = rt.Trackers(t); s.err != nil {
+		return s
+	}
+	if det.peers, s.err = rt.Peers(t); s.err != nil {
+		return s
+	}
+	s.details = det
+	return s
+}
+
+// perform runs act on the torrent t.
+func perform(rt *rtapi.Rtorrent, act action, t *rtapi.Torrent) error {
+	if t == nil {
+		return nil
+	}
+
+	switch act {
+	case actStart:
+		return rt.Start(t)
+	case actStop:
+		return rt.Stop(t)
+	case actPause:
+		return rt.Pause(t)
+	case actResume:
+		return rt.Resume(t)
+	case actCheck:
+		return rt.Check(t)
+	case actDelete:
+		return rt.Delete(false, t)
+	case actDeleteData:
+		return rt.Delete(true, t)
+	}
+	return nil
+}
+
+// draw repaints the screen with lines.
+func draw(w *bufio.Writer, lines []string) {
+	w.WriteString("\x1b[H")
+	w.WriteString(strings.Join(lines, "\x1b[K\r\n"))
+	w.WriteString("\x1b[K\x1b[J")
+	w.Flush()
+}
+
+// readKeys sends the keys read from r to keys, until r fails.
+func readKeys(r io.Reader, keys chan<- string) {
+	defer close(keys)
+
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		for _, key := range parseKeys(buf[:n]) {
+			keys <- key
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package rtapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Codec is the encoding of the requests sent to rTorrent. Answers are
+// decoded in whichever encoding rTorrent used.
+type Codec int
+
+const (
+	// CodecXMLRPC is understood by every version of rTorrent.
+	CodecXMLRPC Codec = iota
+	// CodecJSONRPC is JSON-RPC 2.0, which forks like jesec/rtorrent accept
+	// on the same socket and parse a lot faster.
+	CodecJSONRPC
+	// CodecAuto probes rTorrent on connect, and picks CodecJSONRPC if it
+	// answers a JSON-RPC request.
+	CodecAuto
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecXMLRPC:
+		return "xml-rpc"
+	case CodecJSONRPC:
+		return "json-rpc"
+	case CodecAuto:
+		return "auto"
+	}
+	return "unknown"
+}
+
+// WithCodec picks the encoding of the requests, CodecXMLRPC by default.
+// Requests carrying binary data, like DownloadRaw, are always sent as
+// XML-RPC since JSON has no type for it.
+func WithCodec(c Codec) Option {
+	return func(r *Rtorrent) {
+		r.codec = c
+	}
+}
+
+// Codec returns the encoding requests are sent with, CodecAuto is resolved
+// by NewRtorrent.
+func (r *Rtorrent) Codec() Codec {
+	return r.codec
+}
+
+// encodeCall encodes call as the codec in use asks.
+func (r *Rtorrent) encodeCall(call xmlrpcMethodCall) ([]byte, error) {
+	if r.codec == CodecJSONRPC && !call.binary() {
+		return marshalJSONCall(call)
+	}
+	req, err := marshalMethodCall(call)
+	return []byte(req), err
+}
+
+// detectCodec sends a JSON-RPC request, rTorrent answers it with JSON if it
+// understands it and with an XML-RPC fault otherwise.
+func (r *Rtorrent) detectCodec(ctx context.Context) (Codec, error) {
+	codec := r.codec
+	r.codec = CodecJSONRPC
+	defer func() { r.codec = codec }()
+
+	var jsonrpc bool
+	err := r.do(ctx, buildCallRequest("system.client_version"), true, func(body io.Reader) error {
+		br := bufio.NewReader(body)
+		b, err := skipToPayload(br)
+		if err != nil {
+			return err
+		}
+		if b == '{' {
+			_, err = decodeJSONResponse(br)
+			jsonrpc = err == nil
+		}
+		return nil
+	})
+	if err != nil {
+		return CodecXMLRPC, err
+	}
+	if jsonrpc {
+		return CodecJSONRPC, nil
+	}
+	return CodecXMLRPC, nil
+}
+
+// skipToPayload skips the SCGI or HTTP headers rTorrent may send before the
+// answer, and returns the first byte of it without consuming it.
+func skipToPayload(br *bufio.Reader) (byte, error) {
+	for n := 0; ; n++ {
+		b, err := br.ReadByte()
+		if err == io.EOF && n == 0 {
+			return 0, errEmptyResponse
+		}
+		if err == io.EOF {
+			return 0, &ProtocolError{Msg: "xml response not found"}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("rtapi: read response: %w", err)
+		}
+		if b == '<' || b == '{' {
+			br.UnreadByte()
+			return b, nil
+		}
+	}
+}
+
+// binary reports whether call carries base64 values.
+func (call xmlrpcMethodCall) binary() bool {
+	for _, p := range call.Params {
+		if p.Value.binary() {
+			return true
+		}
+	}
+	return false
+}
+
+func (v xmlrpcValue) binary() bool {
+	switch {
+	case v.Base64 != nil:
+		return true
+	case v.Array != nil:
+		for _, item := range v.Array.Values {
+			if item.binary() {
+				return true
+			}
+		}
+	case v.Struct != nil:
+		for _, m := range v.Struct.Members {
+			if m.Value.binary() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type jsonrpcRequest struct {
+	Version string        `json:"jsonrpc"`
+	Method  string        `json:"method"`
+	Params  []xmlrpcValue `json:"params"`
+	ID      int           `json:"id"`
+}
+
+type jsonrpcError struct {
+	Code    int64  `json:"code"`
+	Message string `json:"message"`
+}
+
+func marshalJSONCall(call xmlrpcMethodCall) ([]byte, error) {
+	req := jsonrpcRequest{
+		Version: "2.0",
+		Method:  call.MethodName,
+		Params:  make([]xmlrpcValue, len(call.Params)),
+		ID:      1,
+	}
+	for i, p := range call.Params {
+		req.Params[i] = p.Value
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(req); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// MarshalJSON encodes v as JSON-RPC params are, struct members keep their
+// order.
+func (v xmlrpcValue) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := v.appendJSON(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (v xmlrpcValue) appendJSON(buf *bytes.Buffer) error {
+	switch {
+	case v.String != nil || v.untyped():
+		s, _ := v.stringValue()
+		return appendJSONString(buf, s)
+	case v.I8 != nil, v.I4 != nil, v.Int != nil:
+		n, _ := v.int64Value()
+		buf.WriteString(strconv.FormatInt(n, 10))
+	case v.Double != nil:
+		if math.IsInf(*v.Double, 0) || math.IsNaN(*v.Double) {
+			return fmt.Errorf("rtapi: can't encode %v as json", *v.Double)
+		}
+		buf.WriteString(strconv.FormatFloat(*v.Double, 'g', -1, 64))
+	case v.Boolean != nil:
+		buf.WriteString(strconv.FormatBool(*v.Boolean))
+	case v.DateTime != nil:
+		return appendJSONString(buf, time.Time(*v.DateTime).Format(time.RFC3339))
+	case v.Base64 != nil:
+		return fmt.Errorf("rtapi: can't encode base64 values as json")
+	case v.Nil != nil:
+		buf.WriteString("null")
+	case v.Array != nil:
+		buf.WriteByte('[')
+		for i, item := range v.Array.Values {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := item.appendJSON(buf); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case v.Struct != nil:
+		buf.WriteByte('{')
+		for i, m := range v.Struct.Members {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := appendJSONString(buf, m.Name); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := m.Value.appendJSON(buf); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	}
+	return nil
+}
+
+func appendJSONString(buf *bytes.Buffer, s string) error {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1) // the newline
+	return nil
+}
+
+// decodeJSONValue reads the next value from dec into the matching XML-RPC
+// type, so that answers are read the same way whatever the codec. Integers
+// become i8 and other numbers double, dec must use numbers.
+func decodeJSONValue(dec *json.Decoder) (xmlrpcValue, error) {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return xmlrpcValue{}, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return xmlrpcValue{}, err
+	}
+
+	switch tok := tok.(type) {
+	case string:
+		return newStringValue(tok), nil
+	case json.Number:
+		if n, err := strconv.ParseInt(string(tok), 10, 64); err == nil {
+			return xmlrpcValue{I8: &n}, nil
+		}
+		f, err := tok.Float64()
+		if err != nil {
+			return xmlrpcValue{}, fmt.Errorf("invalid number %s", tok)
+		}
+		return xmlrpcValue{Double: &f}, nil
+	case bool:
+		return xmlrpcValue{Boolean: &tok}, nil
+	case nil:
+		return xmlrpcValue{Nil: &struct{}{}}, nil
+	case json.Delim:
+		switch tok {
+		case '[':
+			values := []xmlrpcValue{}
+			for dec.More() {
+				item, err := decodeJSONValue(dec)
+				if err != nil {
+					return xmlrpcValue{}, err
+				}
+				values = append(values, item)
+			}
+			if _, err := dec.Token(); err != nil {
+				return xmlrpcValue{}, err
+			}
+			return newArrayValue(values...), nil
+		case '{':
+			var members []xmlrpcMember
+			for dec.More() {
+				name, err := jsonKey(dec)
+				if err != nil {
+					return xmlrpcValue{}, err
+				}
+				value, err := decodeJSONValue(dec)
+				if err != nil {
+					return xmlrpcValue{}, err
+				}
+				members = append(members, xmlrpcMember{Name: name, Value: value})
+			}
+			if _, err := dec.Token(); err != nil {
+				return xmlrpcValue{}, err
+			}
+			return newStructValue(members...), nil
+		}
+	}
+	return xmlrpcValue{}, fmt.Errorf("unexpected %v", tok)
+}
+
+func jsonKey(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return "", io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", err
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected %v", tok)
+	}
+	return key, nil
+}
+
+// decodeJSONResponse reads a JSON-RPC response into the shape of an XML-RPC
+// one.
+func decodeJSONResponse(r io.Reader) (*xmlrpcMethodResponse, error) {
+	var resp *xmlrpcMethodResponse
+	err := decodeJSONResult(r, func(dec *json.Decoder) error {
+		v, err := decodeJSONValue(dec)
+		if err != nil {
+			return jsonDecodeError(err)
+		}
+		resp = &xmlrpcMethodResponse{Params: []xmlrpcParam{{Value: v}}}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// decodeJSONArray is decodeArrayResponse for JSON-RPC responses.
+func decodeJSONArray(r io.Reader, fn func(xmlrpcValue) error) error {
+	return decodeJSONResult(r, func(dec *json.Decoder) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return jsonDecodeError(err)
+		}
+		if tok != json.Delim('[') {
+			return &ProtocolError{Msg: "expected array value in response param"}
+		}
+		for dec.More() {
+			v, err := decodeJSONValue(dec)
+			if err != nil {
+				return jsonDecodeError(err)
+			}
+			if err := fn(v); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return jsonDecodeError(err)
+		}
+		return nil
+	})
+}
+
+// decodeJSONResult walks the members of a JSON-RPC response, and hands dec
+// to result once it reaches the result.
+func decodeJSONResult(r io.Reader, result func(dec *json.Decoder) error) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return jsonDecodeError(err)
+	}
+	if tok != json.Delim('{') {
+		return jsonDecodeError(fmt.Errorf("unexpected %v", tok))
+	}
+
+	found := false
+	for dec.More() {
+		key, err := jsonKey(dec)
+		if err != nil {
+			return jsonDecodeError(err)
+		}
+		switch key {
+		case "result":
+			if err := result(dec); err != nil {
+				return err
+			}
+			found = true
+		case "error":
+			var e jsonrpcError
+			if err := dec.Decode(&e); err != nil {
+				return jsonDecodeError(err)
+			}
+			return &Fault{Code: int(e.Code), Message: e.Message}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return jsonDecodeError(err)
+			}
+		}
+	}
+	if !found {
+		return &ProtocolError{Msg: "jsonrpc response missing result"}
+	}
+	return nil
+}
+
+// jsonDecodeError wraps err, a truncated answer is io.ErrUnexpectedEOF like
+// with XML-RPC so that it's retried.
+func jsonDecodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	if err == io.EOF || errors.As(err, &syntaxErr) && syntaxErr.Error() == "unexpected end of JSON input" {
+		err = io.ErrUnexpectedEOF
+	}
+	return &ProtocolError{Msg: "decode jsonrpc response", Err: err}
+}
@@ -0,0 +1,204 @@
+package rtapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pyed/rtapi/rtapitest"
+)
+
+func newJSONServer(t *testing.T) *rtapitest.Server {
+	t.Helper()
+
+	fake := rtapitest.NewServer()
+	t.Cleanup(fake.Close)
+	fake.SetJSONRPC(true)
+	fake.AddTorrent(&rtapitest.Torrent{
+		Hash:      "8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648",
+		Name:      "ubuntu.iso",
+		Directory: "/downloads",
+		Size:      3 << 20,
+		Completed: 1 << 20,
+		DownRate:  1024,
+		Open:      true,
+		Active:    true,
+		Started:   true,
+		Custom1:   "Linux, BSD",
+		Files:     []rtapitest.File{{Path: "ubuntu.iso", Size: 3 << 20, SizeChunks: 12, CompletedChunks: 4, Priority: 1}},
+		Trackers:  []rtapitest.Tracker{{URL: "http://torrent.ubuntu.com:6969/announce", Enabled: true, Seeders: 12}},
+		Peers:     []rtapitest.Peer{{Address: "10.0.0.2", Port: 51413, Client: "Transmission 4.0", UpRate: 512, Percent: 40}},
+	})
+	return fake
+}
+
+func TestJSONRPC(t *testing.T) {
+	fake := newJSONServer(t)
+
+	xmlrpc, err := NewRtorrent(fake.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonrpc, err := NewRtorrent(fake.Addr, WithCodec(CodecJSONRPC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jsonrpc.Version != "0.9.8/0.13.8" {
+		t.Errorf("Expected version 0.9.8/0.13.8, got: %s", jsonrpc.Version)
+	}
+
+	expected, err := xmlrpc.Torrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	torrents, err := jsonrpc.Torrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(torrents, expected) {
+		t.Errorf("Expected the torrents to match XML-RPC\nexpected: %+v\ngot: %+v", expected[0], torrents[0])
+	}
+
+	for _, get := range []func(r *Rtorrent) (interface{}, error){
+		func(r *Rtorrent) (interface{}, error) { return r.Stats() },
+		func(r *Rtorrent) (interface{}, error) { return r.Transfer(context.Background()) },
+		func(r *Rtorrent) (interface{}, error) { return r.Files(expected[0]) },
+		func(r *Rtorrent) (interface{}, error) { return r.Trackers(expected[0]) },
+		func(r *Rtorrent) (interface{}, error) { return r.Peers(expected[0]) },
+		func(r *Rtorrent) (interface{}, error) { return r.Call("d.custom1", expected[0].Hash) },
+		func(r *Rtorrent) (interface{}, error) { down, up := r.Speeds(); return [2]uint64{down, up}, nil },
+	} {
+		want, err := get(xmlrpc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := get(jsonrpc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %+v, got: %+v", want, got)
+		}
+	}
+
+	// JSON has no type for the .torrent data, it's sent as XML-RPC.
+	data := []byte("d8:announce0:4:infod6:lengthi1e4:name8:file.iso12:piece lengthi1e6:pieces0:ee")
+	if err := jsonrpc.DownloadRaw(data); err != nil {
+		t.Errorf("Expected DownloadRaw to work, got: %v", err)
+	}
+	if err := jsonrpc.Download("magnet:?xt=urn:btih:02ca77a6a047fd37f04337437d18f82e61861084"); err != nil {
+		t.Errorf("Expected Download to work, got: %v", err)
+	}
+	if n := len(fake.Torrents()); n != 3 {
+		t.Errorf("Expected 3 torrents, got: %d", n)
+	}
+
+	fake.SetFault("d.name", -501, "Could not find info-hash.")
+	var fault *Fault
+	if _, err := jsonrpc.Call("d.name", "0000"); !errors.As(err, &fault) || fault.Code != -501 || fault.Message != "Could not find info-hash." {
+		t.Errorf("Expected the JSON-RPC error as a Fault, got: %v", err)
+	}
+}
+
+func TestCodecAuto(t *testing.T) {
+	fake := newJSONServer(t)
+
+	rt, err := NewRtorrent(fake.Addr, WithCodec(CodecAuto))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.Codec() != CodecJSONRPC {
+		t.Errorf("Expected %s, got: %s", CodecJSONRPC, rt.Codec())
+	}
+
+	fake.SetJSONRPC(false)
+	rt, err = NewRtorrent(fake.Addr, WithCodec(CodecAuto))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.Codec() != CodecXMLRPC {
+		t.Errorf("Expected %s with stock rTorrent, got: %s", CodecXMLRPC, rt.Codec())
+	}
+	if _, err := rt.Torrents(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMarshalJSONCall(t *testing.T) {
+	testCases := []struct {
+		req      xmlrpcMethodCall
+		expected string
+	}{
+		{
+			buildVersionRequest(),
+			`{"jsonrpc":"2.0","method":"system.multicall","params":[[` +
+				`{"methodName":"system.client_version","params":[""]},` +
+				`{"methodName":"system.library_version","params":[""]}]],"id":1}`,
+		},
+		{
+			buildCallRequest("d.custom1.set", "8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648", `"a" <b>`),
+			`{"jsonrpc":"2.0","method":"d.custom1.set","params":["8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648","\"a\" <b>"],"id":1}`,
+		},
+	}
+
+	for i, test := range testCases {
+		data, err := marshalJSONCall(test.req)
+		if err != nil || string(data) != test.expected {
+			t.Errorf("Case %d: Expected:\n%s\ngot:\n%s (%v)", i, test.expected, data, err)
+		}
+	}
+
+	if _, err := marshalJSONCall(buildDownloadRawRequest([]byte("data"))); err == nil {
+		t.Error("Expected base64 values not to be encoded")
+	}
+}
+
+func TestDecodeJSONResponse(t *testing.T) {
+	const headers = "Status: 200 OK\r\nContent-Type: application/json\r\n\r\n"
+
+	resp, err := decodeMethodResponse(strings.NewReader(headers +
+		`{"jsonrpc":"2.0","id":1,"result":[["ubuntu.iso",1024,0.5,true,null,{"a":"b"}]]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{[]interface{}{"ubuntu.iso", int64(1024), 0.5, true, nil, map[string]interface{}{"a": "b"}}}
+	if got := resp.Params[0].Value.native(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got: %v", expected, got)
+	}
+
+	var names []string
+	err = decodeArrayResponse(strings.NewReader(headers+`{"id":1,"result":["a","b"],"jsonrpc":"2.0"}`), func(v xmlrpcValue) error {
+		s, err := v.stringValue()
+		names = append(names, s)
+		return err
+	})
+	if err != nil || !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("Expected [a b], got: %v, %v", names, err)
+	}
+
+	testCases := []struct {
+		payload string
+		err     string
+	}{
+		{`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`, "rtapi: fault -32601: method not found"},
+		{`{"jsonrpc":"2.0","id":1}`, "rtapi: jsonrpc response missing result"},
+		{`{"jsonrpc":"2.0","id":1,"result":"a"}`, "rtapi: expected array value in response param"},
+		{`{"jsonrpc":"2.0","id":1,"result":[1,`, "rtapi: decode jsonrpc response: unexpected EOF"},
+		{`{"jsonrpc":"2.0","id":1,"result":[}`, "rtapi: decode jsonrpc response: invalid character '}' looking for beginning of value"},
+	}
+
+	for i, test := range testCases {
+		err := decodeArrayResponse(strings.NewReader(headers+test.payload), func(xmlrpcValue) error { return nil })
+		if err == nil || err.Error() != test.err {
+			t.Errorf("Case %d: Expected %q, got: %v", i, test.err, err)
+		}
+	}
+
+	// a truncated answer is retried like with XML-RPC.
+	if _, err := decodeMethodResponse(strings.NewReader(`{"result":[`)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got: %v", err)
+	}
+}
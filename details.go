@@ -0,0 +1,387 @@
+package rtapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// File represents a single file within a torrent.
+type File struct {
+	Path            string // relative to the torrent's base path
+	Size            uint64
+	SizeChunks      uint64
+	CompletedChunks uint64
+	Priority        int64 // 0 off, 1 normal, 2 high
+}
+
+// Tracker represents a single tracker of a torrent.
+type Tracker struct {
+	URL      string
+	Enabled  bool
+	Seeders  uint64 // as reported by the last scrape
+	Leechers uint64 // as reported by the last scrape
+}
+
+// Peer represents a single connected peer of a torrent.
+type Peer struct {
+	Address  string
+	Port     uint64
+	Client   string
+	DownRate uint64
+	UpRate   uint64
+	Percent  uint64
+}
+
+// Extended holds the fields of a torrent which Torrents and GetTorrent leave
+// out to keep listing cheap, it's filled by Extend.
+type Extended struct {
+	Seeders       uint64 // connected
+	Leechers      uint64 // connected
+	SeedersTotal  uint64 // in the swarm, as scraped by the best tracker
+	LeechersTotal uint64 // in the swarm, as scraped by the best tracker
+	Priority      int64  // 0 off, 1 low, 2 normal, 3 high
+	Private       bool
+	MultiFile     bool
+	Directory     string    // the torrent's directory, Path is its base path
+	Left          uint64    // bytes left to download
+	Done          uint64    // bytes downloaded, unlike Completed including the chunks in progress
+	Skipped       uint64    // bytes received but thrown away
+	Throttle      string    // throttle group, empty for the global one
+	Custom        [5]string // d.custom1 to d.custom5, Custom[0] is the Label
+}
+
+// extendedFields are the getters Extend reads, in order. The scrapes of all
+// the trackers follow them.
+var extendedFields = []string{
+	"d.peers_complete",
+	"d.peers_accounted",
+	"d.priority",
+	"d.is_private",
+	"d.is_multi_file",
+	"d.directory",
+	"d.left_bytes",
+	"d.skip.total",
+	"d.throttle_name",
+	"d.custom1",
+	"d.custom2",
+	"d.custom3",
+	"d.custom4",
+	"d.custom5",
+	"d.bytes_done",
+}
+
+// buildExtendRequest asks for the extended fields of the given torrents in
+// one system.multicall.
+func buildExtendRequest(hashes ...string) xmlrpcMethodCall {
+	calls := make([]xmlrpcValue, 0, len(hashes)*(len(extendedFields)+1))
+	for _, hash := range hashes {
+		for _, field := range extendedFields {
+			calls = append(calls, newMethodCall(field, hash))
+		}
+		calls = append(calls, newMethodCall("t.multicall", hash, "", "t.scrape_complete=", "t.scrape_incomplete="))
+	}
+
+	request := xmlrpcMethodCall{
+		MethodName: "system.multicall",
+		Params: []xmlrpcParam{
+			{
+				Value: newArrayValue(calls...),
+			},
+		},
+	}
+
+	return request
+}
+
+// buildItemsMulticallRequest builds a f./t./p.multicall, which calls the
+// fields on every file/tracker/peer of the torrent with the given hash.
+func buildItemsMulticallRequest(method, hash string, fields ...string) xmlrpcMethodCall {
+	params := make([]xmlrpcParam, 0, len(fields)+2)
+	params = append(params, newStringParam(hash), newStringParam(""))
+	for _, field := range fields {
+		params = append(params, newStringParam(field))
+	}
+
+	request := xmlrpcMethodCall{
+		MethodName: method,
+		Params:     params,
+	}
+
+	return request
+}
+
+func buildFilesRequest(hash string) xmlrpcMethodCall {
+	return buildItemsMulticallRequest("f.multicall", hash,
+		"f.path=",
+		"f.size_bytes=",
+		"f.size_chunks=",
+		"f.completed_chunks=",
+		"f.priority=",
+	)
+}
+
+func buildTrackersRequest(hash string) xmlrpcMethodCall {
+	return buildItemsMulticallRequest("t.multicall", hash,
+		"t.url=",
+		"t.is_enabled=",
+		"t.scrape_complete=",
+		"t.scrape_incomplete=",
+	)
+}
+
+func buildPeersRequest(hash string) xmlrpcMethodCall {
+	return buildItemsMulticallRequest("p.multicall", hash,
+		"p.address=",
+		"p.port=",
+		"p.client_version=",
+		"p.down_rate=",
+		"p.up_rate=",
+		"p.completed_percent=",
+	)
+}
+
+// itemRows executes req and returns the fields of every returned row,
+// checking that each row has at least n fields.
+func (r *Rtorrent) itemRows(req xmlrpcMethodCall, n int) ([][]xmlrpcValue, error) {
+	resp, err := r.execute(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := resp.arrayParam()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]xmlrpcValue, 0, len(values))
+	for _, value := range values {
+		fields, err := value.arrayValues()
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) < n {
+			return nil, &ProtocolError{Msg: fmt.Sprintf("expected %d fields, got %d", n, len(fields))}
+		}
+		rows = append(rows, fields)
+	}
+
+	return rows, nil
+}
+
+// Files returns the files of the given torrent.
+func (r *Rtorrent) Files(t *Torrent) ([]*File, error) {
+	req := buildFilesRequest(t.Hash)
+
+	rows, err := r.itemRows(req, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*File, 0, len(rows))
+	for i, fields := range rows {
+		f := new(File)
+		if f.Path, err = fields[0].stringValue(); err != nil {
+			return nil, &DecodeError{Field: "file path", Index: i, Err: err}
+		}
+		if f.Size, err = fields[1].uint64Value(); err != nil {
+			return nil, &DecodeError{Field: "file size", Index: i, Err: err}
+		}
+		if f.SizeChunks, err = fields[2].uint64Value(); err != nil {
+			return nil, &DecodeError{Field: "file size chunks", Index: i, Err: err}
+		}
+		if f.CompletedChunks, err = fields[3].uint64Value(); err != nil {
+			return nil, &DecodeError{Field: "file completed chunks", Index: i, Err: err}
+		}
+		if f.Priority, err = fields[4].int64Value(); err != nil {
+			return nil, &DecodeError{Field: "file priority", Index: i, Err: err}
+		}
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+// Trackers returns the trackers of the given torrent.
+func (r *Rtorrent) Trackers(t *Torrent) ([]*Tracker, error) {
+	req := buildTrackersRequest(t.Hash)
+
+	rows, err := r.itemRows(req, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	trackers := make([]*Tracker, 0, len(rows))
+	for i, fields := range rows {
+		tr := new(Tracker)
+		if tr.URL, err = fields[0].stringValue(); err != nil {
+			return nil, &DecodeError{Field: "tracker url", Index: i, Err: err}
+		}
+		enabled, err := fields[1].uint64Value()
+		if err != nil {
+			return nil, &DecodeError{Field: "tracker enabled flag", Index: i, Err: err}
+		}
+		tr.Enabled = enabled == 1
+		if tr.Seeders, err = fields[2].uint64Value(); err != nil {
+			return nil, &DecodeError{Field: "tracker seeders", Index: i, Err: err}
+		}
+		if tr.Leechers, err = fields[3].uint64Value(); err != nil {
+			return nil, &DecodeError{Field: "tracker leechers", Index: i, Err: err}
+		}
+		trackers = append(trackers, tr)
+	}
+
+	return trackers, nil
+}
+
+// Peers returns the connected peers of the given torrent.
+func (r *Rtorrent) Peers(t *Torrent) ([]*Peer, error) {
+	req := buildPeersRequest(t.Hash)
+
+	rows, err := r.itemRows(req, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make([]*Peer, 0, len(rows))
+	for i, fields := range rows {
+		p := new(Peer)
+		if p.Address, err = fields[0].stringValue(); err != nil {
+			return nil, &DecodeError{Field: "peer address", Index: i, Err: err}
+		}
+		if p.Port, err = fields[1].uint64Value(); err != nil {
+			return nil, &DecodeError{Field: "peer port", Index: i, Err: err}
+		}
+		if p.Client, err = fields[2].stringValue(); err != nil {
+			return nil, &DecodeError{Field: "peer client", Index: i, Err: err}
+		}
+		if p.DownRate, err = fields[3].uint64Value(); err != nil {
+			return nil, &DecodeError{Field: "peer down rate", Index: i, Err: err}
+		}
+		if p.UpRate, err = fields[4].uint64Value(); err != nil {
+			return nil, &DecodeError{Field: "peer up rate", Index: i, Err: err}
+		}
+		if p.Percent, err = fields[5].uint64Value(); err != nil {
+			return nil, &DecodeError{Field: "peer percent", Index: i, Err: err}
+		}
+		peers = append(peers, p)
+	}
+
+	return peers, nil
+}
+
+// Extend fetches the fields of Extended for the given torrents in one
+// multicall and sets their Extended. As with
+// GetTorrents, the returned error matches ErrNotFound once for each torrent
+// which is gone, the others are still extended.
+func (r *Rtorrent) Extend(ts ...*Torrent) error {
+	if len(ts) == 0 {
+		return nil
+	}
+
+	hashes := make([]string, len(ts))
+	for i, t := range ts {
+		hashes[i] = t.Hash
+	}
+
+	resp, err := r.execute(context.Background(), buildExtendRequest(hashes...))
+	if err != nil {
+		return err
+	}
+
+	values, err := resp.arrayParam()
+	if err != nil {
+		return err
+	}
+
+	n := len(extendedFields) + 1
+	if len(values) != len(ts)*n {
+		return &ProtocolError{Msg: fmt.Sprintf("expected %d values for %d torrents, got %d", len(ts)*n, len(ts), len(values))}
+	}
+
+	var missing []error
+	for i, t := range ts {
+		results := values[i*n : (i+1)*n]
+		if results[0].fault().notFound() {
+			missing = append(missing, fmt.Errorf("%w: %s", ErrNotFound, t.Hash))
+			continue
+		}
+
+		fields := make([]xmlrpcValue, len(extendedFields))
+		for j := range fields {
+			if fields[j], err = results[j].firstArrayValue(); err != nil {
+				return &DecodeError{Field: extendedFields[j], Index: i, Err: err}
+			}
+		}
+		// a torrent without trackers has no scrapes, nor a fault.
+		scrapes, _ := results[n-1].firstArrayValue()
+		ext, err := parseExtended(fields, scrapes)
+		if err != nil {
+			var decodeErr *DecodeError
+			if errors.As(err, &decodeErr) {
+				decodeErr.Index = i
+			}
+			return err
+		}
+		t.Extended = ext
+	}
+
+	return errors.Join(missing...)
+}
+
+func parseExtended(fields []xmlrpcValue, scrapes xmlrpcValue) (*Extended, error) {
+	ext := new(Extended)
+	var err error
+	if ext.Seeders, err = fields[0].uint64Value(); err != nil {
+		return nil, &DecodeError{Field: "torrent seeders", Err: err}
+	}
+	if ext.Leechers, err = fields[1].uint64Value(); err != nil {
+		return nil, &DecodeError{Field: "torrent leechers", Err: err}
+	}
+	if ext.Priority, err = fields[2].int64Value(); err != nil {
+		return nil, &DecodeError{Field: "torrent priority", Err: err}
+	}
+	private, err := fields[3].uint64Value()
+	if err != nil {
+		return nil, &DecodeError{Field: "torrent private flag", Err: err}
+	}
+	ext.Private = private == 1
+	multiFile, err := fields[4].uint64Value()
+	if err != nil {
+		return nil, &DecodeError{Field: "torrent multi-file flag", Err: err}
+	}
+	ext.MultiFile = multiFile == 1
+	if ext.Directory, err = fields[5].stringValue(); err != nil {
+		return nil, &DecodeError{Field: "torrent directory", Err: err}
+	}
+	if ext.Left, err = fields[6].uint64Value(); err != nil {
+		return nil, &DecodeError{Field: "torrent bytes left", Err: err}
+	}
+	if ext.Skipped, err = fields[7].uint64Value(); err != nil {
+		return nil, &DecodeError{Field: "torrent bytes skipped", Err: err}
+	}
+	if ext.Done, err = fields[14].uint64Value(); err != nil {
+		return nil, &DecodeError{Field: "torrent bytes done", Err: err}
+	}
+	if ext.Throttle, err = fields[8].stringValue(); err != nil {
+		return nil, &DecodeError{Field: "torrent throttle", Err: err}
+	}
+	for i := range ext.Custom {
+		if ext.Custom[i], err = fields[9+i].stringValue(); err != nil {
+			return nil, &DecodeError{Field: fmt.Sprintf("torrent custom%d", i+1), Err: err}
+		}
+	}
+
+	// the best scrape counts, the trackers see the same swarm.
+	rows, _ := scrapes.arrayValues()
+	for _, scrape := range rows {
+		counts, err := scrape.arrayValues()
+		if err != nil || len(counts) < 2 {
+			return nil, &DecodeError{Field: "torrent scrape", Err: fmt.Errorf("rtapi: expected 2 scrape counts")}
+		}
+		ext.SeedersTotal = max(ext.SeedersTotal, uint64(counts[0].intOrZero()))
+		ext.LeechersTotal = max(ext.LeechersTotal, uint64(counts[1].intOrZero()))
+	}
+
+	return ext, nil
+}
@@ -0,0 +1,98 @@
+package rtapi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrNotFound is returned when no torrent has the requested hash.
+var ErrNotFound = errors.New("rtapi: torrent not found")
+
+// ErrUnreachable matches, with errors.Is, the errors of requests which
+// couldn't reach rTorrent, retries included, e.g. a refused connection or an
+// answer cut short. ErrCircuitOpen matches it too.
+var ErrUnreachable = errors.New("rtapi: rTorrent is unreachable")
+
+// unreachableError keeps the message of err while matching ErrUnreachable.
+type unreachableError struct{ err error }
+
+func (e *unreachableError) Error() string   { return e.err.Error() }
+func (e *unreachableError) Unwrap() []error { return []error{ErrUnreachable, e.err} }
+
+// Fault is an error rTorrent answered with, e.g. for an unknown command or
+// hash. Faults of single commands within a multicall are returned as Fault
+// too.
+type Fault struct {
+	Code    int
+	Message string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("rtapi: fault %d: %s", f.Code, f.Message)
+}
+
+// faultInputError is the code of the faults rTorrent answers bad arguments
+// with, an unknown info-hash among them.
+const faultInputError = -501
+
+// notFound reports whether f answers a command given a hash and no other
+// argument, e.g. d.name, for an unknown torrent: the hash is the only input
+// such a command can reject.
+func (f *Fault) notFound() bool {
+	return f != nil && f.Code == faultInputError
+}
+
+// ProtocolError is returned when the answer of rTorrent can't be read as
+// XML-RPC or JSON-RPC, or doesn't have the expected shape.
+type ProtocolError struct {
+	Msg string
+	Err error // the underlying error, if any
+}
+
+func (e *ProtocolError) Error() string {
+	if e.Err == nil {
+		return "rtapi: " + e.Msg
+	}
+	return "rtapi: " + e.Msg + ": " + e.Err.Error()
+}
+
+func (e *ProtocolError) Unwrap() error { return e.Err }
+
+// DecodeError is returned when a value of a well-formed answer has an
+// unexpected type, e.g. a name which isn't a string.
+type DecodeError struct {
+	Field string // e.g. "torrent name" or "file size"
+	Index int    // of the torrent, file, tracker, peer or stat in the answer
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return "rtapi: parse " + e.Field + " #" + strconv.Itoa(e.Index) + ": " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// fault returns the fault v holds, nil if it isn't one. system.multicall
+// answers failed commands with a fault struct in place of their result.
+func (v xmlrpcValue) fault() *Fault {
+	if v.Struct == nil {
+		return nil
+	}
+	var f Fault
+	var found bool
+	for _, m := range v.Struct.Members {
+		switch m.Name {
+		case "faultCode":
+			code, _ := m.Value.int64Value()
+			f.Code, found = int(code), true
+		case "faultString":
+			f.Message, _ = m.Value.stringValue()
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &f
+}
@@ -0,0 +1,117 @@
+package rtapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pyed/rtapi/rtapitest"
+)
+
+func TestErrors(t *testing.T) {
+	fake := newRetryServer(t)
+	fake.AddTorrent(&rtapitest.Torrent{Hash: "02CA77A6A047FD37F04337437D18F82E61861084", Name: "debian.iso"})
+	rt, err := NewRtorrent(fake.Addr, WithRetry(RetryPolicy{MaxAttempts: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	torrents, err := rt.Torrents()
+	if err != nil {
+		t.Fatalf("Expected torrents without trackers to be listed, got: %v", err)
+	}
+	if len(torrents) != 2 || torrents[1].Tracker.String() != "" {
+		t.Errorf("Expected debian.iso without tracker, got: %+v", torrents)
+	}
+
+	if _, err := rt.GetTorrent("DEADBEEF"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+
+	var fault *Fault
+	if _, err := rt.Call("d.name", "DEADBEEF"); !errors.As(err, &fault) || fault.Code != -501 {
+		t.Errorf("Expected the fault, got: %v", err)
+	}
+	fake.SetFault("d.multicall2", -506, "Method 'd.multicall2' not defined")
+	if _, err := rt.Torrents(); !errors.As(err, &fault) || fault.Message != "Method 'd.multicall2' not defined" {
+		t.Errorf("Expected the fault, got: %v", err)
+	}
+	fake.ClearFaults()
+
+	fake.SetFault("network.listen.port", -506, "Method 'network.listen.port' not defined")
+	if _, err := rt.Stats(); !errors.As(err, &fault) || fault.Code != -506 {
+		t.Errorf("Expected the fault of the multicall entry, got: %v", err)
+	}
+	fake.ClearFaults()
+
+	// not found is told by the code, whatever the wording of the message.
+	fake.SetFault("d.name", -501, "Could not find info-hash")
+	if _, err := rt.GetTorrent("02CA77A6A047FD37F04337437D18F82E61861084"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+	fake.SetFault("d.name", -506, "Could not find info-hash.")
+	if _, err := rt.GetTorrent("02CA77A6A047FD37F04337437D18F82E61861084"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected an error other than ErrNotFound, got: %v", err)
+	}
+	fake.ClearFaults()
+
+	fake.SetFault("load.start", -503, "Could not create download.")
+	if err := rt.Download("http://example.com/debian.torrent"); !errors.As(err, &fault) || fault.Code != -503 {
+		t.Errorf("Expected the fault of the action, got: %v", err)
+	}
+	fake.SetFault("system.multicall", -506, "Method 'system.multicall' not defined")
+	if err := rt.Start(torrents...); !errors.As(err, &fault) || fault.Code != -506 {
+		t.Errorf("Expected the fault of the action, got: %v", err)
+	}
+	fake.ClearFaults()
+
+	fake.Hangup(1)
+	if _, err := rt.Torrents(); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Expected ErrUnreachable, got: %v", err)
+	}
+	if !errors.Is(ErrCircuitOpen, ErrUnreachable) {
+		t.Error("Expected ErrCircuitOpen to match ErrUnreachable")
+	}
+
+	var protoErr *ProtocolError
+	if _, err := decodeMethodResponse(strings.NewReader("<methodResponse><params>")); !errors.As(err, &protoErr) {
+		t.Errorf("Expected a ProtocolError, got: %v", err)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	lt := newLargeTransport()
+	lt.torrents = bytes.Replace(lt.torrents,
+		[]byte("<value><string>torrent-300.iso</string></value>"), []byte("<value><i8>300</i8></value>"), 1)
+	rt := &Rtorrent{transport: lt}
+
+	var decodeErr *DecodeError
+	err := rt.TorrentsIter(context.Background(), func(*Torrent) error { return nil })
+	if !errors.As(err, &decodeErr) || decodeErr.Field != "torrent name" || decodeErr.Index != 300 {
+		t.Errorf("Expected a DecodeError of torrent #300's name, got: %v", err)
+	}
+
+	// the trackers of the last batch, whose 4th torrent has a wrong url.
+	lt = newLargeTransport()
+	last := largeTorrents % trackersBatch
+	buf := new(bytes.Buffer)
+	buf.WriteString("<methodResponse><params><param><value><array><data>")
+	for i := 0; i < last; i++ {
+		value := "<string>udp://tracker.archlinux.org:6969</string>"
+		if i == 3 {
+			value = "<i8>1</i8>"
+		}
+		fmt.Fprintf(buf, "<value><array><data><value>%s</value></data></array></value>", value)
+	}
+	buf.WriteString("</data></array></value></param></params></methodResponse>")
+	lt.trackers[last] = buf.Bytes()
+	rt = &Rtorrent{transport: lt}
+
+	err = rt.TorrentsIter(context.Background(), func(*Torrent) error { return nil })
+	if expected := largeTorrents - last + 3; !errors.As(err, &decodeErr) || decodeErr.Field != "torrent tracker" || decodeErr.Index != expected {
+		t.Errorf("Expected a DecodeError of torrent #%d's tracker, got: %v", expected, err)
+	}
+}
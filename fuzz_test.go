@@ -0,0 +1,358 @@
+package rtapi
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+	"unicode/utf8"
+)
+
+// seedResponses returns well-formed responses to seed the fuzzers with: the
+// canned answers of the tests, written after rTorrent's, and the golden
+// recordings, made from rtapitest (see TestRecordGolden).
+func seedResponses(tb testing.TB) [][]byte {
+	responses := [][]byte{
+		[]byte(torrentsResp), []byte(trackersResp), []byte(transferResp), []byte(statsResp),
+		[]byte(versionResp), []byte(callResp), []byte(filesResp), []byte(trackerListResp), []byte(peersResp),
+	}
+
+	files, err := filepath.Glob("testdata/golden/*/*.response")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		responses = append(responses, data)
+	}
+	return responses
+}
+
+func FuzzDecodeMethodResponse(f *testing.F) {
+	for _, resp := range seedResponses(f) {
+		f.Add(resp)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var streamed []interface{}
+		streamErr := decodeArrayResponse(bytes.NewReader(data), func(v xmlrpcValue) error {
+			walkValue(v, 0)
+			streamed = append(streamed, v.native())
+			return nil
+		})
+
+		resp, err := decodeMethodResponse(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		// the accessors must cope with whatever was decoded.
+		for _, param := range resp.Params {
+			walkValue(param.Value, 0)
+		}
+		values, err := resp.arrayParam()
+		if err != nil {
+			return
+		}
+
+		// the streaming decoder must read whatever the tree decoder does.
+		if streamErr != nil {
+			t.Fatalf("Expected %d values from decodeArrayResponse, got: %v", len(values), streamErr)
+		}
+		if len(streamed) != len(values) {
+			t.Fatalf("Expected %d values from decodeArrayResponse, got: %d", len(values), len(streamed))
+		}
+		for i, v := range values {
+			// %#v, unlike reflect.DeepEqual, finds NaN equal to itself.
+			if want, got := fmt.Sprintf("%#v", v.native()), fmt.Sprintf("%#v", streamed[i]); got != want {
+				t.Errorf("Value %d: Expected %s, got: %s", i, want, got)
+			}
+		}
+	})
+}
+
+func walkValue(v xmlrpcValue, depth int) {
+	v.native()
+	v.stringValue()
+	v.int64Value()
+	v.uint64Value()
+	v.firstArrayValue()
+
+	if depth > 32 {
+		return
+	}
+	if values, err := v.arrayValues(); err == nil {
+		for _, value := range values {
+			walkValue(value, depth+1)
+		}
+	}
+	if v.Struct != nil {
+		for _, m := range v.Struct.Members {
+			walkValue(m.Value, depth+1)
+		}
+	}
+}
+
+func FuzzParseTorrent(f *testing.F) {
+	f.Add([]byte(torrentsResp))
+	if data, err := os.ReadFile("testdata/golden/torrents/0002.response"); err == nil {
+		f.Add(data)
+	}
+
+	states := make(map[State]bool, len(States))
+	for _, s := range States {
+		states[s] = true
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		resp, err := decodeMethodResponse(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		values, err := resp.arrayParam()
+		if err != nil {
+			return
+		}
+
+		for _, value := range values {
+			torrent, err := parseTorrent(value)
+			if err != nil {
+				continue
+			}
+
+			if !states[torrent.State] {
+				t.Errorf("Unknown state %q", torrent.State)
+			}
+			if !strings.HasSuffix(torrent.Percent, "%") {
+				t.Errorf("Expected a percentage, got: %q", torrent.Percent)
+			}
+			if torrent.Completed >= torrent.Size && torrent.Percent != "100%" {
+				t.Errorf("Expected 100%% for %d/%d bytes, got: %s", torrent.Completed, torrent.Size, torrent.Percent)
+			}
+		}
+	})
+}
+
+func FuzzEncode(f *testing.F) {
+	f.Add(torrentsReq)
+	f.Add(downloadReq)
+	f.Add("")
+	f.Add("\x00,:")
+	f.Add("{")
+	f.Add(`{"jsonrpc":"2.0","method":"system.listMethods","id":1}`)
+
+	f.Fuzz(func(t *testing.T, body string) {
+		frame := string(encode(body))
+
+		// netstring: "<len>:<headers>,<body>"
+		size, rest, found := strings.Cut(frame, ":")
+		if !found {
+			t.Fatalf("Missing netstring length in %q", frame)
+		}
+		n, err := strconv.Atoi(size)
+		if err != nil || n > len(rest) || rest[n] != ',' {
+			t.Fatalf("Invalid netstring in %q", frame)
+		}
+
+		// JSON-RPC bodies also say what they are, XML is the default.
+		want := 4
+		if strings.HasPrefix(body, "{") {
+			want = 6
+		}
+		headers := strings.Split(strings.TrimSuffix(rest[:n], "\x00"), "\x00")
+		if len(headers) != want || headers[0] != "CONTENT_LENGTH" || headers[2] != "SCGI" || headers[3] != "1" {
+			t.Fatalf("Unexpected headers %q", headers)
+		}
+		if want == 6 && (headers[4] != "CONTENT_TYPE" || headers[5] != "application/json") {
+			t.Fatalf("Expected CONTENT_TYPE application/json, got: %q", headers[4:])
+		}
+		if length, err := strconv.Atoi(headers[1]); err != nil || length != len(body) {
+			t.Errorf("Expected CONTENT_LENGTH %d, got: %s", len(body), headers[1])
+		}
+		if got := rest[n+1:]; got != body {
+			t.Errorf("Expected body %q, got: %q", body, got)
+		}
+	})
+}
+
+// unquoteArg reads back an argument the way rTorrent parses commands: a
+// quoted string with backslash escapes, or a bare word.
+func unquoteArg(s string) (string, bool) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, !strings.ContainsAny(s, "\",; \t\\{}()$")
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", false
+			}
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), i == len(s)-1
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", false
+}
+
+// isXMLText reports whether s can be sent in XML unchanged.
+func isXMLText(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if r < 0x20 && r != '\t' && r != '\n' {
+			return false
+		}
+		if r == 0xFFFD || r == 0xFFFE || r == 0xFFFF {
+			return false
+		}
+	}
+	return true
+}
+
+func FuzzCommandArg(f *testing.F) {
+	f.Add(testDownloadDir, testDownloadLabel)
+	f.Add(`/home/my "files"`, "Linux, BSD")
+	f.Add(`C:\Downloads\`, "$execute=rm,-rf,/")
+	f.Add("", "")
+
+	f.Fuzz(func(t *testing.T, dir, label string) {
+		if !isXMLText(dir) || !isXMLText(label) {
+			t.Skip()
+		}
+
+		req := mustBuildDownloadWithOptionsRequest(testDownloadURL, dir, label)
+
+		var call xmlrpcMethodCall
+		if err := xml.Unmarshal([]byte(strings.TrimPrefix(req, xml.Header)), &call); err != nil {
+			t.Fatal(err)
+		}
+		params := call.Params[0].Value.Array.Values[0].Struct.Members[1].Value.Array.Values
+
+		for i, expected := range map[int]string{2: dir, 3: label} {
+			cmd := *params[i].String
+			_, arg, _ := strings.Cut(cmd, "=")
+			got, ok := unquoteArg(arg)
+			if !ok || got != expected {
+				t.Errorf("Expected %q to read back as %q, got: %q (ok %v)", cmd, expected, got, ok)
+			}
+		}
+	})
+}
+
+// valueTree is a random xmlrpcValue for testing/quick.
+type valueTree struct {
+	xmlrpcValue
+}
+
+func (valueTree) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(valueTree{randomValue(r, 3)})
+}
+
+func randomString(r *rand.Rand) string {
+	const chars = "abcXYZ019 <>&\"'\t\néü€-_/:,;$\\"
+	runes := []rune(chars)
+	b := make([]rune, r.Intn(12))
+	for i := range b {
+		b[i] = runes[r.Intn(len(runes))]
+	}
+	return string(b)
+}
+
+func randomValue(r *rand.Rand, depth int) xmlrpcValue {
+	kinds := 11
+	if depth == 0 {
+		kinds = 9
+	}
+
+	switch r.Intn(kinds) {
+	case 5:
+		b := make(xmlrpcBase64, r.Intn(16))
+		r.Read(b)
+		return xmlrpcValue{Base64: &b}
+	case 6:
+		t := xmlrpcTime(time.Unix(r.Int63n(1<<32), 0).UTC())
+		return xmlrpcValue{DateTime: &t}
+	case 7:
+		return xmlrpcValue{Nil: &struct{}{}}
+	case 8:
+		return xmlrpcValue{Text: randomString(r)}
+	case 0:
+		s := randomString(r)
+		return xmlrpcValue{String: &s}
+	case 1:
+		n := int64(r.Int31()) - 1<<30
+		return xmlrpcValue{I4: &n}
+	case 2:
+		n := r.Int63() - 1<<62
+		return xmlrpcValue{I8: &n}
+	case 3:
+		d := r.NormFloat64() * 1e6
+		return xmlrpcValue{Double: &d}
+	case 4:
+		b := r.Intn(2) == 1
+		return xmlrpcValue{Boolean: &b}
+	case 9:
+		values := make([]xmlrpcValue, r.Intn(4))
+		for i := range values {
+			values[i] = randomValue(r, depth-1)
+		}
+		return xmlrpcValue{Array: &xmlrpcArray{Values: values}}
+	default:
+		members := make([]xmlrpcMember, r.Intn(4))
+		for i := range members {
+			members[i] = xmlrpcMember{Name: randomString(r) + strconv.Itoa(i), Value: randomValue(r, depth-1)}
+		}
+		return xmlrpcValue{Struct: &xmlrpcStruct{Members: members}}
+	}
+}
+
+func TestValueRoundTrip(t *testing.T) {
+	roundTrip := func(v valueTree) bool {
+		resp := struct {
+			XMLName xml.Name      `xml:"methodResponse"`
+			Params  []xmlrpcParam `xml:"params>param"`
+		}{Params: []xmlrpcParam{{Value: v.xmlrpcValue}}}
+
+		payload, err := xml.Marshal(resp)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+
+		decoded, err := decodeMethodResponse(bytes.NewReader(append([]byte(xml.Header), payload...)))
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		if len(decoded.Params) != 1 {
+			return false
+		}
+
+		// the type of every value must survive as well, not just its content.
+		again, _ := xml.Marshal(decoded.Params[0].Value)
+		first, _ := xml.Marshal(v.xmlrpcValue)
+		return reflect.DeepEqual(decoded.Params[0].Value.native(), v.native()) && bytes.Equal(first, again)
+	}
+
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
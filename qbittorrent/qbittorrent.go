@@ -0,0 +1,188 @@
+// Package qbittorrent serves rTorrent over the core of qBittorrent's WebUI
+// API v2, so automation which only supports qBittorrent can drive rTorrent.
+//
+//	rt, err := rtapi.NewRtorrent("localhost:5000")
+//	if err != nil {
+//		// ...
+//	}
+//
+//	log.Fatal(http.ListenAndServe(":8080", qbittorrent.New(rt, qbittorrent.WithAuth("admin", "adminadmin"))))
+//
+// qBittorrent categories are rTorrent labels ('d.custom1', as used by
+// ruTorrent), and torrent states are derived from rtapi's states.
+package qbittorrent
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+const (
+	// Version is the qBittorrent version reported by app/version.
+	Version = "v4.6.0"
+	// APIVersion is the WebUI API version reported by app/webapiVersion.
+	APIVersion = "2.9.3"
+)
+
+const (
+	sessionCookie  = "SID"
+	sessionTimeout = time.Hour
+)
+
+// Handler is an http.Handler serving the WebUI API under /api/v2/.
+type Handler struct {
+	rt                 *rtapi.Rtorrent
+	username, password string
+	mux                *http.ServeMux
+
+	mu       sync.Mutex
+	sessions map[string]time.Time // expiry by SID
+}
+
+// Option configures a *Handler created by New.
+type Option func(*Handler)
+
+// WithAuth requires clients to log in through auth/login, without it every
+// request is allowed.
+func WithAuth(username, password string) Option {
+	return func(h *Handler) {
+		h.username, h.password = username, password
+	}
+}
+
+// New returns a *Handler serving rt.
+func New(rt *rtapi.Rtorrent, opts ...Option) *Handler {
+	h := &Handler{
+		rt:       rt,
+		mux:      http.NewServeMux(),
+		sessions: make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux.HandleFunc("POST /api/v2/auth/login", h.handleLogin)
+	h.mux.HandleFunc("POST /api/v2/auth/logout", h.handleLogout)
+
+	h.handle("/api/v2/app/version", h.handleVersion)
+	h.handle("/api/v2/app/webapiVersion", h.handleAPIVersion)
+	h.handle("/api/v2/app/preferences", h.handlePreferences)
+	h.handle("/api/v2/transfer/info", h.handleTransferInfo)
+	h.handle("/api/v2/torrents/info", h.handleInfo)
+	h.handle("/api/v2/torrents/categories", h.handleCategories)
+	h.handle("POST /api/v2/torrents/add", h.handleAdd)
+	h.handle("POST /api/v2/torrents/pause", h.handleAction(h.rt.Stop))
+	h.handle("POST /api/v2/torrents/stop", h.handleAction(h.rt.Stop))
+	h.handle("POST /api/v2/torrents/resume", h.handleAction(h.rt.Start))
+	h.handle("POST /api/v2/torrents/start", h.handleAction(h.rt.Start))
+	h.handle("POST /api/v2/torrents/recheck", h.handleAction(h.rt.Check))
+	h.handle("POST /api/v2/torrents/setForceStart", h.handleForceStart)
+	h.handle("POST /api/v2/torrents/delete", h.handleDelete)
+	h.handle("POST /api/v2/torrents/setCategory", h.handleSetCategory)
+	h.handle("POST /api/v2/torrents/createCategory", h.handleCreateCategory)
+
+	return h
+}
+
+// handle registers a handler requiring a logged in session.
+func (h *Handler) handle(pattern string, handler http.HandlerFunc) {
+	h.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if !h.authorized(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	})
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) authRequired() bool {
+	return h.username != "" || h.password != ""
+}
+
+func (h *Handler) authorized(r *http.Request) bool {
+	if !h.authRequired() {
+		return true
+	}
+
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	expiry, ok := h.sessions[c.Value]
+	if !ok || time.Now().After(expiry) {
+		delete(h.sessions, c.Value)
+		return false
+	}
+	h.sessions[c.Value] = time.Now().Add(sessionTimeout)
+	return true
+}
+
+func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
+	user, pass := r.FormValue("username"), r.FormValue("password")
+	if h.authRequired() &&
+		(subtle.ConstantTimeCompare([]byte(user), []byte(h.username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(h.password)) != 1) {
+		io.WriteString(w, "Fails.")
+		return
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	sid := hex.EncodeToString(b)
+
+	h.mu.Lock()
+	now := time.Now()
+	for id, expiry := range h.sessions {
+		if now.After(expiry) {
+			delete(h.sessions, id)
+		}
+	}
+	h.sessions[sid] = now.Add(sessionTimeout)
+	h.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: sid, Path: "/", HttpOnly: true})
+	io.WriteString(w, "Ok.")
+}
+
+func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		h.mu.Lock()
+		delete(h.sessions, c.Value)
+		h.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1})
+}
+
+func (h *Handler) handleVersion(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, Version)
+}
+
+func (h *Handler) handleAPIVersion(w http.ResponseWriter, r *http.Request) {
+	io.WriteString(w, APIVersion)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
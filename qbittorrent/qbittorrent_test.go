@@ -0,0 +1,284 @@
+package qbittorrent
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pyed/rtapi"
+	"github.com/pyed/rtapi/rtapitest"
+)
+
+func newTestHandler(t *testing.T, opts ...Option) (*Handler, *rtapitest.Server) {
+	t.Helper()
+
+	fake := rtapitest.NewServer()
+	t.Cleanup(fake.Close)
+	fake.SetSession(rtapitest.Session{
+		ClientVersion:  "0.9.6",
+		LibraryVersion: "0.13.6",
+		Port:           6980,
+		Directory:      "/home/Downloads",
+		UpTotal:        6841,
+		DownTotal:      7476,
+	})
+	fake.AddTorrent(
+		&rtapitest.Torrent{
+			Hash:      "8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648",
+			Name:      "ubuntu-17.04-server-amd64.iso",
+			Directory: "/home/Downloads",
+			Size:      1370 * 524288,
+			Completed: 1370 * 524288,
+			ChunkSize: 524288,
+			UpRate:    593,
+			LoadDate:  1492032019,
+			Open:      true,
+			Active:    true,
+			Started:   true,
+			Trackers:  []rtapitest.Tracker{{URL: "http://torrent.ubuntu.com:6969/announce"}},
+		},
+		&rtapitest.Torrent{
+			Hash:      "02CA77A6A047FD37F04337437D18F82E61861084",
+			Name:      "archlinux-2017.04.01-x86_64.iso",
+			Directory: "/home/Downloads",
+			Size:      956 * 524288,
+			Completed: 115 * 524288,
+			ChunkSize: 524288,
+			DownRate:  997035,
+			LoadDate:  1492031149,
+			Open:      true,
+			Active:    true,
+			Started:   true,
+			Custom1:   "Linux",
+			Trackers:  []rtapitest.Tracker{{URL: "udp://tracker.archlinux.org:6969"}},
+		},
+	)
+
+	rt, err := rtapi.NewRtorrent(fake.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(rt, opts...), fake
+}
+
+func do(h http.Handler, method, target string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req := httptest.NewRequest(method, target, body)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLogin(t *testing.T) {
+	h := New(&rtapi.Rtorrent{}, WithAuth("admin", "adminadmin"))
+
+	if rec := do(h, "GET", "/api/v2/app/version", nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 before login, got: %d", rec.Code)
+	}
+
+	rec := do(h, "POST", "/api/v2/auth/login", url.Values{"username": {"admin"}, "password": {"wrong"}})
+	if rec.Body.String() != "Fails." {
+		t.Errorf("Expected Fails. for a wrong password, got: %q", rec.Body)
+	}
+
+	rec = do(h, "POST", "/api/v2/auth/login", url.Values{"username": {"admin"}, "password": {"adminadmin"}})
+	if rec.Body.String() != "Ok." {
+		t.Fatalf("Expected Ok., got: %q", rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "SID" {
+		t.Fatalf("Expected a SID cookie, got: %v", cookies)
+	}
+
+	rec = do(h, "GET", "/api/v2/app/version", nil, cookies[0])
+	if rec.Code != http.StatusOK || rec.Body.String() != Version {
+		t.Errorf("Expected the version after login, got: %d %q", rec.Code, rec.Body)
+	}
+
+	do(h, "POST", "/api/v2/auth/logout", nil, cookies[0])
+	if rec := do(h, "GET", "/api/v2/app/version", nil, cookies[0]); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 after logout, got: %d", rec.Code)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"ubuntu-17.04-server-amd64.iso", "archlinux-2017.04.01-x86_64.iso"}},
+		{"?filter=downloading", []string{"archlinux-2017.04.01-x86_64.iso"}},
+		{"?filter=completed", []string{"ubuntu-17.04-server-amd64.iso"}},
+		{"?category=Linux", []string{"archlinux-2017.04.01-x86_64.iso"}},
+		{"?category=", []string{"ubuntu-17.04-server-amd64.iso"}},
+		{"?hashes=02ca77a6a047fd37f04337437d18f82e61861084", []string{"archlinux-2017.04.01-x86_64.iso"}},
+		{"?sort=name", []string{"archlinux-2017.04.01-x86_64.iso", "ubuntu-17.04-server-amd64.iso"}},
+		{"?sort=name&reverse=true&limit=1", []string{"ubuntu-17.04-server-amd64.iso"}},
+	}
+
+	for _, test := range testCases {
+		rec := do(h, "GET", "/api/v2/torrents/info"+test.query, nil)
+		var list []Torrent
+		if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+			t.Fatalf("%s: %v", test.query, err)
+		}
+
+		names := make([]string, len(list))
+		for i := range list {
+			names[i] = list[i].Name
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: Expected %v, got: %v", test.query, test.expected, names)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	testCases := []struct {
+		torrent  rtapi.Torrent
+		expected string
+	}{
+		{rtapi.Torrent{State: rtapi.Leeching, DownRate: 1}, "downloading"},
+		{rtapi.Torrent{State: rtapi.Leeching}, "stalledDL"},
+		{rtapi.Torrent{State: rtapi.Seeding, UpRate: 1}, "uploading"},
+		{rtapi.Torrent{State: rtapi.Seeding}, "stalledUP"},
+		{rtapi.Torrent{State: rtapi.Complete}, "pausedUP"},
+		{rtapi.Torrent{State: rtapi.Stopped, Size: 2, Completed: 1}, "pausedDL"},
+		{rtapi.Torrent{State: rtapi.Hashing, Size: 2, Completed: 2}, "checkingUP"},
+		{rtapi.Torrent{State: rtapi.Error}, "error"},
+		{rtapi.Torrent{State: rtapi.StoppedError}, "error"},
+		{rtapi.Torrent{State: rtapi.PartialSeed, UpRate: 1}, "uploading"},
+		{rtapi.Torrent{State: rtapi.Paused, Size: 2, Completed: 2}, "pausedUP"},
+		{rtapi.Torrent{State: rtapi.Queued, Size: 2, Completed: 1}, "queuedDL"},
+		{rtapi.Torrent{State: rtapi.HashQueued, Size: 2, Completed: 1}, "checkingDL"},
+	}
+
+	for i, test := range testCases {
+		if got := state(&test.torrent); got != test.expected {
+			t.Errorf("Case %d: Expected %s, got: %s", i, test.expected, got)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	h, fake := newTestHandler(t)
+
+	rec := do(h, "POST", "/api/v2/torrents/add", url.Values{
+		"urls":     {"magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567\nhttp://example.com/b.torrent"},
+		"category": {"Linux"},
+	})
+	if rec.Body.String() != "Ok." {
+		t.Fatalf("Expected Ok., got: %d %q", rec.Code, rec.Body)
+	}
+	ts := fake.Torrents()
+	if len(ts) != 4 {
+		t.Fatalf("Expected both urls to be loaded, got %d torrents", len(ts))
+	}
+	for _, added := range ts[2:] {
+		if added.Custom1 != "Linux" {
+			t.Errorf("Expected %s to be in the Linux category, got: %q", added.Name, added.Custom1)
+		}
+	}
+
+	if rec := do(h, "POST", "/api/v2/torrents/add", url.Values{}); rec.Body.String() != "Fails." {
+		t.Errorf("Expected Fails. without urls, got: %q", rec.Body)
+	}
+}
+
+func TestAddFile(t *testing.T) {
+	h, fake := newTestHandler(t)
+
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("torrents", "debian.torrent")
+	fw.Write([]byte("d4:infod6:lengthi1e4:name10:debian.iso12:piece lengthi1e6:pieces0:ee"))
+	mw.WriteField("category", "Software")
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/api/v2/torrents/add", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Body.String() != "Ok." {
+		t.Fatalf("Expected Ok., got: %d %q", rec.Code, rec.Body)
+	}
+
+	ts := fake.Torrents()
+	if len(ts) != 3 || ts[2].Name != "debian.iso" || ts[2].Custom1 != "Software" {
+		t.Errorf("Expected the file to be loaded in the Software category, got: %+v", ts[len(ts)-1])
+	}
+}
+
+func TestActions(t *testing.T) {
+	h, fake := newTestHandler(t)
+
+	testCases := []struct {
+		path   string
+		form   url.Values
+		called string
+	}{
+		{"pause", url.Values{"hashes": {"all"}}, "d.stop"},
+		{"resume", url.Values{"hashes": {"02ca77a6a047fd37f04337437d18f82e61861084"}}, "d.start"},
+		{"recheck", url.Values{"hashes": {"02ca77a6a047fd37f04337437d18f82e61861084"}}, "d.check_hash"},
+		{"setForceStart", url.Values{"hashes": {"02ca77a6a047fd37f04337437d18f82e61861084"}, "value": {"true"}}, "d.resume"},
+		{"setCategory", url.Values{"hashes": {"02ca77a6a047fd37f04337437d18f82e61861084"}, "category": {"Software"}}, "d.custom1.set"},
+		{"delete", url.Values{"hashes": {"02ca77a6a047fd37f04337437d18f82e61861084"}, "deleteFiles": {"false"}}, "d.erase"},
+	}
+
+	for _, test := range testCases {
+		rec := do(h, "POST", "/api/v2/torrents/"+test.path, test.form)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: Expected status 200, got: %d %s", test.path, rec.Code, rec.Body)
+		}
+		if fake.CallCount(test.called) == 0 {
+			t.Errorf("%s: Expected %s to be called", test.path, test.called)
+		}
+	}
+
+	if rec := do(h, "GET", "/api/v2/torrents/pause", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected actions to require POST, got: %d", rec.Code)
+	}
+}
+
+func TestTransferInfo(t *testing.T) {
+	h, fake := newTestHandler(t)
+	session := fake.Session()
+	session.DHTMode, session.DHTNodes = "on", 143
+	fake.SetSession(session)
+
+	var info TransferInfo
+	json.NewDecoder(do(h, "GET", "/api/v2/transfer/info", nil).Body).Decode(&info)
+
+	expected := TransferInfo{DLInfoSpeed: 997035, DLInfoData: 7476, UPInfoSpeed: 593, UPInfoData: 6841, DHTNodes: 143, ConnectionStatus: "connected"}
+	if info != expected {
+		t.Errorf("Expected %+v, got: %+v", expected, info)
+	}
+}
+
+func TestCategories(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	var categories map[string]category
+	json.NewDecoder(do(h, "GET", "/api/v2/torrents/categories", nil).Body).Decode(&categories)
+	if len(categories) != 1 || categories["Linux"].Name != "Linux" {
+		t.Errorf("Expected the Linux category, got: %v", categories)
+	}
+}
@@ -0,0 +1,479 @@
+package qbittorrent
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+// maxAddSize limits the size of torrents/add requests.
+const maxAddSize = 10 << 20
+
+// infiniteETA is what qBittorrent reports when there's no ETA.
+const infiniteETA = 8640000
+
+// Torrent is an entry of torrents/info.
+type Torrent struct {
+	Hash        string  `json:"hash"`
+	Name        string  `json:"name"`
+	Size        uint64  `json:"size"`
+	TotalSize   uint64  `json:"total_size"`
+	Progress    float64 `json:"progress"`
+	DLSpeed     uint64  `json:"dlspeed"`
+	UPSpeed     uint64  `json:"upspeed"`
+	State       string  `json:"state"`
+	Category    string  `json:"category"`
+	Tags        string  `json:"tags"`
+	SavePath    string  `json:"save_path"`
+	ContentPath string  `json:"content_path"`
+	Ratio       float64 `json:"ratio"`
+	ETA         uint64  `json:"eta"`
+	AddedOn     uint64  `json:"added_on"`
+	SeedingTime int64   `json:"seeding_time"`
+	AmountLeft  uint64  `json:"amount_left"`
+	Completed   uint64  `json:"completed"`
+	Downloaded  uint64  `json:"downloaded"`
+	Uploaded    uint64  `json:"uploaded"`
+	Tracker     string  `json:"tracker"`
+}
+
+func newTorrent(t *rtapi.Torrent) *Torrent {
+	v := &Torrent{
+		Hash:        strings.ToLower(t.Hash),
+		Name:        t.Name,
+		Size:        t.Size,
+		TotalSize:   t.Size,
+		DLSpeed:     t.DownRate,
+		UPSpeed:     t.UpRate,
+		State:       state(t),
+		Category:    t.Label,
+		ContentPath: t.Path,
+		Ratio:       t.Ratio,
+		ETA:         infiniteETA,
+		AddedOn:     t.Age,
+		SeedingTime: int64(t.SeedingTime / time.Second),
+		Completed:   t.Completed,
+		Downloaded:  t.DownTotal,
+		Uploaded:    t.UpTotal,
+	}
+	if t.Path != "" {
+		v.SavePath = filepath.Dir(t.Path)
+	}
+	if t.Size > 0 {
+		v.Progress = t.Progress
+	}
+	if t.Completed < t.Size {
+		v.AmountLeft = t.Size - t.Completed
+	}
+	if t.State == rtapi.Leeching && t.ETA > 0 {
+		v.ETA = t.ETA
+	}
+	if t.Tracker != nil {
+		v.Tracker = t.Tracker.String()
+	}
+	return v
+}
+
+func complete(t *rtapi.Torrent) bool {
+	return t.Size > 0 && t.Completed >= t.Size
+}
+
+// state maps the rtapi state of t to a qBittorrent torrent state.
+func state(t *rtapi.Torrent) string {
+	switch t.State {
+	case rtapi.Leeching:
+		if t.DownRate == 0 {
+			return "stalledDL"
+		}
+		return "downloading"
+	case rtapi.Seeding, rtapi.PartialSeed:
+		if t.UpRate == 0 {
+			return "stalledUP"
+		}
+		return "uploading"
+	case rtapi.Complete:
+		return "pausedUP"
+	case rtapi.Hashing, rtapi.HashQueued:
+		if complete(t) {
+			return "checkingUP"
+		}
+		return "checkingDL"
+	case rtapi.Queued:
+		if complete(t) {
+			return "queuedUP"
+		}
+		return "queuedDL"
+	case rtapi.Error, rtapi.StoppedError:
+		return "error"
+	}
+
+	if complete(t) {
+		return "pausedUP"
+	}
+	return "pausedDL"
+}
+
+// matchFilter reports whether t matches a torrents/info filter.
+func matchFilter(t *Torrent, filter string) bool {
+	switch filter {
+	case "", "all":
+		return true
+	case "downloading":
+		return t.State == "downloading" || t.State == "stalledDL" || t.State == "pausedDL" || t.State == "checkingDL" || t.State == "queuedDL"
+	case "seeding":
+		return t.State == "uploading" || t.State == "stalledUP" || t.State == "queuedUP"
+	case "completed":
+		return t.Progress >= 1
+	case "paused", "stopped":
+		return t.State == "pausedDL" || t.State == "pausedUP"
+	case "resumed", "running":
+		return t.State != "pausedDL" && t.State != "pausedUP"
+	case "active":
+		return t.DLSpeed > 0 || t.UPSpeed > 0
+	case "inactive":
+		return t.DLSpeed == 0 && t.UPSpeed == 0
+	case "stalled":
+		return t.State == "stalledDL" || t.State == "stalledUP"
+	case "stalled_downloading":
+		return t.State == "stalledDL"
+	case "stalled_uploading":
+		return t.State == "stalledUP"
+	case "checking":
+		return t.State == "checkingDL" || t.State == "checkingUP"
+	case "errored":
+		return t.State == "error"
+	}
+	return false
+}
+
+// hashSet parses a "hashes" parameter, hashes separated by '|' or "all",
+// it returns nil for "all".
+func hashSet(s string) map[string]bool {
+	if s == "all" {
+		return nil
+	}
+
+	set := make(map[string]bool)
+	for _, hash := range strings.Split(s, "|") {
+		if hash != "" {
+			set[strings.ToUpper(hash)] = true
+		}
+	}
+	return set
+}
+
+// selectTorrents returns the torrents named by the "hashes" form value.
+func (h *Handler) selectTorrents(r *http.Request) (rtapi.Torrents, error) {
+	set := hashSet(r.FormValue("hashes"))
+
+	torrents, err := h.rt.Torrents()
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return torrents, nil
+	}
+
+	selected := make(rtapi.Torrents, 0, len(set))
+	for _, t := range torrents {
+		if set[t.Hash] {
+			selected = append(selected, t)
+		}
+	}
+	return selected, nil
+}
+
+func (h *Handler) handleInfo(w http.ResponseWriter, r *http.Request) {
+	torrents, err := h.rt.Torrents()
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	r.ParseForm()
+	filter, category := r.Form.Get("filter"), r.Form.Get("category")
+	_, byCategory := r.Form["category"]
+
+	var hashes map[string]bool
+	if s := r.Form.Get("hashes"); s != "" {
+		hashes = hashSet(s)
+	}
+
+	list := make([]*Torrent, 0, len(torrents))
+	for _, t := range torrents {
+		v := newTorrent(t)
+		if !matchFilter(v, filter) {
+			continue
+		}
+		// an empty category asks for torrents without one.
+		if byCategory && v.Category != category {
+			continue
+		}
+		if hashes != nil && !hashes[t.Hash] {
+			continue
+		}
+		list = append(list, v)
+	}
+
+	sortTorrents(list, r.FormValue("sort"), r.FormValue("reverse") == "true")
+
+	offset, _ := strconv.Atoi(r.FormValue("offset"))
+	if offset < 0 {
+		offset += len(list)
+	}
+	if offset > 0 && offset <= len(list) {
+		list = list[offset:]
+	}
+	if limit, _ := strconv.Atoi(r.FormValue("limit")); limit > 0 && limit < len(list) {
+		list = list[:limit]
+	}
+
+	writeJSON(w, list)
+}
+
+// sortTorrents sorts by a torrents/info field name, unknown fields keep the
+// order of rTorrent.
+func sortTorrents(list []*Torrent, field string, reverse bool) {
+	var less func(a, b *Torrent) bool
+	switch field {
+	case "name":
+		less = func(a, b *Torrent) bool { return a.Name < b.Name }
+	case "size", "total_size":
+		less = func(a, b *Torrent) bool { return a.Size < b.Size }
+	case "progress":
+		less = func(a, b *Torrent) bool { return a.Progress < b.Progress }
+	case "dlspeed":
+		less = func(a, b *Torrent) bool { return a.DLSpeed < b.DLSpeed }
+	case "upspeed":
+		less = func(a, b *Torrent) bool { return a.UPSpeed < b.UPSpeed }
+	case "ratio":
+		less = func(a, b *Torrent) bool { return a.Ratio < b.Ratio }
+	case "eta":
+		less = func(a, b *Torrent) bool { return a.ETA < b.ETA }
+	case "added_on":
+		less = func(a, b *Torrent) bool { return a.AddedOn < b.AddedOn }
+	case "uploaded":
+		less = func(a, b *Torrent) bool { return a.Uploaded < b.Uploaded }
+	case "category":
+		less = func(a, b *Torrent) bool { return a.Category < b.Category }
+	case "state":
+		less = func(a, b *Torrent) bool { return a.State < b.State }
+	default:
+		if reverse {
+			for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+				list[i], list[j] = list[j], list[i]
+			}
+		}
+		return
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		if reverse {
+			return less(list[j], list[i])
+		}
+		return less(list[i], list[j])
+	})
+}
+
+func (h *Handler) handleAdd(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAddSize)
+	if err := r.ParseMultipartForm(maxAddSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var files [][]byte
+	if r.MultipartForm != nil {
+		for _, fh := range r.MultipartForm.File["torrents"] {
+			data, err := readFile(fh)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			files = append(files, data)
+		}
+	}
+
+	var urls []string
+	for _, line := range strings.Split(r.FormValue("urls"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			urls = append(urls, line)
+		}
+	}
+	if len(urls) == 0 && len(files) == 0 {
+		io.WriteString(w, "Fails.")
+		return
+	}
+
+	dir, category := r.FormValue("savepath"), r.FormValue("category")
+	add := func(link string, data []byte) error {
+		switch {
+		case dir != "" || category != "":
+			return h.rt.DownloadWithOptions(&rtapi.DotTorrentWithOptions{
+				Link:  link,
+				Data:  data,
+				Dir:   dir,
+				Label: category,
+			})
+		case data != nil:
+			return h.rt.DownloadRaw(data)
+		default:
+			return h.rt.Download(link)
+		}
+	}
+
+	for _, data := range files {
+		if err := add("", data); err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+	}
+	for _, link := range urls {
+		if err := add(link, nil); err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+	}
+	io.WriteString(w, "Ok.")
+}
+
+// readFile reads an uploaded .torrent file.
+func readFile(fh *multipart.FileHeader) ([]byte, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (h *Handler) handleAction(action func(...*rtapi.Torrent) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		torrents, err := h.selectTorrents(r)
+		if err == nil && len(torrents) > 0 {
+			err = action(torrents...)
+		}
+		if err != nil {
+			writeUpstreamError(w, err)
+		}
+	}
+}
+
+// handleForceStart force starts the torrents when value is true, rTorrent
+// has no force flag to clear otherwise.
+func (h *Handler) handleForceStart(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("value") != "true" {
+		return
+	}
+	h.handleAction(h.rt.ForceStart)(w, r)
+}
+
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	torrents, err := h.selectTorrents(r)
+	if err == nil && len(torrents) > 0 {
+		err = h.rt.Delete(r.FormValue("deleteFiles") == "true", torrents...)
+	}
+	if err != nil {
+		writeUpstreamError(w, err)
+	}
+}
+
+func (h *Handler) handleSetCategory(w http.ResponseWriter, r *http.Request) {
+	torrents, err := h.selectTorrents(r)
+	if err == nil && len(torrents) > 0 {
+		err = h.rt.SetLabel(r.FormValue("category"), torrents...)
+	}
+	if err != nil {
+		writeUpstreamError(w, err)
+	}
+}
+
+// handleCreateCategory accepts any category, labels exist in rTorrent as
+// soon as a torrent uses them.
+func (h *Handler) handleCreateCategory(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("category") == "" {
+		http.Error(w, "category is required", http.StatusBadRequest)
+		return
+	}
+}
+
+// category is an entry of torrents/categories.
+type category struct {
+	Name     string `json:"name"`
+	SavePath string `json:"savePath"`
+}
+
+func (h *Handler) handleCategories(w http.ResponseWriter, r *http.Request) {
+	torrents, err := h.rt.Torrents()
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	categories := make(map[string]category)
+	for _, t := range torrents {
+		if t.Label != "" {
+			categories[t.Label] = category{Name: t.Label}
+		}
+	}
+	writeJSON(w, categories)
+}
+
+func (h *Handler) handlePreferences(w http.ResponseWriter, r *http.Request) {
+	st, err := h.rt.Stats()
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"save_path":   st.Directory,
+		"listen_port": st.Port,
+		"dl_limit":    st.ThrottleDown,
+		"up_limit":    st.ThrottleUp,
+	})
+}
+
+// TransferInfo is the response of transfer/info.
+type TransferInfo struct {
+	DLInfoSpeed      uint64 `json:"dl_info_speed"`
+	DLInfoData       uint64 `json:"dl_info_data"`
+	UPInfoSpeed      uint64 `json:"up_info_speed"`
+	UPInfoData       uint64 `json:"up_info_data"`
+	DLRateLimit      uint64 `json:"dl_rate_limit"`
+	UPRateLimit      uint64 `json:"up_rate_limit"`
+	DHTNodes         uint64 `json:"dht_nodes"`
+	ConnectionStatus string `json:"connection_status"`
+}
+
+func (h *Handler) handleTransferInfo(w http.ResponseWriter, r *http.Request) {
+	st, err := h.rt.Stats()
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	tr, err := h.rt.Transfer(r.Context())
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	writeJSON(w, &TransferInfo{
+		DLInfoSpeed:      tr.DownRate,
+		DLInfoData:       st.TotalDown,
+		UPInfoSpeed:      tr.UpRate,
+		UPInfoData:       st.TotalUp,
+		DLRateLimit:      st.ThrottleDown,
+		UPRateLimit:      st.ThrottleUp,
+		DHTNodes:         uint64(st.DHT.Nodes),
+		ConnectionStatus: "connected",
+	})
+}
@@ -0,0 +1,260 @@
+package rtapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy says how requests which failed to reach rTorrent are retried,
+// e.g. while it restarts. Faults rTorrent answered with are never retried.
+type RetryPolicy struct {
+	MaxAttempts int           // including the first one, 1 or less disables retries
+	BaseDelay   time.Duration // before the first retry, doubled for each of the next
+	MaxDelay    time.Duration // cap of the delay, zero means no cap
+
+	// Actions makes actions like Start or Download retried too. They may
+	// then run twice, when rTorrent ran them but the answer was lost.
+	Actions bool
+}
+
+// DefaultRetryPolicy retries reads for about a second and a half.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+}
+
+// WithRetry makes the client retry failed requests as p says.
+func WithRetry(p RetryPolicy) Option {
+	return func(r *Rtorrent) {
+		r.retry = &p
+	}
+}
+
+// backoff returns the delay before the nth retry, n starting at 1, with
+// half of it random so that clients don't retry in lockstep.
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// errEmptyResponse is returned when rTorrent closed the connection without
+// answering, which it does when it's shutting down.
+var errEmptyResponse = errors.New("rtapi: empty response")
+
+// transient reports whether err means rTorrent couldn't be reached, as
+// opposed to an answer which couldn't be used.
+func transient(err error) bool {
+	var netErr net.Error
+	var statusErr *httpStatusError
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false // the caller gave up, rTorrent may be fine
+	case errors.Is(err, errEmptyResponse),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, syscall.ENOENT): // unix socket not created yet
+		return true
+	case errors.As(err, &statusErr):
+		return statusErr.code == 502 || statusErr.code == 503 || statusErr.code == 504
+	case errors.As(err, &netErr):
+		return true
+	}
+	return false
+}
+
+// finalError stops do from retrying, e.g. once TorrentsIter handed out
+// torrents.
+type finalError struct{ err error }
+
+func (e *finalError) Error() string { return e.err.Error() }
+func (e *finalError) Unwrap() error { return e.err }
+
+// do sends req and hands the answer to read, retrying and going through the
+// circuit breaker as configured. idempotent requests are retried by
+// default, others only with RetryPolicy.Actions. The breaker sees one
+// outcome per request, once its retries are over.
+func (r *Rtorrent) do(ctx context.Context, req xmlrpcMethodCall, idempotent bool, read func(io.Reader) error) error {
+	if err := r.breaker.allow(ctx); err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err := r.attempt(ctx, req, read)
+
+		var final *finalError
+		if errors.As(err, &final) {
+			r.breaker.record(final.err)
+			return final.err
+		}
+		if err == nil || !transient(err) || ctx.Err() != nil {
+			r.breaker.record(err)
+			return err
+		}
+		if !r.retries(idempotent, attempt) {
+			r.breaker.record(err)
+			return &unreachableError{err}
+		}
+
+		t := time.NewTimer(r.retry.backoff(attempt))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			r.breaker.record(ctx.Err())
+			return &unreachableError{err}
+		}
+	}
+}
+
+func (r *Rtorrent) attempt(ctx context.Context, req xmlrpcMethodCall, read func(io.Reader) error) error {
+	body, err := r.roundTrip(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// unblock a pending read when ctx is done.
+	stop := context.AfterFunc(ctx, func() { body.Close() })
+	defer stop()
+
+	return read(body)
+}
+
+// retries reports whether the request may be sent again after attempt tries.
+func (r *Rtorrent) retries(idempotent bool, attempt int) bool {
+	return r.retry != nil && (idempotent || r.retry.Actions) && attempt < r.retry.MaxAttempts
+}
+
+// BreakerState is the state of the circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // requests go through
+	BreakerOpen                         // requests fail with ErrCircuitOpen
+	BreakerHalfOpen                     // one request probes whether rTorrent is back
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen is returned without contacting rTorrent while the circuit
+// breaker is open. It matches ErrUnreachable.
+var ErrCircuitOpen error = &unreachableError{errors.New("rtapi: circuit breaker open, rTorrent is unreachable")}
+
+// WithCircuitBreaker opens the circuit after failures requests in a row
+// couldn't reach rTorrent, each counted once its retries ran out. Requests then fail fast with
+// ErrCircuitOpen until cooldown passed, when a single request is let
+// through to probe rTorrent; its success closes the circuit again.
+func WithCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(r *Rtorrent) {
+		r.breaker = &breaker{threshold: failures, cooldown: cooldown, now: time.Now}
+	}
+}
+
+// BreakerState returns the state of the circuit breaker, for health checks.
+// It is always BreakerClosed without WithCircuitBreaker.
+func (r *Rtorrent) BreakerState() BreakerState {
+	return r.breaker.state()
+}
+
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	current  BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow returns ErrCircuitOpen if the request must not be sent. Nested
+// requests are part of the probe of their caller while half-open.
+func (b *breaker) allow(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current == BreakerOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		b.current = BreakerHalfOpen
+	}
+	switch {
+	case b.current == BreakerOpen:
+		return ErrCircuitOpen
+	case b.current == BreakerHalfOpen && ctx.Value(nestedKey{}) != nil:
+		return nil
+	case b.current == BreakerHalfOpen && b.probing:
+		return ErrCircuitOpen
+	case b.current == BreakerHalfOpen:
+		b.probing = true
+	}
+	return nil
+}
+
+// record counts the outcome of a request allowed through, after its last
+// attempt.
+func (b *breaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return // says nothing about rTorrent
+	}
+	if err == nil || !transient(err) {
+		b.current = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.current == BreakerHalfOpen || b.failures >= b.threshold {
+		b.current = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+func (b *breaker) state() BreakerState {
+	if b == nil {
+		return BreakerClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.current == BreakerOpen && b.now().Sub(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.current
+}
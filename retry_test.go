@@ -0,0 +1,264 @@
+package rtapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pyed/rtapi/rtapitest"
+)
+
+func newRetryServer(t *testing.T) *rtapitest.Server {
+	t.Helper()
+
+	fake := rtapitest.NewServer()
+	t.Cleanup(fake.Close)
+	fake.AddTorrent(&rtapitest.Torrent{
+		Hash:     "8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648",
+		Name:     "ubuntu.iso",
+		Size:     1 << 20,
+		Trackers: []rtapitest.Tracker{{URL: "http://torrent.ubuntu.com:6969/announce"}},
+	})
+	return fake
+}
+
+func TestRetry(t *testing.T) {
+	fake := newRetryServer(t)
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	rt, err := NewRtorrent(fake.Addr, WithRetry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Hangup(2)
+	torrents, err := rt.Torrents()
+	if err != nil {
+		t.Fatalf("Expected the read to be retried, got: %v", err)
+	}
+
+	fake.Hangup(3)
+	if _, err := rt.Torrents(); err == nil {
+		t.Error("Expected an error after 3 attempts")
+	}
+
+	fake.Hangup(1)
+	if err := rt.Start(torrents...); err == nil {
+		t.Error("Expected actions not to be retried by default")
+	}
+	fake.Hangup(1)
+	if _, err := rt.Call("d.start", torrents[0].Hash); err == nil {
+		t.Error("Expected Call not to be retried by default")
+	}
+
+	policy.Actions = true
+	rt, _ = NewRtorrent(fake.Addr, WithRetry(policy))
+	fake.Hangup(1)
+	if err := rt.Start(torrents...); err != nil {
+		t.Errorf("Expected the action to be retried, got: %v", err)
+	}
+
+	fake.ResetCalls()
+	fake.SetFault("d.multicall2", -501, "Could not find info-hash.")
+	if _, err := rt.Torrents(); err == nil {
+		t.Error("Expected the fault")
+	}
+	if n := fake.CallCount("d.multicall2"); n != 1 {
+		t.Errorf("Expected faults not to be retried, got %d calls", n)
+	}
+}
+
+func TestRetryContext(t *testing.T) {
+	fake := newRetryServer(t)
+	rt, err := NewRtorrent(fake.Addr, WithRetry(RetryPolicy{MaxAttempts: 10, BaseDelay: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Hangup(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := rt.TorrentsIter(ctx, func(*Torrent) error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the backoff to stop with the context, took: %s", elapsed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	testCases := []struct {
+		n   int
+		max time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+
+	for _, test := range testCases {
+		for i := 0; i < 20; i++ {
+			if d := p.backoff(test.n); d < test.max/2 || d > test.max {
+				t.Errorf("Retry %d: Expected a delay between %s and %s, got: %s", test.n, test.max/2, test.max, d)
+			}
+		}
+	}
+
+	if d := (&RetryPolicy{}).backoff(3); d != 0 {
+		t.Errorf("Expected no delay without BaseDelay, got: %s", d)
+	}
+}
+
+func TestTransient(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{fmt.Errorf("rtapi: read response: %w", syscall.ECONNRESET), true},
+		{errEmptyResponse, true},
+		{io.ErrUnexpectedEOF, true},
+		{&httpStatusError{code: 502}, true},
+		{&httpStatusError{code: 401}, false},
+		{&net.OpError{Op: "dial", Err: context.Canceled}, false},
+		{context.DeadlineExceeded, false},
+		{errors.New("rtapi: expected array value"), false},
+	}
+
+	for i, test := range testCases {
+		if got := transient(test.err); got != test.expected {
+			t.Errorf("Case %d: Expected %t for %v, got: %t", i, test.expected, test.err, got)
+		}
+	}
+}
+
+// flakyTransport refuses connections while down.
+type flakyTransport struct {
+	Transport
+	down  atomic.Bool
+	calls atomic.Int32
+}
+
+func (t *flakyTransport) RoundTrip(ctx context.Context, body []byte) (io.ReadCloser, error) {
+	t.calls.Add(1)
+	if t.down.Load() {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	}
+	return t.Transport.RoundTrip(ctx, body)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	fake := newRetryServer(t)
+	flaky := &flakyTransport{Transport: &SCGITransport{Network: fake.Network, Address: fake.Addr}}
+	rt, err := NewRtorrent(fake.Addr, WithTransport(flaky), WithCircuitBreaker(2, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rt.breaker.now = func() time.Time { return now }
+
+	if got := rt.BreakerState(); got != BreakerClosed {
+		t.Errorf("Expected the breaker to be closed, got: %s", got)
+	}
+
+	flaky.down.Store(true)
+	for i := 0; i < 2; i++ {
+		if _, err := rt.Torrents(); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("Expected the dial error, got: %v", err)
+		}
+	}
+	if got := rt.BreakerState(); got != BreakerOpen {
+		t.Errorf("Expected the breaker to be open, got: %s", got)
+	}
+
+	calls := flaky.calls.Load()
+	if _, err := rt.Torrents(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got: %v", err)
+	}
+	if flaky.calls.Load() != calls {
+		t.Error("Expected rTorrent not to be contacted while the breaker is open")
+	}
+
+	// a failed probe opens the circuit again.
+	now = now.Add(time.Minute)
+	if got := rt.BreakerState(); got != BreakerHalfOpen {
+		t.Errorf("Expected the breaker to be half-open, got: %s", got)
+	}
+	if _, err := rt.Torrents(); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the probe to fail with the dial error, got: %v", err)
+	}
+	if got := rt.BreakerState(); got != BreakerOpen {
+		t.Errorf("Expected the breaker to be open after a failed probe, got: %s", got)
+	}
+
+	now = now.Add(time.Minute)
+	flaky.down.Store(false)
+	if _, err := rt.Torrents(); err != nil {
+		t.Errorf("Expected the probe to succeed, got: %v", err)
+	}
+	if got := rt.BreakerState(); got != BreakerClosed {
+		t.Errorf("Expected the breaker to be closed, got: %s", got)
+	}
+}
+
+func TestCircuitBreakerRetries(t *testing.T) {
+	fake := newRetryServer(t)
+	flaky := &flakyTransport{Transport: &SCGITransport{Network: fake.Network, Address: fake.Addr}}
+	rt, err := NewRtorrent(fake.Addr, WithTransport(flaky),
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+		WithCircuitBreaker(2, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the retries of a request count as a single failure.
+	flaky.down.Store(true)
+	calls := flaky.calls.Load()
+	if _, err := rt.Torrents(); !errors.Is(err, ErrUnreachable) || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the dial error, got: %v", err)
+	}
+	if got := flaky.calls.Load() - calls; got != 3 {
+		t.Errorf("Expected 3 attempts, got: %d", got)
+	}
+	if got := rt.BreakerState(); got != BreakerClosed {
+		t.Errorf("Expected the breaker to be closed after one failed request, got: %s", got)
+	}
+
+	if _, err := rt.Torrents(); !errors.Is(err, ErrUnreachable) || errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the dial error, got: %v", err)
+	}
+	if got := rt.BreakerState(); got != BreakerOpen {
+		t.Errorf("Expected the breaker to be open after two failed requests, got: %s", got)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	now := time.Now()
+	b := &breaker{threshold: 1, cooldown: time.Second, now: func() time.Time { return now }}
+
+	b.record(syscall.ECONNREFUSED)
+	now = now.Add(time.Second)
+	if err := b.allow(context.Background()); err != nil {
+		t.Fatalf("Expected the probe to be allowed, got: %v", err)
+	}
+	if err := b.allow(context.Background()); err != ErrCircuitOpen {
+		t.Errorf("Expected a single probe at a time, got: %v", err)
+	}
+
+	// faults prove rTorrent is up.
+	b.record(errors.New("rtapi: xmlrpc fault"))
+	if got := b.state(); got != BreakerClosed {
+		t.Errorf("Expected the breaker to be closed, got: %s", got)
+	}
+}
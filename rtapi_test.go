@@ -2,16 +2,26 @@ package rtapi
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/pyed/rtapi/rtapitest"
 )
 
 const (
@@ -25,68 +35,67 @@ var (
 	downloadReq            = mustBuildDownloadRequest(testDownloadURL)
 	downloadWithOptionsReq = mustBuildDownloadWithOptionsRequest(testDownloadURL, testDownloadDir, testDownloadLabel)
 	torrentsReq            = mustBuildTorrentsRequest()
-	speedsReq              = mustBuildSpeedsRequest()
+	transferReq            = mustBuildTransferRequest()
 	statsReq               = mustBuildStatsRequest()
 	versionReq             = mustBuildVersionRequest()
+	callReq                = mustBuildCallRequest("system.client_version", "")
+	listMethodsReq         = mustBuildCallRequest("system.listMethods")
+
+	testTorrentData           = []byte("d8:announce0:4:infod6:lengthi1e4:name8:file.iso12:piece lengthi1e6:pieces0:ee")
+	downloadRawReq            = mustBuildRequest(buildDownloadRawRequest(testTorrentData))
+	downloadRawWithOptionsReq = mustBuildRequest(buildDownloadRawRequest(testTorrentData,
+		"d.directory.set="+quoteArg(testDownloadDir), "d.custom1.set="+commandArg(testDownloadLabel)))
 )
 
 func mustBuildDownloadRequest(url string) string {
-	req, err := buildDownloadRequest(url)
-	if err != nil {
-		panic(err)
-	}
-	return req
+	return mustBuildRequest(buildDownloadRequest(url))
 }
 
 func mustBuildDownloadWithOptionsRequest(link, dir, label string) string {
-	req, err := buildDownloadWithOptionsRequest(link, dir, label)
-	if err != nil {
-		panic(err)
-	}
-	return req
+	return mustBuildRequest(buildDownloadWithOptionsRequest(link, dir, label))
 }
 
 func mustBuildTorrentsRequest() string {
-	req, err := buildTorrentsRequest()
-	if err != nil {
-		panic(err)
-	}
-	return req
+	return mustBuildRequest(buildTorrentsRequest())
 }
 
 func mustBuildSystemMulticallRequest(method string, params ...string) string {
-	req, err := buildSystemMulticallRequest(method, params...)
-	if err != nil {
-		panic(err)
-	}
-	return req
+	return mustBuildRequest(buildSystemMulticallRequest(method, params...))
 }
 
-func mustBuildSpeedsRequest() string {
-	req, err := buildSpeedsRequest()
-	if err != nil {
-		panic(err)
-	}
-	return req
+func mustBuildTransferRequest() string {
+	return mustBuildRequest(buildTransferRequest())
 }
 
 func mustBuildStatsRequest() string {
-	req, err := buildStatsRequest()
-	if err != nil {
-		panic(err)
-	}
-	return req
+	return mustBuildRequest(buildStatsRequest())
 }
 
 func mustBuildVersionRequest() string {
-	req, err := buildVersionRequest()
+	return mustBuildRequest(buildVersionRequest())
+}
+
+func mustBuildCallRequest(method string, params ...string) string {
+	return mustBuildRequest(buildCallRequest(method, params...))
+}
+
+// mustBuildRequest encodes req as XML-RPC, which the canned server expects.
+func mustBuildRequest(req xmlrpcMethodCall) string {
+	payload, err := marshalMethodCall(req)
 	if err != nil {
 		panic(err)
 	}
-	return req
+	return payload
 }
 
 func TestMain(m *testing.M) {
+	// fuzzing workers run in processes of their own and only need the
+	// fuzz targets, the test server is already listening in the parent.
+	flag.Parse()
+	if worker := flag.Lookup("test.fuzzworker"); worker != nil && worker.Value.String() == "true" {
+		os.Exit(m.Run())
+	}
+
 	listener, err := net.Listen("tcp", testAddress)
 	if err != nil {
 		log.Fatal(err)
@@ -126,48 +135,65 @@ var testCases = Torrents{
 		Hash:      "1C60CBECF4C632EDC7AB546623454B33A295CCEA",
 		DownRate:  0,
 		UpRate:    0,
-		Size:      996 * 262144,
-		Completed: 792 * 262144,
+		Size:      261031936,
+		Completed: 207618048,
 		Percent:   "79.5%",
+		Progress:  207618048.0 / 261031936,
 		ETA:       0,
 		Ratio:     1.29,
 		UpTotal:   267827281,
+		DownTotal: 207618048,
 		State:     Error,
+		Flags:     StateFlags{Open: true, Active: true, Started: true},
 		Age:       1492000001,
+		AddedAt:   time.Unix(1492000001, 0),
+		CreatedAt: time.Unix(1491000000, 0),
 		Message:   `Tracker: [Failure reason "Requested download is .......... difficult to install. --linus."]`,
 		Tracker:   tr0,
 		Path:      "/Users/abdulelah/rtorrent/download/debian-mac-8.7.1-amd64-netinst.iso",
 	},
 	&Torrent{
-		Name:      "ubuntu-17.04-server-amd64.iso",
-		Hash:      "8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648",
-		DownRate:  0,
-		UpRate:    0,
-		Size:      1370 * 524288,
-		Completed: 1370 * 524288,
-		Percent:   "100%",
-		ETA:       0,
-		Ratio:     0,
-		UpTotal:   0,
-		State:     Seeding,
-		Age:       1492032019,
-		Message:   "",
-		Tracker:   tr1,
-		Path:      "/Users/abdulelah/rtorrent/download/ubuntu-17.04-server-amd64.iso",
+		Name:       "ubuntu-17.04-server-amd64.iso",
+		Hash:       "8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648",
+		DownRate:   0,
+		UpRate:     0,
+		Size:       718203904,
+		Completed:  718203904,
+		Percent:    "100%",
+		Progress:   1,
+		ETA:        0,
+		Ratio:      0,
+		UpTotal:    0,
+		DownTotal:  718203904,
+		State:      Seeding,
+		Flags:      StateFlags{Open: true, Active: true, Started: true, Complete: true},
+		Age:        1492032019,
+		AddedAt:    time.Unix(1492032019, 0),
+		FinishedAt: time.Unix(1492035619, 0),
+		CreatedAt:  time.Unix(1491900000, 0),
+		Message:    "",
+		Tracker:    tr1,
+		Path:       "/Users/abdulelah/rtorrent/download/ubuntu-17.04-server-amd64.iso",
 	},
 	&Torrent{
 		Name:      "archlinux-2017.04.01-x86_64.iso",
 		Hash:      "02CA77A6A047FD37F04337437D18F82E61861084",
 		DownRate:  997035,
 		UpRate:    0,
-		Size:      956 * 524288,
-		Completed: 115 * 524288,
+		Size:      500727808,
+		Completed: 60293120,
 		Percent:   "12.0%",
-		ETA:       442,
+		Progress:  60293120.0 / 500727808,
+		ETA:       441,
+		TimeLeft:  441 * time.Second,
 		Ratio:     0,
 		UpTotal:   0,
+		DownTotal: 60293120,
 		State:     Leeching,
+		Flags:     StateFlags{Open: true, Active: true, Started: true},
 		Age:       1492031149,
+		AddedAt:   time.Unix(1492031149, 0),
+		CreatedAt: time.Unix(1490000000, 0),
 		Message:   "",
 		Tracker:   tr2,
 		Path:      "/Users/abdulelah/rtorrent/download/archlinux-2017.04.01-x86_64.iso",
@@ -175,11 +201,19 @@ var testCases = Torrents{
 }
 
 var (
-	stopReq     = mustBuildSystemMulticallRequest("d.stop", testCases[0].Hash)
-	startReq    = mustBuildSystemMulticallRequest("d.start", testCases[0].Hash)
-	checkReq    = mustBuildSystemMulticallRequest("d.check_hash", testCases[0].Hash)
-	deleteReq   = mustBuildSystemMulticallRequest("d.erase", testCases[0].Hash)
-	trackersReq = mustBuildSystemMulticallRequest(
+	filesReq       = mustBuildRequest(buildFilesRequest(testCases[2].Hash))
+	trackerListReq = mustBuildRequest(buildTrackersRequest(testCases[2].Hash))
+	peersReq       = mustBuildRequest(buildPeersRequest(testCases[2].Hash))
+)
+
+var (
+	stopReq       = mustBuildSystemMulticallRequest("d.stop", testCases[0].Hash)
+	startReq      = mustBuildSystemMulticallRequest("d.start", testCases[0].Hash)
+	checkReq      = mustBuildSystemMulticallRequest("d.check_hash", testCases[0].Hash)
+	deleteReq     = mustBuildSystemMulticallRequest("d.erase", testCases[0].Hash)
+	setLabelReq   = mustBuildRequest(buildSetLabelRequest(testDownloadLabel, testCases[0].Hash))
+	getTorrentReq = mustBuildRequest(buildGetTorrentsRequest(testCases[2].Hash))
+	trackersReq   = mustBuildSystemMulticallRequest(
 		"t.url",
 		testCases[0].Hash+":t0",
 		testCases[1].Hash+":t0",
@@ -188,10 +222,7 @@ var (
 )
 
 func TestBuildTorrentsRequest(t *testing.T) {
-	req, err := buildTorrentsRequest()
-	if err != nil {
-		t.Fatalf("buildTorrentsRequest() returned error: %v", err)
-	}
+	req := mustBuildRequest(buildTorrentsRequest())
 
 	if !strings.HasPrefix(req, xml.Header) {
 		t.Fatalf("expected XML header prefix in %q", req)
@@ -226,6 +257,15 @@ func TestBuildTorrentsRequest(t *testing.T) {
 		"d.complete=",
 		"d.hashing=",
 		"d.custom1=",
+		"d.timestamp.finished=",
+		"d.creation_date=",
+		"d.size_bytes=",
+		"d.completed_bytes=",
+		"d.up.total=",
+		"d.down.total=",
+		"d.is_open=",
+		"d.state=",
+		"d.is_hash_checking=",
 	}
 
 	if len(call.Params) != len(expectedFields) {
@@ -243,10 +283,7 @@ func TestBuildTorrentsRequest(t *testing.T) {
 }
 
 func TestBuildDownloadRequest(t *testing.T) {
-	req, err := buildDownloadRequest(testDownloadURL)
-	if err != nil {
-		t.Fatalf("buildDownloadRequest() returned error: %v", err)
-	}
+	req := mustBuildRequest(buildDownloadRequest(testDownloadURL))
 
 	if !strings.HasPrefix(req, xml.Header) {
 		t.Fatalf("expected XML header prefix in %q", req)
@@ -278,10 +315,7 @@ func TestBuildDownloadRequest(t *testing.T) {
 }
 
 func TestBuildDownloadWithOptionsRequest(t *testing.T) {
-	req, err := buildDownloadWithOptionsRequest(testDownloadURL, testDownloadDir, testDownloadLabel)
-	if err != nil {
-		t.Fatalf("buildDownloadWithOptionsRequest() returned error: %v", err)
-	}
+	req := mustBuildRequest(buildDownloadWithOptionsRequest(testDownloadURL, testDownloadDir, testDownloadLabel))
 
 	if !strings.HasPrefix(req, xml.Header) {
 		t.Fatalf("expected XML header prefix in %q", req)
@@ -358,11 +392,8 @@ func TestBuildDownloadWithOptionsRequest(t *testing.T) {
 	}
 }
 
-func TestBuildSpeedsRequest(t *testing.T) {
-	req, err := buildSpeedsRequest()
-	if err != nil {
-		t.Fatalf("buildSpeedsRequest() returned error: %v", err)
-	}
+func TestBuildTransferRequest(t *testing.T) {
+	req := mustBuildRequest(buildTransferRequest())
 
 	if !strings.HasPrefix(req, xml.Header) {
 		t.Fatalf("expected XML header prefix in %q", req)
@@ -393,6 +424,10 @@ func TestBuildSpeedsRequest(t *testing.T) {
 	}{
 		{"throttle.global_down.rate", []string{""}},
 		{"throttle.global_up.rate", []string{""}},
+		{"throttle.global_down.max_rate", []string{""}},
+		{"throttle.global_up.max_rate", []string{""}},
+		{"throttle.global_down.total", []string{""}},
+		{"throttle.global_up.total", []string{""}},
 	}
 
 	if len(array.Values) != len(expected) {
@@ -443,10 +478,7 @@ func TestBuildSpeedsRequest(t *testing.T) {
 }
 
 func TestBuildStatsRequest(t *testing.T) {
-	req, err := buildStatsRequest()
-	if err != nil {
-		t.Fatalf("buildStatsRequest() returned error: %v", err)
-	}
+	req := mustBuildRequest(buildStatsRequest())
 
 	if !strings.HasPrefix(req, xml.Header) {
 		t.Fatalf("expected XML header prefix in %q", req)
@@ -481,6 +513,22 @@ func TestBuildStatsRequest(t *testing.T) {
 		{"throttle.global_down.total", nil},
 		{"network.listen.port", nil},
 		{"directory.default", nil},
+		{"network.open_sockets", nil},
+		{"network.max_open_sockets", nil},
+		{"throttle.max_peers.normal", nil},
+		{"throttle.max_peers.seed", nil},
+		{"dht.statistics", nil},
+		{"pieces.memory.current", nil},
+		{"pieces.memory.max", nil},
+		{"system.startup_time", nil},
+		{"system.time_seconds", nil},
+		{"d.multicall2", []string{"", "main", "d.directory=", "d.free_diskspace="}},
+	}
+	for _, view := range countViews {
+		expected = append(expected, struct {
+			method string
+			params []string
+		}{"view.size", []string{"", view}})
 	}
 
 	if len(array.Values) != len(expected) {
@@ -532,10 +580,7 @@ func TestBuildStatsRequest(t *testing.T) {
 }
 
 func TestBuildVersionRequest(t *testing.T) {
-	req, err := buildVersionRequest()
-	if err != nil {
-		t.Fatalf("buildVersionRequest() returned error: %v", err)
-	}
+	req := mustBuildRequest(buildVersionRequest())
 
 	if !strings.HasPrefix(req, xml.Header) {
 		t.Fatalf("expected XML header prefix in %q", req)
@@ -632,6 +677,133 @@ func TestTorrents(t *testing.T) {
 	}
 }
 
+func TestTorrentsIter(t *testing.T) {
+	var torrents Torrents
+	err := rt.TorrentsIter(context.Background(), func(torrent *Torrent) error {
+		torrents = append(torrents, torrent)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(torrents) != len(testCases) {
+		t.Fatalf("Expected %d torrents, got: %d", len(testCases), len(torrents))
+	}
+	for i := range torrents {
+		if !match(torrents[i], testCases[i]) {
+			t.Errorf("Expected torrents[%d] and testCases[%d] to be equal, got: \n%v\n%v", i, i, torrents[i], testCases[i])
+		}
+	}
+
+	errStop := errors.New("stop")
+	var n int
+	err = rt.TorrentsIter(context.Background(), func(*Torrent) error {
+		n++
+		return errStop
+	})
+	if err != errStop || n != 1 {
+		t.Errorf("Expected the iteration to stop at the first error, got: %v after %d torrents", err, n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := rt.TorrentsIter(ctx, func(*Torrent) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestDecodeArrayResponse(t *testing.T) {
+	testCases := []struct {
+		resp   string
+		values int
+		err    string
+	}{
+		{torrentsResp, 3, ""},
+		{"<methodResponse><params><param><value><array><data></data></array></value></param></params></methodResponse>", 0, ""},
+		{"<methodResponse><params><param><value><string>x</string></value></param></params></methodResponse>", 0, "expected array value"},
+		{"<methodResponse><params></params></methodResponse>", 0, "missing params"},
+		{"<methodResponse><params><param><value><ex:array xmlns:ex=\"http://ws.apache.org/xmlrpc/namespaces/extensions\"><data><value><ex:i8>7</ex:i8></value><value><ex:nil/></value></data></ex:array></value></param></params></methodResponse>", 2, ""},
+		{"<methodResponse></methodResponse>", 0, "missing params"},
+		{"<methodResponse><fault><value><struct><member><name>faultString</name><value><string>Could not find info-hash.</string></value></member></struct></value></fault></methodResponse>", 0, "Could not find info-hash."},
+		{"<methodResponse><params><param><value><array><data><value>", 0, "unexpected EOF"},
+		{"no xml", 0, "xml response not found"},
+	}
+
+	for i, test := range testCases {
+		var n int
+		err := decodeArrayResponse(strings.NewReader(test.resp), func(xmlrpcValue) error {
+			n++
+			return nil
+		})
+		if test.err == "" && err != nil {
+			t.Errorf("Case %d: Expected no error, got: %v", i, err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("Case %d: Expected an error containing %q, got: %v", i, test.err, err)
+		}
+		if n != test.values {
+			t.Errorf("Case %d: Expected %d values, got: %d", i, test.values, n)
+		}
+	}
+}
+
+// TestDecodeArrayResponseXML checks that the streaming decoder reads the
+// less common XML the same as encoding/xml does.
+func TestDecodeArrayResponseXML(t *testing.T) {
+	resp := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- written by hand -->
+<methodResponse>
+<params><param><value><array><data>
+	<value><string>Caf&#233; &amp; &lt;more&gt; &quot;x&quot; &apos;y&apos;</string></value>
+	<value><string><![CDATA[<raw> & ]]>text</string></value>
+	<value>untyped</value>
+	<value/>
+	<value><string/></value>
+	<value><i4> -42 </i4></value>
+	<value><int>7</int></value>
+	<value><i8>9223372036854775807</i8></value>
+	<value><double>0.5</double></value>
+	<value><boolean>1</boolean></value>
+	<value><base64>aGk=</base64></value>
+	<value><ex:i8 xmlns:ex="http://ws.apache.org/xmlrpc/namespaces/extensions">7</ex:i8></value>
+	<value><ex:nil/></value>
+	<value><i8/></value>
+	<value><string a="x>y">line&#13;
+end</string><unknown>skipped</unknown></value>
+	<value><array><data><value><array><data><value><i8>1</i8></value></data></array></value><value><array/></value></data></array></value>
+	<value><struct><member><name>k</name><value><string>v</string></value></member></struct></value>
+</data></array></value></param></params>
+</methodResponse>`
+
+	want, err := decodeMethodResponse(strings.NewReader(resp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantValues, err := want.arrayParam()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []interface{}
+	err = decodeArrayResponse(strings.NewReader(resp), func(v xmlrpcValue) error {
+		got = append(got, v.native())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(wantValues) {
+		t.Fatalf("Expected %d values, got: %d", len(wantValues), len(got))
+	}
+	for i, v := range wantValues {
+		if !reflect.DeepEqual(got[i], v.native()) {
+			t.Errorf("Value %d: Expected %#v, got: %#v", i, v.native(), got[i])
+		}
+	}
+}
+
 func TestGetTorrent(t *testing.T) {
 	arch, err := rt.GetTorrent("02CA77A6A047FD37F04337437D18F82E61861084")
 	if err != nil {
@@ -643,6 +815,35 @@ func TestGetTorrent(t *testing.T) {
 	}
 }
 
+func TestGetTorrents(t *testing.T) {
+	fake := newRetryServer(t)
+	fake.AddTorrent(&rtapitest.Torrent{Hash: "02CA77A6A047FD37F04337437D18F82E61861084", Name: "archlinux.iso", Custom1: "Linux"})
+	rt, err := NewRtorrent(fake.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := rt.Torrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.ResetCalls()
+	torrents, err := rt.GetTorrents(all[1].Hash, "DEADBEEF", all[0].Hash)
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "DEADBEEF") {
+		t.Errorf("Expected ErrNotFound for DEADBEEF, got: %v", err)
+	}
+	if !reflect.DeepEqual(torrents, Torrents{all[1], all[0]}) {
+		t.Errorf("Expected %v, got: %v", Torrents{all[1], all[0]}, torrents)
+	}
+	if n := fake.CallCount("d.multicall2"); n != 0 {
+		t.Errorf("Expected the list not to be fetched, got %d calls", n)
+	}
+
+	if torrents, err := rt.GetTorrents(all[0].Hash); err != nil || len(torrents) != 1 {
+		t.Errorf("Expected 1 torrent, got: %v, %v", torrents, err)
+	}
+}
+
 func TestDownload(t *testing.T) {
 	if err := rt.Download(testDownloadURL); err != nil {
 		t.Fatal(err)
@@ -660,20 +861,49 @@ func TestDownloadWithOptions(t *testing.T) {
 	}
 }
 
+func TestDownloadRaw(t *testing.T) {
+	if err := rt.DownloadRaw(testTorrentData); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &DotTorrentWithOptions{
+		Data:  testTorrentData,
+		Dir:   testDownloadDir,
+		Label: testDownloadLabel,
+	}
+	if err := rt.DownloadWithOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestStop(t *testing.T) {
-	rt.Stop(testCases[0])
+	if err := rt.Stop(testCases[0]); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestStart(t *testing.T) {
-	rt.Start(testCases[0])
+	if err := rt.Start(testCases[0]); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestCheck(t *testing.T) {
-	rt.Check(testCases[0])
+	if err := rt.Check(testCases[0]); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestDelete(t *testing.T) {
-	rt.Delete(false, testCases[0])
+	if err := rt.Delete(false, testCases[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetLabel(t *testing.T) {
+	if err := rt.SetLabel(testDownloadLabel, testCases[0]); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestSpeeds(t *testing.T) {
@@ -691,25 +921,46 @@ func TestSpeeds(t *testing.T) {
 	}
 }
 
+func TestTransfer(t *testing.T) {
+	tr, err := rt.Transfer(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %s", err)
+	}
+
+	expected := &Transfer{DownRate: 336650, UpRate: 593, DownLimit: 0, UpLimit: 51200, DownTotal: 7476, UpTotal: 6841}
+	if *tr != *expected {
+		t.Errorf("Expected:\n%#v, got:\n%#v", expected, tr)
+	}
+}
+
 func TestStats(t *testing.T) {
 	st, err := rt.Stats()
 	if err != nil {
 		t.Errorf("Expected no error, got: %s", err)
 	}
 
-	stTestCase := &stats{
-		ThrottleUp:   0,
-		ThrottleDown: 0,
-		TotalUp:      6841,
-		TotalDown:    7476,
-		Port:         "6980",
-		Directory:    "/home/Downloads",
+	stTestCase := &SessionStats{
+		ThrottleUp:     0,
+		ThrottleDown:   0,
+		TotalUp:        6841,
+		TotalDown:      7476,
+		Port:           6980,
+		Directory:      "/home/Downloads",
+		OpenSockets:    12,
+		MaxOpenSockets: 0, // the command faulted
+		MaxPeers:       50,
+		MaxPeersSeed:   100,
+		DHT:            DHTStats{Mode: "auto", Active: true, Nodes: 143},
+		MemoryUsage:    4 << 20,
+		MaxMemory:      1 << 30,
+		FreeDiskSpace:  186999168 * 1024, // of the torrent in /home/Downloads
+		Uptime:         time.Hour,
+		Torrents:       TorrentCounts{Total: 3, Started: 2, Stopped: 1, Complete: 1, Incomplete: 2, Seeding: 1, Leeching: 0, Hashing: 0, Active: 1},
 	}
 
 	if *st != *stTestCase {
 		t.Errorf("Expected:\n%#v, got:\n%#v", stTestCase, st)
 	}
-
 }
 
 func TestVersion(t *testing.T) {
@@ -719,6 +970,256 @@ func TestVersion(t *testing.T) {
 	}
 }
 
+func TestFiles(t *testing.T) {
+	files, err := rt.Files(testCases[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []File{
+		{Path: "archlinux-2017.04.01-x86_64.iso", Size: 501219328, SizeChunks: 956, CompletedChunks: 115, Priority: 1},
+		{Path: "README", Size: 1024, SizeChunks: 1, CompletedChunks: 0, Priority: 0},
+	}
+
+	if len(files) != len(expected) {
+		t.Fatalf("Expected %d files, got: %d", len(expected), len(files))
+	}
+	for i := range files {
+		if *files[i] != expected[i] {
+			t.Errorf("Expected files[%d] to be %#v, got: %#v", i, expected[i], *files[i])
+		}
+	}
+}
+
+func TestTrackers(t *testing.T) {
+	trackers, err := rt.Trackers(testCases[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Tracker{URL: "udp://tracker.archlinux.org:6969", Enabled: true, Seeders: 120, Leechers: 7}
+	if len(trackers) != 1 || *trackers[0] != expected {
+		t.Errorf("Expected [%#v], got: %v", expected, trackers)
+	}
+}
+
+func TestPeers(t *testing.T) {
+	peers, err := rt.Peers(testCases[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Peer{Address: "10.0.0.2", Port: 51413, Client: "Transmission 2.92", DownRate: 997035, UpRate: 0, Percent: 100}
+	if len(peers) != 1 || *peers[0] != expected {
+		t.Errorf("Expected [%#v], got: %v", expected, peers)
+	}
+}
+
+func TestExtend(t *testing.T) {
+	fake := newRetryServer(t)
+	fake.AddTorrent(&rtapitest.Torrent{
+		Hash:           "02CA77A6A047FD37F04337437D18F82E61861084",
+		Name:           "archlinux",
+		Directory:      "/downloads/archlinux",
+		Size:           10 << 20,
+		Completed:      3<<20 + 1000,
+		UpTotal:        5 << 20,
+		Open:           true,
+		Priority:       3,
+		Private:        true,
+		MultiFile:      true,
+		Throttle:       "slow",
+		Skipped:        4096,
+		PeersComplete:  4,
+		PeersAccounted: 2,
+		Custom1:        "Linux",
+		Custom3:        "note",
+		Trackers: []rtapitest.Tracker{
+			{URL: "udp://tracker.archlinux.org:6969", Seeders: 120, Leechers: 7},
+			{URL: "udp://tracker.opentrackr.org:1337", Seeders: 80, Leechers: 9},
+		},
+	})
+	rt, err := NewRtorrent(fake.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torrents, err := rt.Torrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if torrents[0].Extended != nil {
+		t.Errorf("Expected Torrents not to extend, got: %+v", torrents[0].Extended)
+	}
+
+	completed, percent := torrents[1].Completed, torrents[1].Percent
+	gone := &Torrent{Hash: "DEADBEEF"}
+	if err := rt.Extend(torrents[1], gone, torrents[0]); !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "DEADBEEF") {
+		t.Errorf("Expected ErrNotFound for DEADBEEF, got: %v", err)
+	}
+	if gone.Extended != nil {
+		t.Errorf("Expected the missing torrent not to be extended, got: %+v", gone.Extended)
+	}
+
+	arch := torrents[1]
+	expected := Extended{
+		Seeders:       4,
+		Leechers:      2,
+		SeedersTotal:  120,
+		LeechersTotal: 9,
+		Priority:      3,
+		Private:       true,
+		MultiFile:     true,
+		Directory:     "/downloads/archlinux",
+		Left:          7<<20 - 1000,
+		Done:          3<<20 + 1000,
+		Skipped:       4096,
+		Throttle:      "slow",
+		Custom:        [5]string{"Linux", "", "note", "", ""},
+	}
+	if arch.Extended == nil || *arch.Extended != expected {
+		t.Errorf("Expected %+v, got: %+v", expected, arch.Extended)
+	}
+	if arch.UpTotal != 5<<20 {
+		t.Errorf("Expected rTorrent's up total, got: %d", arch.UpTotal)
+	}
+	if arch.Completed != completed || arch.Percent != percent {
+		t.Errorf("Expected Completed and Percent to be left alone, got: %d, %s", arch.Completed, arch.Percent)
+	}
+
+	if err := rt.Extend(torrents[0]); err != nil || torrents[0].Extended.SeedersTotal != 0 {
+		t.Errorf("Expected ubuntu.iso to be extended, got: %+v, %v", torrents[0].Extended, err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	v, err := rt.Call("system.client_version", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v != "0.9.6" {
+		t.Errorf("Expected Call to return %q, got: %#v", "0.9.6", v)
+	}
+}
+
+var (
+	recordGolden = flag.String("record-golden", "", "re-record testdata/golden/torrents from the rTorrent at this address")
+	recordScrub  = flag.String("record-scrub", "", `JSON object of strings to scrub from the recording, e.g. {"/home/alice":"/home/user"}`)
+)
+
+// TestRecordGolden re-records the session TestReplay replays, the torrents
+// of the rTorrent must be the ones TestReplay expects:
+//
+//	go test -run TestRecordGolden -record-golden localhost:5000 -record-scrub '{"passkey=abc":"passkey=scrubbed"}'
+//
+// The committed recording was made this way from an rtapitest fake holding
+// those torrents, not from a real rTorrent.
+func TestRecordGolden(t *testing.T) {
+	if *recordGolden == "" {
+		t.Skip("-record-golden isn't set")
+	}
+
+	scrub := make(map[string]string)
+	if *recordScrub != "" {
+		if err := json.Unmarshal([]byte(*recordScrub), &scrub); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := "testdata/golden/torrents"
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	network := "tcp"
+	if filepath.IsAbs(*recordGolden) {
+		network = "unix"
+	}
+	rec := &rtapitest.Recorder{
+		Transport:   &SCGITransport{Network: network, Address: *recordGolden},
+		Dir:         dir,
+		ScrubHashes: true,
+		ScrubPaths:  scrub,
+	}
+	rt, err := NewRtorrent(*recordGolden, WithTransport(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.Torrents(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	replayer, err := rtapitest.NewReplayer("testdata/golden/torrents")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err := NewRtorrent("", WithTransport(replayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.Version != "0.9.8/0.13.8" {
+		t.Errorf("Expected version 0.9.8/0.13.8, got: %s", rt.Version)
+	}
+
+	torrents, err := rt.Torrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 2 {
+		t.Fatalf("Expected 2 torrents, got: %d", len(torrents))
+	}
+
+	cafe, bunny := torrents[0], torrents[1]
+	if cafe.Name != "Café & <Friends> S01" || cafe.Path != "/home/user/downloads/tv/Café & <Friends> S01" {
+		t.Errorf("Expected the escaped name and path to be decoded, got: %q %q", cafe.Name, cafe.Path)
+	}
+	if cafe.State != Leeching || cafe.Percent != "50.0%" || cafe.ETA != 2047 || cafe.TimeLeft != 2047*time.Second || cafe.Label != "TV" {
+		t.Errorf("Unexpected torrent: %+v", cafe)
+	}
+	if cafe.Tracker.Query().Get("passkey") != "scrubbed" {
+		t.Errorf("Expected a scrubbed passkey, got: %s", cafe.Tracker)
+	}
+	if !cafe.FinishedAt.IsZero() || !bunny.FinishedAt.Equal(time.Unix(1690003600, 0)) || bunny.SeedingTime <= 0 {
+		t.Errorf("Expected only Big Buck Bunny to be finished, got: %v %v", cafe.FinishedAt, bunny.FinishedAt)
+	}
+	if bunny.State != Error || bunny.Message != `Tracker: [Failure reason "torrent not registered"]` || bunny.Ratio != 2 {
+		t.Errorf("Unexpected torrent: %+v", bunny)
+	}
+}
+
+func TestParseTorrentFallback(t *testing.T) {
+	_, body, _ := strings.Cut(torrentsResp, "\n\n")
+	resp, err := decodeMethodResponse(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := resp.arrayParam()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cat answers empty strings for the byte counters rTorrent doesn't know.
+	fields, _ := values[0].arrayValues()
+	for i := 18; i < 22; i++ {
+		fields[i] = newStringValue("")
+	}
+	torrent, err := parseTorrent(newArrayValue(fields...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if torrent.Size != 996*262144 || torrent.Completed != 792*262144 || torrent.UpTotal != 267827281 || torrent.DownTotal != 792*262144 {
+		t.Errorf("Expected the values derived from the chunks and the ratio, got: %+v", torrent)
+	}
+
+	fields[18] = newStringValue("big")
+	if _, err := parseTorrent(newArrayValue(fields...)); err == nil {
+		t.Error("Expected an error for a size which isn't a number")
+	}
+}
+
 func TestCalcPercentAndETA(t *testing.T) {
 	testCases := []struct {
 		size, done, downRate uint64
@@ -765,31 +1266,104 @@ func TestEncode(t *testing.T) {
 	}
 }
 
-func handleRequest(conn net.Conn) {
-	defer conn.Close()
-	length := getContentLen(conn)
-	buf := make([]byte, length)
-	conn.Read(buf)
+func TestBuildDownloadRawRequest(t *testing.T) {
+	var call xmlrpcMethodCall
+	if err := xml.Unmarshal([]byte(strings.TrimPrefix(downloadRawWithOptionsReq, xml.Header)), &call); err != nil {
+		t.Fatal(err)
+	}
 
-	req := string(buf)
+	if call.MethodName != "load.raw_start" || len(call.Params) != 4 {
+		t.Fatalf("Expected load.raw_start with 4 params, got: %s with %d", call.MethodName, len(call.Params))
+	}
+	if data := call.Params[1].Value.Base64; data == nil || !bytes.Equal(*data, testTorrentData) {
+		t.Errorf("Expected the torrent as base64, got: %v", call.Params[1].Value)
+	}
+	if cmd, _ := call.Params[3].Value.stringValue(); cmd != "d.custom1.set=Software" {
+		t.Errorf("Expected the label command, got: %q", cmd)
+	}
+}
+
+func TestDecodeValueTypes(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected interface{}
+	}{
+		{`<value>untyped</value>`, "untyped"},
+		{`<value></value>`, ""},
+		{`<value><string>a &amp; b</string></value>`, "a & b"},
+		{`<value><i4>-7</i4></value>`, int64(-7)},
+		{`<value><ex:i8 xmlns:ex="http://ws.apache.org/xmlrpc/namespaces/extensions">8589934592</ex:i8></value>`, int64(8589934592)},
+		{`<value><double>0.5</double></value>`, 0.5},
+		{`<value><boolean>1</boolean></value>`, true},
+		{`<value><base64>aGVs
+bG8=</base64></value>`, []byte("hello")},
+		{`<value><dateTime.iso8601>20170412T21:20:19</dateTime.iso8601></value>`, time.Date(2017, 4, 12, 21, 20, 19, 0, time.UTC)},
+		{`<value><dateTime.iso8601>2017-04-12T21:20:19Z</dateTime.iso8601></value>`, time.Date(2017, 4, 12, 21, 20, 19, 0, time.UTC)},
+		{`<value><nil/></value>`, nil},
+		{`<value><ex:nil xmlns:ex="http://ws.apache.org/xmlrpc/namespaces/extensions"/></value>`, nil},
+		{`<value><array><data><value>a</value><value><i8>1</i8></value></data></array></value>`, []interface{}{"a", int64(1)}},
+	}
+
+	for i, test := range testCases {
+		resp := `<methodResponse><params><param>` + test.value + `</param></params></methodResponse>`
+		decoded, err := decodeMethodResponse(strings.NewReader(resp))
+		if err != nil {
+			t.Errorf("Case %d: %v", i, err)
+			continue
+		}
+
+		got := decoded.Params[0].Value.native()
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Case %d: Expected %#v, got: %#v", i, test.expected, got)
+		}
+	}
+
+	for _, value := range []string{`<value><base64>!!</base64></value>`, `<value><dateTime.iso8601>yesterday</dateTime.iso8601></value>`} {
+		resp := `<methodResponse><params><param>` + value + `</param></params></methodResponse>`
+		if _, err := decodeMethodResponse(strings.NewReader(resp)); err == nil {
+			t.Errorf("Expected an error for %s", value)
+		}
+	}
+}
+
+func handleRequest(conn net.Conn) {
+	defer conn.Close()
+	length := getContentLen(conn)
+	buf := make([]byte, length)
+	conn.Read(buf)
+
+	req := string(buf)
 
 	switch {
 	case req == torrentsReq:
 		if _, err := conn.Write([]byte(torrentsResp)); err != nil {
 			log.Fatal(err)
 		}
+	case req == getTorrentReq:
+		if _, err := conn.Write([]byte(getTorrentResp)); err != nil {
+			log.Fatal(err)
+		}
 	case req == trackersReq:
 		if _, err := conn.Write([]byte(trackersResp)); err != nil {
 			log.Fatal(err)
 		}
-	case req == downloadReq:
-	case req == downloadWithOptionsReq:
-	case req == stopReq:
-	case req == startReq:
-	case req == checkReq:
-	case req == deleteReq:
-	case req == speedsReq:
-		if _, err := conn.Write([]byte(speedsResp)); err != nil {
+	case req == downloadReq,
+		req == downloadWithOptionsReq,
+		req == downloadRawReq,
+		req == downloadRawWithOptionsReq:
+		if _, err := conn.Write([]byte(actionResp)); err != nil {
+			log.Fatal(err)
+		}
+	case req == stopReq,
+		req == startReq,
+		req == checkReq,
+		req == deleteReq,
+		req == setLabelReq:
+		if _, err := conn.Write([]byte(eachResp)); err != nil {
+			log.Fatal(err)
+		}
+	case req == transferReq:
+		if _, err := conn.Write([]byte(transferResp)); err != nil {
 			log.Fatal(err)
 		}
 	case req == statsReq:
@@ -800,6 +1374,26 @@ func handleRequest(conn net.Conn) {
 		if _, err := conn.Write([]byte(versionResp)); err != nil {
 			log.Fatal(err)
 		}
+	case req == filesReq:
+		if _, err := conn.Write([]byte(filesResp)); err != nil {
+			log.Fatal(err)
+		}
+	case req == trackerListReq:
+		if _, err := conn.Write([]byte(trackerListResp)); err != nil {
+			log.Fatal(err)
+		}
+	case req == peersReq:
+		if _, err := conn.Write([]byte(peersResp)); err != nil {
+			log.Fatal(err)
+		}
+	case req == listMethodsReq:
+		if _, err := conn.Write([]byte(listMethodsResp)); err != nil {
+			log.Fatal(err)
+		}
+	case req == callReq:
+		if _, err := conn.Write([]byte(callResp)); err != nil {
+			log.Fatal(err)
+		}
 
 	default:
 		log.Print("Unkown request:")
@@ -836,6 +1430,179 @@ func BenchmarkTorrents(b *testing.B) {
 	}
 }
 
+func BenchmarkTorrentsIter(b *testing.B) {
+	rt, err := NewRtorrent(testAddress)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		rt.TorrentsIter(context.Background(), func(*Torrent) error { return nil })
+	}
+}
+
+// largeTransport answers like rTorrent would with 15k torrents, so the
+// large benchmarks only measure the client.
+type largeTransport struct {
+	torrents []byte
+	trackers map[int][]byte
+}
+
+const largeTorrents = 15000
+
+func newLargeTransport() *largeTransport {
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header + "<methodResponse><params><param><value><array><data>\n")
+	for i := 0; i < largeTorrents; i++ {
+		fmt.Fprintf(buf, "<value><array><data>"+
+			"<value><string>torrent-%d.iso</string></value><value><string>%040X</string></value>"+
+			"<value><i8>997035</i8></value><value><i8>593</i8></value>"+
+			"<value><i8>956</i8></value><value><i8>524288</i8></value><value><i8>115</i8></value>"+
+			"<value><i8>1000</i8></value><value><i8>1492031149</i8></value><value><string></string></value>"+
+			"<value><string>/home/Downloads/torrent-%d.iso</string></value>"+
+			"<value><i8>1</i8></value><value><string>leech</string></value><value><i8>0</i8></value>"+
+			"<value><i8>0</i8></value><value><string>Linux</string></value>"+
+			"<value><i8>0</i8></value><value><i8>1491000000</i8></value>"+
+			"<value><i8>501000000</i8></value><value><i8>60293120</i8></value>"+
+			"<value><i8>0</i8></value><value><i8>60293120</i8></value>"+
+			"<value><i8>1</i8></value><value><i8>1</i8></value><value><i8>0</i8></value>"+
+			"</data></array></value>\n", i, i, i)
+	}
+	buf.WriteString("</data></array></value></param></params></methodResponse>")
+	return &largeTransport{torrents: buf.Bytes(), trackers: make(map[int][]byte)}
+}
+
+func (t *largeTransport) RoundTrip(ctx context.Context, body []byte) (io.ReadCloser, error) {
+	if bytes.Contains(body, []byte("d.multicall2")) {
+		return io.NopCloser(bytes.NewReader(t.torrents)), nil
+	}
+
+	n := bytes.Count(body, []byte("t.url"))
+	resp, ok := t.trackers[n]
+	if !ok {
+		buf := new(bytes.Buffer)
+		buf.WriteString(xml.Header + "<methodResponse><params><param><value><array><data>")
+		for i := 0; i < n; i++ {
+			buf.WriteString("<value><array><data><value><string>udp://tracker.archlinux.org:6969</string></value></data></array></value>")
+		}
+		buf.WriteString("</data></array></value></param></params></methodResponse>")
+		resp = buf.Bytes()
+		t.trackers[n] = resp
+	}
+	return io.NopCloser(bytes.NewReader(resp)), nil
+}
+
+// liveHeap returns how many bytes are still reachable on the heap.
+func liveHeap() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// allocated returns how many bytes fn allocates.
+func allocated(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+// The large benchmarks report live-B/op, the heap still in use once a poll
+// is decoded (or, for TorrentsIter, at most while it is being decoded).
+
+// BenchmarkDecodeLarge is how Torrents used to decode, the whole answer into
+// a tree first.
+func BenchmarkDecodeLarge(b *testing.B) {
+	lt := newLargeTransport()
+	base := liveHeap()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := decodeMethodResponse(bytes.NewReader(lt.torrents))
+		if err != nil {
+			b.Fatal(err)
+		}
+		values, _ := resp.arrayParam()
+		torrents := make(Torrents, len(values))
+		for j, v := range values {
+			if torrents[j], err = parseTorrent(v); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		if i == 0 {
+			b.StopTimer()
+			b.ReportMetric(float64(liveHeap()-base), "live-B/op")
+			b.StartTimer()
+		}
+		runtime.KeepAlive(resp)
+	}
+}
+
+func BenchmarkTorrentsLarge(b *testing.B) {
+	rt := &Rtorrent{transport: newLargeTransport()}
+	base := liveHeap()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		torrents, err := rt.Torrents()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if i == 0 {
+			b.StopTimer()
+			b.ReportMetric(float64(liveHeap()-base), "live-B/op")
+			b.StartTimer()
+		}
+		runtime.KeepAlive(torrents)
+	}
+}
+
+func BenchmarkTorrentsIterLarge(b *testing.B) {
+	lt := newLargeTransport()
+	rt := &Rtorrent{transport: lt}
+
+	// streaming, trackers included, must allocate well under decoding the
+	// torrents alone into a tree.
+	tree := allocated(func() {
+		if _, err := decodeMethodResponse(bytes.NewReader(lt.torrents)); err != nil {
+			b.Fatal(err)
+		}
+	})
+	iter := allocated(func() {
+		if err := rt.TorrentsIter(context.Background(), func(*Torrent) error { return nil }); err != nil {
+			b.Fatal(err)
+		}
+	})
+	if iter > tree/4 {
+		b.Fatalf("Expected TorrentsIter to allocate under a quarter of the %d bytes of a tree decode, got: %d", tree, iter)
+	}
+
+	base := liveHeap()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var n int
+		var peak uint64
+		err := rt.TorrentsIter(context.Background(), func(*Torrent) error {
+			if n++; i == 0 && n%1000 == 0 {
+				b.StopTimer()
+				peak = max(peak, liveHeap()-base)
+				b.StartTimer()
+			}
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if i == 0 {
+			b.ReportMetric(float64(peak), "live-B/op")
+		}
+	}
+}
+
 func match(a, b *Torrent) bool {
 	if a.Name != b.Name ||
 		a.Hash != b.Hash ||
@@ -844,11 +1611,18 @@ func match(a, b *Torrent) bool {
 		a.Size != b.Size ||
 		a.Completed != b.Completed ||
 		a.Percent != b.Percent ||
+		a.Progress != b.Progress ||
 		a.ETA != b.ETA ||
+		a.TimeLeft != b.TimeLeft ||
 		a.Ratio != b.Ratio ||
 		a.Age != b.Age ||
+		!a.AddedAt.Equal(b.AddedAt) ||
+		!a.FinishedAt.Equal(b.FinishedAt) ||
+		!a.CreatedAt.Equal(b.CreatedAt) ||
 		a.UpTotal != b.UpTotal ||
+		a.DownTotal != b.DownTotal ||
 		a.State != b.State ||
+		a.Flags != b.Flags ||
 		a.Message != b.Message ||
 		*a.Tracker != *b.Tracker ||
 		a.Path != b.Path {
@@ -860,7 +1634,7 @@ func match(a, b *Torrent) bool {
 const (
 	torrentsResp = `Status: 200 OK
 Content-Type: text/xml
-Content-Length: 2203
+Content-Length: 3059
 
 <?xml version="1.0" encoding="UTF-8"?>
 <methodResponse>
@@ -883,6 +1657,15 @@ Content-Length: 2203
 <value><i8>0</i8></value>
 <value><i8>0</i8></value>
 <value><string></string></value>
+<value><i8>0</i8></value>
+<value><i8>1491000000</i8></value>
+<value><i8>261031936</i8></value>
+<value><i8>207618048</i8></value>
+<value><i8>267827281</i8></value>
+<value><i8>207618048</i8></value>
+<value><i8>1</i8></value>
+<value><i8>1</i8></value>
+<value><i8>0</i8></value>
 </data></array></value>
 <value><array><data>
 <value><string>ubuntu-17.04-server-amd64.iso</string></value>
@@ -901,6 +1684,15 @@ Content-Length: 2203
 <value><i8>1</i8></value>
 <value><i8>0</i8></value>
 <value><string></string></value>
+<value><i8>1492035619</i8></value>
+<value><i8>1491900000</i8></value>
+<value><i8>718203904</i8></value>
+<value><i8>718203904</i8></value>
+<value><i8>0</i8></value>
+<value><i8>718203904</i8></value>
+<value><i8>1</i8></value>
+<value><i8>1</i8></value>
+<value><i8>0</i8></value>
 </data></array></value>
 <value><array><data>
 <value><string>archlinux-2017.04.01-x86_64.iso</string></value>
@@ -919,6 +1711,105 @@ Content-Length: 2203
 <value><i8>0</i8></value>
 <value><i8>0</i8></value>
 <value><string></string></value>
+<value><i8>0</i8></value>
+<value><i8>1490000000</i8></value>
+<value><i8>500727808</i8></value>
+<value><i8>60293120</i8></value>
+<value><i8>0</i8></value>
+<value><i8>60293120</i8></value>
+<value><i8>1</i8></value>
+<value><i8>1</i8></value>
+<value><i8>0</i8></value>
+</data></array></value>
+</data></array></value></param>
+</params>
+</methodResponse>`
+
+	getTorrentResp = `Status: 200 OK
+Content-Type: text/xml
+Content-Length: 2275
+
+<?xml version="1.0" encoding="UTF-8"?>
+<methodResponse>
+<params>
+<param><value><array><data>
+<value><array><data>
+<value><string>archlinux-2017.04.01-x86_64.iso</string></value>
+</data></array></value>
+<value><array><data>
+<value><string>02CA77A6A047FD37F04337437D18F82E61861084</string></value>
+</data></array></value>
+<value><array><data>
+<value><i8>997035</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>0</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>956</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>524288</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>115</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>0</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>1492031149</i8></value>
+</data></array></value>
+<value><array><data>
+<value><string></string></value>
+</data></array></value>
+<value><array><data>
+<value><string>/Users/abdulelah/rtorrent/download/archlinux-2017.04.01-x86_64.iso</string></value>
+</data></array></value>
+<value><array><data>
+<value><i8>1</i8></value>
+</data></array></value>
+<value><array><data>
+<value><string>leech</string></value>
+</data></array></value>
+<value><array><data>
+<value><i8>0</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>0</i8></value>
+</data></array></value>
+<value><array><data>
+<value><string></string></value>
+</data></array></value>
+<value><array><data>
+<value><i8>0</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>1490000000</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>500727808</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>60293120</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>0</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>60293120</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>1</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>1</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>0</i8></value>
+</data></array></value>
+<value><array><data>
+<value><string>udp://tracker.archlinux.org:6969</string></value>
 </data></array></value>
 </data></array></value></param>
 </params>
@@ -945,9 +1836,9 @@ Content-Length: 513
 </params>
 </methodResponse>`
 
-	speedsResp = `Status: 200 OK
+	transferResp = `Status: 200 OK
 Content-Type: text/xml
-Content-Length: 315
+Content-Length: 595
 
 <?xml version="1.0" encoding="UTF-8"?>
 <methodResponse>
@@ -959,13 +1850,25 @@ Content-Length: 315
 <value><array><data>
 <value><i8>593</i8></value>
 </data></array></value>
+<value><array><data>
+<value><i8>0</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>51200</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>7476</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>6841</i8></value>
+</data></array></value>
 </data></array></value></param>
 </params>
 </methodResponse>`
 
 	statsResp = `Status: 200 OK
 Content-Type: text/xml
-Content-Length: 635
+Content-Length: 2625
 
 <?xml version="1.0" encoding="UTF-8"?>
 <methodResponse>
@@ -989,6 +1892,77 @@ Content-Length: 635
 <value><array><data>
 <value><string>/home/Downloads</string></value>
 </data></array></value>
+<value><array><data>
+<value><i8>12</i8></value>
+</data></array></value>
+<value><struct>
+<member><name>faultCode</name><value><i4>-506</i4></value></member>
+<member><name>faultString</name><value><string>Method 'network.max_open_sockets' not defined</string></value></member>
+</struct></value>
+<value><array><data>
+<value><i8>50</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>100</i8></value>
+</data></array></value>
+<value><array><data>
+<value><struct>
+<member><name>dht</name><value><string>auto</string></value></member>
+<member><name>active</name><value><i8>1</i8></value></member>
+<member><name>nodes</name><value><i8>143</i8></value></member>
+</struct></value>
+</data></array></value>
+<value><array><data>
+<value><i8>4194304</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>1073741824</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>1700000000</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>1700003600</i8></value>
+</data></array></value>
+<value><array><data>
+<value><array><data>
+<value><array><data>
+<value><string>/mnt/other</string></value>
+<value><i8>52428800</i8></value>
+</data></array></value>
+<value><array><data>
+<value><string>/home/Downloads/ubuntu</string></value>
+<value><i8>191487148032</i8></value>
+</data></array></value>
+</data></array></value>
+</data></array></value>
+<value><array><data>
+<value><i8>3</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>2</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>1</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>1</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>2</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>1</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>0</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>0</i8></value>
+</data></array></value>
+<value><array><data>
+<value><i8>1</i8></value>
+</data></array></value>
 </data></array></value></param>
 </params>
 </methodResponse>`
@@ -1009,5 +1983,176 @@ Content-Length: 333
 </data></array></value>
 </data></array></value></param>
 </params>
+</methodResponse>`
+
+	callResp = `Status: 200 OK
+Content-Type: text/xml
+Content-Length: 148
+
+<?xml version="1.0" encoding="UTF-8"?>
+<methodResponse>
+<params>
+<param><value><string>0.9.6</string></value></param>
+</params>
+</methodResponse>`
+
+	listMethodsResp = `Status: 200 OK
+Content-Type: text/xml
+Content-Length: 2996
+
+<?xml version="1.0" encoding="UTF-8"?>
+<methodResponse>
+<params>
+<param><value><array><data>
+<value><string>d.base_path</string></value>
+<value><string>d.check_hash</string></value>
+<value><string>d.chunk_size</string></value>
+<value><string>d.complete</string></value>
+<value><string>d.completed_chunks</string></value>
+<value><string>d.connection_current</string></value>
+<value><string>d.custom1</string></value>
+<value><string>d.custom1.set</string></value>
+<value><string>d.directory.set</string></value>
+<value><string>d.down.rate</string></value>
+<value><string>d.erase</string></value>
+<value><string>d.hash</string></value>
+<value><string>d.hashing</string></value>
+<value><string>d.is_active</string></value>
+<value><string>d.load_date</string></value>
+<value><string>d.message</string></value>
+<value><string>d.multicall2</string></value>
+<value><string>d.name</string></value>
+<value><string>d.ratio</string></value>
+<value><string>d.size_chunks</string></value>
+<value><string>d.start</string></value>
+<value><string>d.stop</string></value>
+<value><string>d.up.rate</string></value>
+<value><string>directory.default</string></value>
+<value><string>f.completed_chunks</string></value>
+<value><string>f.multicall</string></value>
+<value><string>f.path</string></value>
+<value><string>f.priority</string></value>
+<value><string>f.size_bytes</string></value>
+<value><string>f.size_chunks</string></value>
+<value><string>load.normal</string></value>
+<value><string>load.raw</string></value>
+<value><string>load.raw_start</string></value>
+<value><string>load.start</string></value>
+<value><string>load.start_verbose</string></value>
+<value><string>load.verbose</string></value>
+<value><string>network.listen.port</string></value>
+<value><string>p.address</string></value>
+<value><string>p.client_version</string></value>
+<value><string>p.completed_percent</string></value>
+<value><string>p.down_rate</string></value>
+<value><string>p.multicall</string></value>
+<value><string>p.port</string></value>
+<value><string>p.up_rate</string></value>
+<value><string>system.client_version</string></value>
+<value><string>system.library_version</string></value>
+<value><string>system.listMethods</string></value>
+<value><string>system.multicall</string></value>
+<value><string>t.is_enabled</string></value>
+<value><string>t.multicall</string></value>
+<value><string>t.scrape_complete</string></value>
+<value><string>t.scrape_incomplete</string></value>
+<value><string>t.url</string></value>
+<value><string>throttle.down.max</string></value>
+<value><string>throttle.global_down.max_rate</string></value>
+<value><string>throttle.global_down.rate</string></value>
+<value><string>throttle.global_down.total</string></value>
+<value><string>throttle.global_up.max_rate</string></value>
+<value><string>throttle.global_up.rate</string></value>
+<value><string>throttle.global_up.total</string></value>
+<value><string>throttle.up.max</string></value>
+</data></array></value></param>
+</params>
+</methodResponse>`
+
+	actionResp = `Status: 200 OK
+Content-Type: text/xml
+Content-Length: 133
+
+<?xml version="1.0" encoding="UTF-8"?>
+<methodResponse>
+<params>
+<param><value><i8>0</i8></value></param>
+</params>
+</methodResponse>`
+
+	eachResp = `Status: 200 OK
+Content-Type: text/xml
+Content-Length: 223
+
+<?xml version="1.0" encoding="UTF-8"?>
+<methodResponse>
+<params>
+<param><value><array><data>
+<value><array><data>
+<value><i8>0</i8></value>
+</data></array></value>
+</data></array></value></param>
+</params>
+</methodResponse>`
+
+	filesResp = `Status: 200 OK
+Content-Type: text/xml
+
+<?xml version="1.0" encoding="UTF-8"?>
+<methodResponse>
+<params>
+<param><value><array><data>
+<value><array><data>
+<value><string>archlinux-2017.04.01-x86_64.iso</string></value>
+<value><i8>501219328</i8></value>
+<value><i8>956</i8></value>
+<value><i8>115</i8></value>
+<value><i8>1</i8></value>
+</data></array></value>
+<value><array><data>
+<value><string>README</string></value>
+<value><i8>1024</i8></value>
+<value><i8>1</i8></value>
+<value><i8>0</i8></value>
+<value><i8>0</i8></value>
+</data></array></value>
+</data></array></value></param>
+</params>
+</methodResponse>`
+
+	trackerListResp = `Status: 200 OK
+Content-Type: text/xml
+
+<?xml version="1.0" encoding="UTF-8"?>
+<methodResponse>
+<params>
+<param><value><array><data>
+<value><array><data>
+<value><string>udp://tracker.archlinux.org:6969</string></value>
+<value><i8>1</i8></value>
+<value><i8>120</i8></value>
+<value><i8>7</i8></value>
+</data></array></value>
+</data></array></value></param>
+</params>
+</methodResponse>`
+
+	peersResp = `Status: 200 OK
+Content-Type: text/xml
+
+<?xml version="1.0" encoding="UTF-8"?>
+<methodResponse>
+<params>
+<param><value><array><data>
+<value><array><data>
+<value><string>10.0.0.2</string></value>
+<value><i8>51413</i8></value>
+<value><string>Transmission 2.92</string></value>
+<value><i8>997035</i8></value>
+<value><i8>0</i8></value>
+<value><i8>100</i8></value>
+</data></array></value>
+</data></array></value></param>
+</params>
 </methodResponse>`
 )
@@ -0,0 +1,161 @@
+package rtapitest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errBencode = errors.New("invalid bencode")
+
+// bdecode decodes the bencoded value at the start of data and returns it
+// with the number of bytes it takes. Strings are returned as string,
+// integers as int64, lists as []interface{} and dictionaries as
+// map[string]interface{}.
+func bdecode(data []byte) (interface{}, int, error) {
+	if len(data) == 0 {
+		return nil, 0, errBencode
+	}
+
+	switch c := data[0]; {
+	case c == 'i':
+		end := bytes.IndexByte(data, 'e')
+		if end < 0 {
+			return nil, 0, errBencode
+		}
+		n, err := strconv.ParseInt(string(data[1:end]), 10, 64)
+		if err != nil {
+			return nil, 0, errBencode
+		}
+		return n, end + 1, nil
+	case c == 'l':
+		list := []interface{}{}
+		i := 1
+		for i < len(data) && data[i] != 'e' {
+			v, n, err := bdecode(data[i:])
+			if err != nil {
+				return nil, 0, err
+			}
+			list = append(list, v)
+			i += n
+		}
+		if i >= len(data) {
+			return nil, 0, errBencode
+		}
+		return list, i + 1, nil
+	case c == 'd':
+		dict := make(map[string]interface{})
+		i := 1
+		for i < len(data) && data[i] != 'e' {
+			k, n, err := bdecode(data[i:])
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errBencode
+			}
+			i += n
+
+			v, n, err := bdecode(data[i:])
+			if err != nil {
+				return nil, 0, err
+			}
+			dict[key] = v
+			i += n
+		}
+		if i >= len(data) {
+			return nil, 0, errBencode
+		}
+		return dict, i + 1, nil
+	case c >= '0' && c <= '9':
+		colon := bytes.IndexByte(data, ':')
+		if colon < 0 {
+			return nil, 0, errBencode
+		}
+		n, err := strconv.Atoi(string(data[:colon]))
+		if err != nil || n < 0 || colon+1+n > len(data) {
+			return nil, 0, errBencode
+		}
+		return string(data[colon+1 : colon+1+n]), colon + 1 + n, nil
+	}
+	return nil, 0, errBencode
+}
+
+// torrentFromMeta makes a torrent from the content of a .torrent file,
+// its hash is the SHA-1 of the bencoded info dictionary.
+func torrentFromMeta(data []byte) (*Torrent, error) {
+	invalid := &Fault{Code: faultGeneric, String: "Could not create download, the input is not a valid torrent."}
+
+	if len(data) == 0 || data[0] != 'd' {
+		return nil, invalid
+	}
+
+	// walk the top level dictionary to find the raw info value.
+	var info []byte
+	for i := 1; i < len(data) && data[i] != 'e'; {
+		k, n, err := bdecode(data[i:])
+		if err != nil {
+			return nil, invalid
+		}
+		i += n
+
+		_, n, err = bdecode(data[i:])
+		if err != nil {
+			return nil, invalid
+		}
+		if k == "info" {
+			info = data[i : i+n]
+		}
+		i += n
+	}
+	if info == nil {
+		return nil, invalid
+	}
+
+	v, _, _ := bdecode(info)
+	dict, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, invalid
+	}
+
+	sum := sha1.Sum(info)
+	t := &Torrent{Hash: strings.ToUpper(hex.EncodeToString(sum[:]))}
+	t.Name, _ = dict["name"].(string)
+	if n, ok := dict["piece length"].(int64); ok {
+		t.ChunkSize = n
+	}
+	if n, ok := dict["private"].(int64); ok {
+		t.Private = n == 1
+	}
+
+	if length, ok := dict["length"].(int64); ok {
+		t.Size = length
+		t.Files = []File{{Path: t.Name, Size: length}}
+	}
+	files, _ := dict["files"].([]interface{})
+	for _, f := range files {
+		file, _ := f.(map[string]interface{})
+		length, _ := file["length"].(int64)
+		var parts []string
+		list, _ := file["path"].([]interface{})
+		for _, p := range list {
+			s, _ := p.(string)
+			parts = append(parts, s)
+		}
+
+		t.Size += length
+		t.Files = append(t.Files, File{Path: strings.Join(parts, "/"), Size: length})
+		t.MultiFile = true
+	}
+
+	for i := range t.Files {
+		f := &t.Files[i]
+		f.SizeChunks = (f.Size + t.chunkSize() - 1) / t.chunkSize()
+		f.Priority = 1
+	}
+	return t, nil
+}
@@ -0,0 +1,662 @@
+package rtapitest
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault codes used by rTorrent.
+const (
+	faultGeneric   = -500
+	faultNotFound  = -501
+	faultWrongType = -503
+	faultNoMethod  = -506
+)
+
+type handler func(s *Server, params []interface{}) (interface{}, error)
+
+// handlers are the commands answered by the fake, besides the d.* getters,
+// setters and actions which are looked up in their own tables.
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"system.multicall":      (*Server).multicall,
+		"system.listMethods":    (*Server).listMethods,
+		"system.client_version": sessionString(func(s Session) string { return s.ClientVersion }),
+		"system.library_version": sessionString(func(s Session) string {
+			return s.LibraryVersion
+		}),
+		"network.listen.port": sessionInt(func(s Session) int64 { return s.Port }),
+		"directory.default":   sessionString(func(s Session) string { return s.Directory }),
+		"system.startup_time": sessionInt(func(s Session) int64 { return s.StartupTime }),
+		"system.time_seconds": func(s *Server, params []interface{}) (interface{}, error) {
+			return time.Now().Unix(), nil
+		},
+		"network.open_sockets":      sessionInt(func(s Session) int64 { return s.OpenSockets }),
+		"network.max_open_sockets":  sessionInt(func(s Session) int64 { return s.MaxOpenSockets }),
+		"throttle.max_peers.normal": sessionInt(func(s Session) int64 { return s.MaxPeers }),
+		"throttle.max_peers.seed":   sessionInt(func(s Session) int64 { return s.MaxPeersSeed }),
+		"pieces.memory.current":     sessionInt(func(s Session) int64 { return s.MemoryUsage }),
+		"pieces.memory.max":         sessionInt(func(s Session) int64 { return s.MaxMemory }),
+		"dht.statistics":            (*Server).dhtStatistics,
+		"view.size":                 (*Server).viewSize,
+
+		"throttle.global_down.rate":     (*Server).downRate,
+		"throttle.global_up.rate":       (*Server).upRate,
+		"throttle.global_down.total":    sessionInt(func(s Session) int64 { return s.DownTotal }),
+		"throttle.global_up.total":      sessionInt(func(s Session) int64 { return s.UpTotal }),
+		"throttle.global_down.max_rate": sessionInt(func(s Session) int64 { return s.DownMax }),
+		"throttle.global_up.max_rate":   sessionInt(func(s Session) int64 { return s.UpMax }),
+		"throttle.down.max":             sessionInt(func(s Session) int64 { return s.DownMax }),
+		"throttle.up.max":               sessionInt(func(s Session) int64 { return s.UpMax }),
+		"throttle.global_down.max_rate.set": sessionSet(func(s *Session, v int64) {
+			s.DownMax = v
+		}),
+		"throttle.global_up.max_rate.set": sessionSet(func(s *Session, v int64) {
+			s.UpMax = v
+		}),
+
+		"d.multicall2":     (*Server).downloadMulticall,
+		"d.erase":          (*Server).erase,
+		"d.custom":         (*Server).custom,
+		"d.custom.set":     (*Server).setCustom,
+		"d.free_diskspace": (*Server).freeDiskspace,
+		"d.priority.set":   (*Server).setPriority,
+
+		"t.multicall": itemMulticall(trackerGetters, func(t *Torrent) []interface{} {
+			items := make([]interface{}, len(t.Trackers))
+			for i := range t.Trackers {
+				items[i] = &t.Trackers[i]
+			}
+			return items
+		}),
+		"f.multicall": itemMulticall(fileGetters, func(t *Torrent) []interface{} {
+			items := make([]interface{}, len(t.Files))
+			for i := range t.Files {
+				items[i] = &t.Files[i]
+			}
+			return items
+		}),
+		"p.multicall": itemMulticall(peerGetters, func(t *Torrent) []interface{} {
+			items := make([]interface{}, len(t.Peers))
+			for i := range t.Peers {
+				items[i] = &t.Peers[i]
+			}
+			return items
+		}),
+
+		"load.normal":            loader(false),
+		"load.verbose":           loader(false),
+		"load.start":             loader(true),
+		"load.start_verbose":     loader(true),
+		"load.raw":               loader(false),
+		"load.raw_verbose":       loader(false),
+		"load.raw_start":         loader(true),
+		"load.raw_start_verbose": loader(true),
+	}
+
+	for name, get := range trackerGetters {
+		handlers[name] = trackerGetter(get)
+	}
+}
+
+// call runs a command, s.mu must be held.
+func (s *Server) call(method string, params []interface{}) (interface{}, error) {
+	s.calls = append(s.calls, Call{Method: method, Params: params})
+
+	if f := s.faults[method]; f != nil {
+		return nil, f
+	}
+
+	if h, ok := handlers[method]; ok {
+		return h(s, params)
+	}
+
+	get, isGetter := getters[method]
+	set, isSetter := setters[method]
+	act, isAction := actions[method]
+	if !isGetter && !isSetter && !isAction {
+		return nil, &Fault{Code: faultNoMethod, String: fmt.Sprintf("Method '%s' not defined", method)}
+	}
+
+	t, err := s.target(params)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case isGetter:
+		return get(t), nil
+	case isSetter:
+		value, err := stringParam(params, 1)
+		if err != nil {
+			return nil, err
+		}
+		set(t, value)
+	default:
+		act(t)
+	}
+	return int64(0), nil
+}
+
+// target returns the torrent whose hash is the first param.
+func (s *Server) target(params []interface{}) (*Torrent, error) {
+	hash, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	t := s.lookup(hash)
+	if t == nil {
+		return nil, &Fault{Code: faultNotFound, String: "Could not find info-hash."}
+	}
+	return t, nil
+}
+
+func stringParam(params []interface{}, i int) (string, error) {
+	if i >= len(params) {
+		return "", &Fault{Code: faultWrongType, String: "Wrong number of arguments."}
+	}
+
+	switch v := params[i].(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	}
+	return "", &Fault{Code: faultWrongType, String: "Wrong object type."}
+}
+
+func intParam(params []interface{}, i int) (int64, error) {
+	if i >= len(params) {
+		return 0, &Fault{Code: faultWrongType, String: "Wrong number of arguments."}
+	}
+
+	switch v := params[i].(type) {
+	case int64:
+		return v, nil
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, &Fault{Code: faultWrongType, String: "Wrong object type."}
+}
+
+func sessionString(get func(s Session) string) handler {
+	return func(s *Server, params []interface{}) (interface{}, error) {
+		return get(s.session), nil
+	}
+}
+
+func sessionInt(get func(s Session) int64) handler {
+	return func(s *Server, params []interface{}) (interface{}, error) {
+		return get(s.session), nil
+	}
+}
+
+// sessionSet handles throttle setters, which take the value last as
+// rTorrent expects an empty target first.
+func sessionSet(set func(s *Session, v int64)) handler {
+	return func(s *Server, params []interface{}) (interface{}, error) {
+		v, err := intParam(params, len(params)-1)
+		if err != nil {
+			return nil, err
+		}
+		set(&s.session, v)
+		return int64(0), nil
+	}
+}
+
+func (s *Server) dhtStatistics(params []interface{}) (interface{}, error) {
+	mode := s.session.DHTMode
+	if mode == "off" || mode == "disable" {
+		return map[string]interface{}{"dht": mode, "active": int64(0)}, nil
+	}
+	return map[string]interface{}{"dht": mode, "active": int64(1), "nodes": s.session.DHTNodes}, nil
+}
+
+func (s *Server) viewSize(params []interface{}) (interface{}, error) {
+	view, err := stringParam(params, 1)
+	if err != nil {
+		return nil, err
+	}
+	match, ok := views[view]
+	if !ok {
+		return nil, &Fault{Code: faultGeneric, String: "Could not find view: " + view}
+	}
+
+	var n int64
+	for _, t := range s.torrents {
+		if match(t) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// freeDiskspace answers d.free_diskspace, the same for every torrent.
+func (s *Server) freeDiskspace(params []interface{}) (interface{}, error) {
+	if _, err := s.target(params); err != nil {
+		return nil, err
+	}
+	return s.session.FreeDiskSpace, nil
+}
+
+func (s *Server) multicall(params []interface{}) (interface{}, error) {
+	if len(params) == 0 {
+		return nil, &Fault{Code: faultWrongType, String: "Wrong number of arguments."}
+	}
+	calls, ok := params[0].([]interface{})
+	if !ok {
+		return nil, &Fault{Code: faultWrongType, String: "Wrong object type."}
+	}
+
+	results := make([]interface{}, 0, len(calls))
+	for _, c := range calls {
+		m, _ := c.(map[string]interface{})
+		method, _ := m["methodName"].(string)
+		args, _ := m["params"].([]interface{})
+
+		result, err := s.call(method, args)
+		if f, ok := err.(*Fault); ok {
+			results = append(results, f.value())
+			continue
+		}
+		results = append(results, []interface{}{result})
+	}
+	return results, nil
+}
+
+func (s *Server) listMethods(params []interface{}) (interface{}, error) {
+	var names []string
+	for name := range handlers {
+		names = append(names, name)
+	}
+	for name := range getters {
+		names = append(names, name)
+	}
+	for name := range setters {
+		names = append(names, name)
+	}
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	methods := make([]interface{}, len(names))
+	for i, name := range names {
+		methods[i] = name
+	}
+	return methods, nil
+}
+
+func (s *Server) downRate(params []interface{}) (interface{}, error) {
+	var rate int64
+	for _, t := range s.torrents {
+		if t.Active {
+			rate += t.DownRate
+		}
+	}
+	return rate, nil
+}
+
+func (s *Server) upRate(params []interface{}) (interface{}, error) {
+	var rate int64
+	for _, t := range s.torrents {
+		if t.Active {
+			rate += t.UpRate
+		}
+	}
+	return rate, nil
+}
+
+// splitCommand splits a multicall field or a load command like
+// `d.directory.set="/downloads"` into its name and arguments. Arguments
+// are separated by commas, and may be quoted with backslash escapes.
+func splitCommand(field string) (string, []interface{}) {
+	name, rest, found := strings.Cut(field, "=")
+	if !found || rest == "" {
+		return name, nil
+	}
+
+	var (
+		args   []interface{}
+		arg    strings.Builder
+		quoted bool
+	)
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(rest):
+			i++
+			arg.WriteByte(rest[i])
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == ',':
+			args = append(args, arg.String())
+			arg.Reset()
+		default:
+			arg.WriteByte(c)
+		}
+	}
+	args = append(args, arg.String())
+	return name, args
+}
+
+func (s *Server) downloadMulticall(params []interface{}) (interface{}, error) {
+	view, err := stringParam(params, 1)
+	if err != nil {
+		return nil, err
+	}
+	match, ok := views[view]
+	if !ok {
+		return nil, &Fault{Code: faultGeneric, String: "Could not find view: " + view}
+	}
+
+	rows := []interface{}{}
+	for _, t := range s.torrents {
+		if !match(t) {
+			continue
+		}
+
+		row := make([]interface{}, 0, len(params)-2)
+		for i := 2; i < len(params); i++ {
+			field, err := stringParam(params, i)
+			if err != nil {
+				return nil, err
+			}
+
+			name, args := splitCommand(field)
+			if f := s.faults[name]; f != nil {
+				return nil, f
+			}
+
+			var v interface{}
+			switch get, ok := getters[name]; {
+			case ok:
+				v = get(t)
+			case name == "d.custom":
+				v, err = s.custom(append([]interface{}{t.Hash}, args...))
+			case name == "d.free_diskspace":
+				v = s.session.FreeDiskSpace
+			default:
+				err = &Fault{Code: faultNoMethod, String: fmt.Sprintf("Method '%s' not defined", name)}
+			}
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, v)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (s *Server) erase(params []interface{}) (interface{}, error) {
+	hash, err := stringParam(params, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !s.remove(hash) {
+		return nil, &Fault{Code: faultNotFound, String: "Could not find info-hash."}
+	}
+	return int64(0), nil
+}
+
+func (s *Server) custom(params []interface{}) (interface{}, error) {
+	t, err := s.target(params)
+	if err != nil {
+		return nil, err
+	}
+	key, err := stringParam(params, 1)
+	if err != nil {
+		return nil, err
+	}
+	return t.custom(key), nil
+}
+
+func (s *Server) setCustom(params []interface{}) (interface{}, error) {
+	t, err := s.target(params)
+	if err != nil {
+		return nil, err
+	}
+	key, err := stringParam(params, 1)
+	if err != nil {
+		return nil, err
+	}
+	value, err := stringParam(params, 2)
+	if err != nil {
+		return nil, err
+	}
+	t.setCustom(key, value)
+	return int64(0), nil
+}
+
+func (s *Server) setPriority(params []interface{}) (interface{}, error) {
+	t, err := s.target(params)
+	if err != nil {
+		return nil, err
+	}
+	priority, err := intParam(params, 1)
+	if err != nil {
+		return nil, err
+	}
+	if priority < 0 || priority > 3 {
+		return nil, &Fault{Code: faultGeneric, String: "Invalid value."}
+	}
+	t.Priority = priority
+	return int64(0), nil
+}
+
+var trackerGetters = map[string]func(item interface{}) interface{}{
+	"t.url":               func(i interface{}) interface{} { return i.(*Tracker).URL },
+	"t.is_enabled":        func(i interface{}) interface{} { return boolInt(i.(*Tracker).Enabled) },
+	"t.scrape_complete":   func(i interface{}) interface{} { return i.(*Tracker).Seeders },
+	"t.scrape_incomplete": func(i interface{}) interface{} { return i.(*Tracker).Leechers },
+}
+
+var fileGetters = map[string]func(item interface{}) interface{}{
+	"f.path":             func(i interface{}) interface{} { return i.(*File).Path },
+	"f.size_bytes":       func(i interface{}) interface{} { return i.(*File).Size },
+	"f.size_chunks":      func(i interface{}) interface{} { return i.(*File).SizeChunks },
+	"f.completed_chunks": func(i interface{}) interface{} { return i.(*File).CompletedChunks },
+	"f.priority":         func(i interface{}) interface{} { return i.(*File).Priority },
+}
+
+var peerGetters = map[string]func(item interface{}) interface{}{
+	"p.address":           func(i interface{}) interface{} { return i.(*Peer).Address },
+	"p.port":              func(i interface{}) interface{} { return i.(*Peer).Port },
+	"p.client_version":    func(i interface{}) interface{} { return i.(*Peer).Client },
+	"p.down_rate":         func(i interface{}) interface{} { return i.(*Peer).DownRate },
+	"p.up_rate":           func(i interface{}) interface{} { return i.(*Peer).UpRate },
+	"p.completed_percent": func(i interface{}) interface{} { return i.(*Peer).Percent },
+}
+
+// trackerGetter answers t.* calls on a "HASH:tN" target.
+func trackerGetter(get func(item interface{}) interface{}) handler {
+	return func(s *Server, params []interface{}) (interface{}, error) {
+		target, err := stringParam(params, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		hash, index, found := strings.Cut(target, ":t")
+		n, err := strconv.Atoi(index)
+		if !found || err != nil {
+			return nil, &Fault{Code: faultWrongType, String: "Invalid tracker target."}
+		}
+
+		t := s.lookup(hash)
+		if t == nil {
+			return nil, &Fault{Code: faultNotFound, String: "Could not find info-hash."}
+		}
+		if n < 0 || n >= len(t.Trackers) {
+			return nil, &Fault{Code: faultNotFound, String: "Invalid index."}
+		}
+		return get(&t.Trackers[n]), nil
+	}
+}
+
+// itemMulticall answers t.multicall, f.multicall and p.multicall, which
+// take a hash, an unused pattern and the fields.
+func itemMulticall(fields map[string]func(item interface{}) interface{}, items func(t *Torrent) []interface{}) handler {
+	return func(s *Server, params []interface{}) (interface{}, error) {
+		t, err := s.target(params)
+		if err != nil {
+			return nil, err
+		}
+
+		rows := []interface{}{}
+		for _, item := range items(t) {
+			row := make([]interface{}, 0, len(params)-2)
+			for i := 2; i < len(params); i++ {
+				field, err := stringParam(params, i)
+				if err != nil {
+					return nil, err
+				}
+
+				name, _ := splitCommand(field)
+				if f := s.faults[name]; f != nil {
+					return nil, f
+				}
+				get, ok := fields[name]
+				if !ok {
+					return nil, &Fault{Code: faultNoMethod, String: fmt.Sprintf("Method '%s' not defined", name)}
+				}
+				row = append(row, get(item))
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+}
+
+// loader answers load.* calls, which take an empty target, a link or the
+// raw torrent data and commands to run on the new torrent.
+func loader(start bool) handler {
+	return func(s *Server, params []interface{}) (interface{}, error) {
+		if len(params) < 2 {
+			return nil, &Fault{Code: faultWrongType, String: "Wrong number of arguments."}
+		}
+
+		var (
+			t   *Torrent
+			err error
+		)
+		switch v := params[1].(type) {
+		case []byte:
+			t, err = torrentFromMeta(v)
+		case string:
+			t, err = torrentFromLink(v)
+		default:
+			err = &Fault{Code: faultWrongType, String: "Wrong object type."}
+		}
+		if err != nil {
+			return nil, err
+		}
+		t.Directory = s.session.Directory
+		t.LoadDate = time.Now().Unix()
+		t.Priority = 2
+
+		for i := 2; i < len(params); i++ {
+			cmd, err := stringParam(params, i)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.apply(t, cmd); err != nil {
+				return nil, err
+			}
+		}
+
+		if start {
+			actions["d.start"](t)
+		}
+		s.add(t)
+		return int64(0), nil
+	}
+}
+
+// apply runs a load command like `d.custom1.set=Linux` on t.
+func (s *Server) apply(t *Torrent, cmd string) error {
+	name, args := splitCommand(cmd)
+	value := ""
+	if len(args) > 0 {
+		value, _ = args[len(args)-1].(string)
+	}
+
+	if set, ok := setters[name]; ok {
+		set(t, value)
+		return nil
+	}
+
+	switch name {
+	case "d.custom.set":
+		if len(args) != 2 {
+			return &Fault{Code: faultWrongType, String: "Wrong number of arguments."}
+		}
+		key, _ := args[0].(string)
+		t.setCustom(key, value)
+	case "d.priority.set":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 || n > 3 {
+			return &Fault{Code: faultGeneric, String: "Invalid value."}
+		}
+		t.Priority = n
+	default:
+		return &Fault{Code: faultNoMethod, String: fmt.Sprintf("Method '%s' not defined", name)}
+	}
+	return nil
+}
+
+// torrentFromLink makes a torrent from a magnet link or an URL. The fake
+// doesn't fetch anything, so torrents loaded from URLs get a hash made
+// from the URL and are empty until a test fills them.
+func torrentFromLink(link string) (*Torrent, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, &Fault{Code: faultGeneric, String: "Could not parse link."}
+	}
+
+	if u.Scheme == "magnet" {
+		q := u.Query()
+		for _, xt := range q["xt"] {
+			hash, ok := strings.CutPrefix(xt, "urn:btih:")
+			if !ok {
+				continue
+			}
+			if len(hash) == 32 {
+				b, err := base32.StdEncoding.DecodeString(strings.ToUpper(hash))
+				if err != nil {
+					break
+				}
+				hash = hex.EncodeToString(b)
+			}
+			if len(hash) != 40 {
+				break
+			}
+
+			name := q.Get("dn")
+			if name == "" {
+				name = strings.ToUpper(hash) + ".meta"
+			}
+			return &Torrent{Hash: strings.ToUpper(hash), Name: name}, nil
+		}
+		return nil, &Fault{Code: faultGeneric, String: "Invalid magnet link."}
+	}
+
+	sum := sha1.Sum([]byte(link))
+	return &Torrent{
+		Hash: strings.ToUpper(hex.EncodeToString(sum[:])),
+		Name: strings.TrimSuffix(path.Base(u.Path), ".torrent"),
+	}, nil
+}
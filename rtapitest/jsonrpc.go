@@ -0,0 +1,87 @@
+package rtapitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// jsonrpcCall is a JSON-RPC 2.0 request, as rTorrent forks like
+// jesec/rtorrent accept them.
+type jsonrpcCall struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  []interface{}   `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// isJSON reports whether body is a JSON-RPC request rather than XML-RPC.
+func isJSON(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	return len(body) > 0 && body[0] == '{'
+}
+
+// decodeJSONCall parses a JSON-RPC request, numbers are decoded as int64
+// when they are integers and float64 otherwise, like XML-RPC values.
+func decodeJSONCall(body []byte) (*jsonrpcCall, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var call jsonrpcCall
+	if err := dec.Decode(&call); err != nil {
+		return nil, err
+	}
+	if call.Method == "" {
+		return nil, fmt.Errorf("missing method")
+	}
+	for i, p := range call.Params {
+		call.Params[i] = fromJSON(p)
+	}
+	return &call, nil
+}
+
+func fromJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = fromJSON(v[i])
+		}
+	case map[string]interface{}:
+		for name := range v {
+			v[name] = fromJSON(v[name])
+		}
+	}
+	return v
+}
+
+// encodeJSONResponse returns the answer to the request with the given id.
+func encodeJSONResponse(id json.RawMessage, v interface{}) []byte {
+	return encodeJSON(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": v})
+}
+
+// encodeJSONFault returns the fault as a JSON-RPC error.
+func encodeJSONFault(id json.RawMessage, f *Fault) []byte {
+	return encodeJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   map[string]interface{}{"code": f.Code, "message": f.String},
+	})
+}
+
+func encodeJSON(v map[string]interface{}) []byte {
+	if id, ok := v["id"].(json.RawMessage); ok && len(id) == 0 {
+		v["id"] = nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("rtapitest: can't encode %v: %v", v, err))
+	}
+	return data
+}
@@ -0,0 +1,317 @@
+package rtapitest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Transport matches rtapi.Transport, it's repeated here so rtapi's own
+// tests can use this package.
+type Transport interface {
+	RoundTrip(ctx context.Context, body []byte) (io.ReadCloser, error)
+}
+
+// Golden files are numbered pairs in a directory: 0001.request.xml holds
+// the XML-RPC request and 0001.response the raw answer of rTorrent,
+// SCGI headers included.
+const (
+	requestSuffix  = ".request.xml"
+	responseSuffix = ".response"
+)
+
+// Recorder is a Transport that writes the requests it sends through
+// Transport, and the answers, to golden files in Dir. Pass it to
+// rtapi.WithTransport to record a session against a real rTorrent.
+type Recorder struct {
+	Transport Transport
+	Dir       string
+
+	// ScrubHashes replaces info hashes by placeholders in the files, the
+	// same hash always gets the same placeholder.
+	ScrubHashes bool
+	// ScrubPaths replaces path prefixes in the files, e.g. "/home/alice"
+	// by "/home/user". Paths are matched as they appear in the XML, with
+	// special characters escaped.
+	ScrubPaths map[string]string
+
+	mu     sync.Mutex
+	n      int
+	hashes map[string]string
+}
+
+var hashPattern = regexp.MustCompile(`\b[0-9A-Fa-f]{40}\b`)
+
+// RoundTrip sends body and records it with the answer, the caller gets the
+// answer unscrubbed.
+func (r *Recorder) RoundTrip(ctx context.Context, body []byte) (io.ReadCloser, error) {
+	resp, err := r.Transport.RoundTrip(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	data, err := io.ReadAll(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.MkdirAll(r.Dir, 0755); err != nil {
+		return nil, err
+	}
+	r.n++
+	name := filepath.Join(r.Dir, fmt.Sprintf("%04d", r.n))
+	if err := os.WriteFile(name+requestSuffix, r.scrub(body), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(name+responseSuffix, fixContentLength(r.scrub(data)), 0644); err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// scrub applies the scrubbing rules to data, r.mu must be held.
+func (r *Recorder) scrub(data []byte) []byte {
+	if r.ScrubHashes {
+		data = hashPattern.ReplaceAllFunc(data, func(hash []byte) []byte {
+			key := strings.ToUpper(string(hash))
+			if r.hashes == nil {
+				r.hashes = make(map[string]string)
+			}
+			placeholder, ok := r.hashes[key]
+			if !ok {
+				placeholder = fmt.Sprintf("%040d", len(r.hashes)+1)
+				r.hashes[key] = placeholder
+			}
+			return []byte(placeholder)
+		})
+	}
+
+	// longer prefixes first, so "/home/alice/tv" wins over "/home/alice".
+	prefixes := make([]string, 0, len(r.ScrubPaths))
+	for prefix := range r.ScrubPaths {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	for _, prefix := range prefixes {
+		data = bytes.ReplaceAll(data, []byte(prefix), []byte(r.ScrubPaths[prefix]))
+	}
+	return data
+}
+
+// fixContentLength updates the Content-Length header of a scrubbed
+// answer, if it has one.
+func fixContentLength(data []byte) []byte {
+	header, body, found := bytes.Cut(data, []byte("\r\n\r\n"))
+	if !found {
+		return data
+	}
+
+	lines := strings.Split(string(header), "\r\n")
+	for i, line := range lines {
+		if name, _, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			lines[i] = fmt.Sprintf("%s: %d", name, len(body))
+		}
+	}
+	return append([]byte(strings.Join(lines, "\r\n")+"\r\n\r\n"), body...)
+}
+
+// ErrNoRecording is returned by a Replayer for requests it has no answer to.
+var ErrNoRecording = errors.New("rtapitest: no recorded response for request")
+
+// Replayer is a Transport answering requests from golden files written
+// by a Recorder. Requests are matched by their method and decoded params,
+// not their exact text, and the fields of d.multicall2, t.multicall and the
+// other multicalls may be asked in any order or be a subset of the recorded
+// ones: the recorded answer is cut down to the fields asked for. Matching
+// requests get their answers in the recorded order and the last one is
+// repeated once they are used up.
+type Replayer struct {
+	mu         sync.Mutex
+	recordings map[string][]recording
+	served     map[string]int
+}
+
+// recording is a recorded request, split into the key it's matched by and
+// its multicall fields, and the answer to it.
+type recording struct {
+	fields   []string
+	response []byte
+}
+
+// NewReplayer loads the golden files in dir.
+func NewReplayer(dir string) (*Replayer, error) {
+	requests, err := filepath.Glob(filepath.Join(dir, "*"+requestSuffix))
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("rtapitest: no recordings in %s", dir)
+	}
+	sort.Strings(requests)
+
+	r := &Replayer{
+		recordings: make(map[string][]recording),
+		served:     make(map[string]int),
+	}
+	for _, name := range requests {
+		req, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := os.ReadFile(strings.TrimSuffix(name, requestSuffix) + responseSuffix)
+		if err != nil {
+			return nil, err
+		}
+
+		key, fields := requestKey(req)
+		r.recordings[key] = append(r.recordings[key], recording{fields: fields, response: resp})
+	}
+	return r, nil
+}
+
+// RoundTrip returns the recorded answer for body.
+func (r *Replayer) RoundTrip(ctx context.Context, body []byte) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key, fields := requestKey(body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matches []recording
+	for _, rec := range r.recordings[key] {
+		if columns(rec.fields, fields) != nil {
+			matches = append(matches, rec)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, ErrNoRecording
+	}
+
+	served := key + "\x00" + strings.Join(fields, "\x00")
+	i := r.served[served]
+	if i >= len(matches) {
+		i = len(matches) - 1
+	}
+	r.served[served]++
+
+	resp, err := project(matches[i].response, columns(matches[i].fields, fields))
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(resp)), nil
+}
+
+// requestKey returns the key a request is matched by, its method and the
+// canonical encoding of its params, and apart the fields of a multicall.
+// Bodies which aren't XML-RPC, such as JSON-RPC, are matched as they are.
+func requestKey(body []byte) (string, []string) {
+	method, params, err := decodeMethodCall(bytes.NewReader(body))
+	if err != nil {
+		return "raw:" + string(body), nil
+	}
+
+	var fields []string
+	if isFieldMulticall(method) {
+		kept := params[:0:0]
+		for _, p := range params {
+			if s, ok := p.(string); ok && strings.Contains(s, "=") {
+				fields = append(fields, s)
+				continue
+			}
+			kept = append(kept, p)
+		}
+		params = kept
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(method)
+	for _, p := range params {
+		encodeValue(buf, p)
+	}
+	return buf.String(), fields
+}
+
+// isFieldMulticall reports whether method takes a list of commands, one per
+// field of the rows it answers, like d.multicall2 or t.multicall.
+func isFieldMulticall(method string) bool {
+	return method != "system.multicall" &&
+		(strings.HasSuffix(method, ".multicall") || strings.HasSuffix(method, ".multicall2"))
+}
+
+// columns returns the index in recorded of every field of requested, or nil
+// if one wasn't recorded. Requests without fields match only recordings
+// without fields.
+func columns(recorded, requested []string) []int {
+	if len(requested) == 0 {
+		if len(recorded) != 0 {
+			return nil
+		}
+		return []int{}
+	}
+
+	cols := make([]int, len(requested))
+	for i, field := range requested {
+		cols[i] = slices.Index(recorded, field)
+		if cols[i] < 0 {
+			return nil
+		}
+	}
+	return cols
+}
+
+// project cuts the rows of a recorded multicall answer down to cols, the
+// answer is returned as is if cols are all its fields in order, or if it
+// isn't a list of rows, e.g. a fault.
+func project(resp []byte, cols []int) ([]byte, error) {
+	identity := true
+	for i, col := range cols {
+		identity = identity && col == i
+	}
+
+	header, body, found := bytes.Cut(resp, []byte("\r\n\r\n"))
+	if identity || !found {
+		return resp, nil
+	}
+
+	v, err := decodeMethodResponse(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("rtapitest: recorded response: %w", err)
+	}
+	rows, ok := v.([]interface{})
+	if !ok {
+		return resp, nil
+	}
+
+	projected := make([]interface{}, len(rows))
+	for i, row := range rows {
+		fields, ok := row.([]interface{})
+		if !ok || len(fields) <= slices.Max(cols) {
+			return nil, fmt.Errorf("rtapitest: recorded row %d doesn't hold every field", i)
+		}
+		picked := make([]interface{}, len(cols))
+		for j, col := range cols {
+			picked[j] = fields[col]
+		}
+		projected[i] = picked
+	}
+
+	data := slices.Concat(header, []byte("\r\n\r\n"), encodeResponse(projected))
+	return fixContentLength(data), nil
+}
@@ -0,0 +1,516 @@
+// Package rtapitest provides a fake rTorrent for testing clients.
+//
+// The fake speaks XML-RPC over SCGI on a TCP or unix socket, and over HTTP
+// as a handler, as if rTorrent was behind a web server; JSON-RPC can be
+// enabled with SetJSONRPC. It keeps an in-memory table of torrents, so calls
+// like d.start or load.start change what later d.multicall2 calls report:
+//
+//	srv := rtapitest.NewServer()
+//	defer srv.Close()
+//	srv.AddTorrent(&rtapitest.Torrent{Hash: "8856B9...", Name: "ubuntu.iso", Size: 1 << 30})
+//	rt, _ := rtapi.NewRtorrent(srv.Addr)
+//
+// Faults and latency can be injected per method to test error paths.
+package rtapitest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session holds the global values reported by the fake.
+type Session struct {
+	ClientVersion  string // system.client_version
+	LibraryVersion string // system.library_version
+	Port           int64  // network.listen.port
+	Directory      string // directory.default
+	UpMax          int64  // throttle.global_up.max_rate, also throttle.up.max
+	DownMax        int64  // throttle.global_down.max_rate, also throttle.down.max
+	UpTotal        int64  // throttle.global_up.total
+	DownTotal      int64  // throttle.global_down.total
+	OpenSockets    int64  // network.open_sockets
+	MaxOpenSockets int64  // network.max_open_sockets
+	MaxPeers       int64  // throttle.max_peers.normal
+	MaxPeersSeed   int64  // throttle.max_peers.seed
+	DHTMode        string // dht.statistics, the node is active unless "off" or "disable"
+	DHTNodes       int64  // dht.statistics
+	MemoryUsage    int64  // pieces.memory.current
+	MaxMemory      int64  // pieces.memory.max
+	FreeDiskSpace  int64  // d.free_diskspace of every torrent
+	StartupTime    int64  // system.startup_time, in seconds since the epoch
+}
+
+// DefaultSession is the session a new Server starts with.
+var DefaultSession = Session{
+	ClientVersion:  "0.9.8",
+	LibraryVersion: "0.13.8",
+	Port:           6980,
+	Directory:      "/downloads",
+	MaxPeers:       100,
+	MaxPeersSeed:   50,
+	DHTMode:        "auto",
+}
+
+// Fault is an XML-RPC fault returned by the fake.
+type Fault struct {
+	Code   int
+	String string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("fault %d: %s", f.Code, f.String)
+}
+
+func (f *Fault) value() map[string]interface{} {
+	return map[string]interface{}{
+		"faultCode":   int64(f.Code),
+		"faultString": f.String,
+	}
+}
+
+// Call is a method call received by the fake, calls nested in
+// system.multicall are recorded as well.
+type Call struct {
+	Method string
+	Params []interface{}
+}
+
+// Server is a fake rTorrent listening on a local socket.
+type Server struct {
+	// Network and Addr are where the fake listens, Addr can be passed
+	// to rtapi.NewRtorrent as is.
+	Network string
+	Addr    string
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	session  Session
+	torrents []*Torrent
+	calls    []Call
+	faults   map[string]*Fault
+	latency  time.Duration
+	hangups  int
+	jsonrpc  bool
+	closed   bool
+
+	inflight    int
+	maxInflight int
+}
+
+// NewServer starts a fake rTorrent on a TCP port of the loopback
+// interface. It panics if it can't listen.
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("rtapitest: failed to listen: %v", err))
+	}
+	return newServer(l)
+}
+
+// NewUnixServer starts a fake rTorrent on the unix socket at path, which
+// is removed on Close. It panics if it can't listen.
+func NewUnixServer(path string) *Server {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		panic(fmt.Sprintf("rtapitest: failed to listen on %s: %v", path, err))
+	}
+	return newServer(l)
+}
+
+func newServer(l net.Listener) *Server {
+	s := &Server{
+		Network:  l.Addr().Network(),
+		Addr:     l.Addr().String(),
+		listener: l,
+		session:  DefaultSession,
+		faults:   make(map[string]*Fault),
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Close stops the fake and waits for in-flight requests.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	s.listener.Close()
+	s.wg.Wait()
+	if s.Network == "unix" {
+		os.Remove(s.Addr)
+	}
+}
+
+// AddTorrent adds torrents to the table, replacing any with the same hash.
+func (s *Server) AddTorrent(ts ...*Torrent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range ts {
+		s.add(t.clone())
+	}
+}
+
+func (s *Server) add(t *Torrent) {
+	t.Hash = strings.ToUpper(t.Hash)
+	for i := range s.torrents {
+		if s.torrents[i].Hash == t.Hash {
+			s.torrents[i] = t
+			return
+		}
+	}
+	s.torrents = append(s.torrents, t)
+}
+
+// Torrent returns a copy of the torrent with hash, or nil.
+func (s *Server) Torrent(hash string) *Torrent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t := s.lookup(hash); t != nil {
+		return t.clone()
+	}
+	return nil
+}
+
+// Torrents returns a copy of all torrents, in the order they were added.
+func (s *Server) Torrents() []*Torrent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts := make([]*Torrent, len(s.torrents))
+	for i, t := range s.torrents {
+		ts[i] = t.clone()
+	}
+	return ts
+}
+
+// UpdateTorrent calls fn with the torrent with hash, it reports whether
+// the torrent exists.
+func (s *Server) UpdateTorrent(hash string, fn func(t *Torrent)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.lookup(hash)
+	if t == nil {
+		return false
+	}
+	fn(t)
+	return true
+}
+
+// RemoveTorrent removes the torrent with hash from the table.
+func (s *Server) RemoveTorrent(hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(hash)
+}
+
+func (s *Server) lookup(hash string) *Torrent {
+	hash = strings.ToUpper(hash)
+	for _, t := range s.torrents {
+		if t.Hash == hash {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *Server) remove(hash string) bool {
+	hash = strings.ToUpper(hash)
+	for i, t := range s.torrents {
+		if t.Hash == hash {
+			s.torrents = append(s.torrents[:i], s.torrents[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Session returns the global values.
+func (s *Server) Session() Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.session
+}
+
+// SetSession replaces the global values.
+func (s *Server) SetSession(session Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = session
+}
+
+// SetFault makes calls to method fail with an XML-RPC fault, including
+// calls nested in system.multicall, until ClearFaults.
+func (s *Server) SetFault(method string, code int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[method] = &Fault{Code: code, String: message}
+}
+
+// ClearFaults removes the faults set by SetFault.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = make(map[string]*Fault)
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetJSONRPC makes the fake accept JSON-RPC 2.0 requests next to XML-RPC
+// ones, like rTorrent forks do. Otherwise they get the XML-RPC fault stock
+// rTorrent answers them with.
+func (s *Server) SetJSONRPC(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jsonrpc = enabled
+}
+
+// Hangup makes the fake close the next n connections without answering.
+func (s *Server) Hangup(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hangups = n
+}
+
+// Calls returns the method calls received so far.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// CallCount returns how many times method was called.
+func (s *Server) CallCount(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, c := range s.calls {
+		if c.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+// MaxConcurrency returns the most requests the fake handled at once.
+func (s *Server) MaxConcurrency() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxInflight
+}
+
+// ResetCalls forgets the recorded calls.
+func (s *Server) ResetCalls() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	body, ct, err := readRequest(bufio.NewReader(conn))
+	if err != nil {
+		writeResponse(conn, "400 Bad Request", []byte(err.Error()))
+		return
+	}
+
+	if resp, ok := s.respond(body, ct); ok {
+		writeResponse(conn, "200 OK", resp)
+	}
+}
+
+// ServeHTTP answers XML-RPC (or JSON-RPC) requests POSTed to any path, so the fake can be
+// mounted with httptest.NewServer to test HTTP transports.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "XML-RPC requires POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, ok := s.respond(body, r.Header.Get("Content-Type"))
+	if !ok {
+		// hang up on the client.
+		panic(http.ErrAbortHandler)
+	}
+	w.Header().Set("Content-Type", contentType(resp))
+	w.Write(resp)
+}
+
+// respond runs the request in body, sent with the content type ct. It
+// returns false when the connection should be dropped instead.
+func (s *Server) respond(body []byte, ct string) ([]byte, bool) {
+	s.mu.Lock()
+	latency := s.latency
+	jsonrpc := s.jsonrpc
+	hangup := s.hangups > 0
+	if hangup {
+		s.hangups--
+	}
+	s.inflight++
+	s.maxInflight = max(s.maxInflight, s.inflight)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.inflight--
+		s.mu.Unlock()
+	}()
+
+	if hangup {
+		return nil, false
+	}
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	if jsonrpc && ct == "application/json" {
+		return s.respondJSON(body), true
+	}
+
+	method, params, err := decodeMethodCall(bytes.NewReader(body))
+	if err != nil {
+		return encodeFault(&Fault{Code: -32700, String: "parse error: " + err.Error()}), true
+	}
+
+	s.mu.Lock()
+	result, err := s.call(method, params)
+	s.mu.Unlock()
+
+	if f, ok := err.(*Fault); ok {
+		return encodeFault(f), true
+	}
+	return encodeResponse(result), true
+}
+
+// respondJSON runs the JSON-RPC request in body.
+func (s *Server) respondJSON(body []byte) []byte {
+	call, err := decodeJSONCall(body)
+	if err != nil {
+		return encodeJSONFault(nil, &Fault{Code: -32700, String: "parse error: " + err.Error()})
+	}
+
+	s.mu.Lock()
+	result, err := s.call(call.Method, call.Params)
+	s.mu.Unlock()
+
+	if f, ok := err.(*Fault); ok {
+		return encodeJSONFault(call.ID, f)
+	}
+	return encodeJSONResponse(call.ID, result)
+}
+
+// contentType returns the content type of the answer body.
+func contentType(body []byte) string {
+	if isJSON(body) {
+		return "application/json"
+	}
+	return "text/xml"
+}
+
+// Limits of the requests the fake reads, rTorrent's own are similar.
+const (
+	maxHeaders = 64 << 10
+	maxBody    = 64 << 20
+)
+
+// readRequest reads an SCGI request and returns its body and CONTENT_TYPE.
+func readRequest(r *bufio.Reader) (body []byte, ct string, err error) {
+	size, err := r.ReadString(':')
+	if err != nil {
+		return nil, "", fmt.Errorf("read netstring length: %w", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(size, ":"))
+	if err != nil || n <= 0 || n > maxHeaders {
+		return nil, "", fmt.Errorf("invalid netstring length %q", size)
+	}
+
+	headers := make([]byte, n+1) // including the trailing ','
+	if _, err := io.ReadFull(r, headers); err != nil {
+		return nil, "", fmt.Errorf("read headers: %w", err)
+	}
+	if headers[n] != ',' {
+		return nil, "", fmt.Errorf("netstring not terminated by ','")
+	}
+
+	fields := strings.Split(string(headers[:n]), "\x00")
+	length := -1
+	for i := 0; i+1 < len(fields); i += 2 {
+		switch fields[i] {
+		case "CONTENT_LENGTH":
+			length, err = strconv.Atoi(fields[i+1])
+			if err != nil || length < 0 {
+				return nil, "", fmt.Errorf("invalid CONTENT_LENGTH %q", fields[i+1])
+			}
+		case "CONTENT_TYPE":
+			ct = fields[i+1]
+		}
+	}
+	if length < 0 {
+		return nil, "", fmt.Errorf("missing CONTENT_LENGTH")
+	}
+	if length > maxBody {
+		return nil, "", fmt.Errorf("CONTENT_LENGTH %d too large", length)
+	}
+
+	body = make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, "", fmt.Errorf("read body: %w", err)
+	}
+	return body, ct, nil
+}
+
+func writeResponse(w io.Writer, status string, body []byte) {
+	fmt.Fprintf(w, "Status: %s\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n", status, contentType(body), len(body))
+	w.Write(body)
+}
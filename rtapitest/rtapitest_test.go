@@ -0,0 +1,645 @@
+package rtapitest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+const (
+	ubuntuHash = "8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648"
+	archHash   = "02CA77A6A047FD37F04337437D18F82E61861084"
+)
+
+func newTestServer(t *testing.T) (*Server, *rtapi.Rtorrent) {
+	t.Helper()
+
+	srv := NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddTorrent(
+		&Torrent{
+			Hash:      ubuntuHash,
+			Name:      "ubuntu-17.04-server-amd64.iso",
+			Directory: "/downloads",
+			Size:      1370 * 524288,
+			Completed: 1370 * 524288,
+			ChunkSize: 524288,
+			UpRate:    593,
+			UpTotal:   1370 * 524288 / 2,
+			Open:      true,
+			Active:    true,
+			Started:   true,
+			Trackers:  []Tracker{{URL: "http://torrent.ubuntu.com:6969/announce", Enabled: true, Seeders: 12}},
+		},
+		&Torrent{
+			Hash:      archHash,
+			Name:      "archlinux-2017.04.01-x86_64.iso",
+			Directory: "/downloads",
+			Size:      956 * 524288,
+			Completed: 115 * 524288,
+			ChunkSize: 524288,
+			DownRate:  997035,
+			Open:      true,
+			Active:    true,
+			Started:   true,
+			Custom1:   "Linux",
+			Trackers:  []Tracker{{URL: "udp://tracker.archlinux.org:6969", Enabled: true}},
+		},
+	)
+
+	rt, err := rtapi.NewRtorrent(srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, rt
+}
+
+func TestTorrents(t *testing.T) {
+	_, rt := newTestServer(t)
+
+	ts, err := rt.Torrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ts) != 2 {
+		t.Fatalf("Expected 2 torrents, got: %d", len(ts))
+	}
+
+	ubuntu, arch := ts[0], ts[1]
+	if ubuntu.State != rtapi.Seeding || ubuntu.Ratio != 0.5 || ubuntu.Path != "/downloads/ubuntu-17.04-server-amd64.iso" {
+		t.Errorf("Unexpected torrent: %+v", ubuntu)
+	}
+	if ubuntu.Tracker.Host != "torrent.ubuntu.com:6969" {
+		t.Errorf("Expected the ubuntu tracker, got: %s", ubuntu.Tracker)
+	}
+	if arch.State != rtapi.Leeching || arch.Percent != "12.0%" || arch.Label != "Linux" {
+		t.Errorf("Unexpected torrent: %+v", arch)
+	}
+}
+
+func TestActions(t *testing.T) {
+	srv, rt := newTestServer(t)
+
+	arch, err := rt.GetTorrent(archHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rt.Stop(arch); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Torrent(archHash); got.Active || got.Started {
+		t.Errorf("Expected the torrent to be stopped, got: %+v", got)
+	}
+	if arch, _ = rt.GetTorrent(archHash); arch.State != rtapi.Stopped {
+		t.Errorf("Expected %s, got: %s", rtapi.Stopped, arch.State)
+	}
+
+	if err := rt.Start(arch); err != nil {
+		t.Fatal(err)
+	}
+	if arch, _ = rt.GetTorrent(archHash); arch.State != rtapi.Leeching {
+		t.Errorf("Expected %s, got: %s", rtapi.Leeching, arch.State)
+	}
+
+	if err := rt.SetLabel("Software", arch); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Torrent(archHash).Custom1; got != "Software" {
+		t.Errorf("Expected label Software, got: %q", got)
+	}
+
+	if err := rt.Delete(false, arch); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Torrent(archHash) != nil {
+		t.Error("Expected the torrent to be erased")
+	}
+	if n := srv.CallCount("d.erase"); n != 1 {
+		t.Errorf("Expected 1 d.erase call, got: %d", n)
+	}
+}
+
+func TestActionsNotFound(t *testing.T) {
+	srv, rt := newTestServer(t)
+
+	arch, err := rt.GetTorrent(archHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gone := &rtapi.Torrent{Hash: "0000000000000000000000000000000000000000"}
+
+	actions := map[string]func(ts ...*rtapi.Torrent) error{
+		"Start":      rt.Start,
+		"Stop":       rt.Stop,
+		"Pause":      rt.Pause,
+		"Resume":     rt.Resume,
+		"Open":       rt.Open,
+		"Close":      rt.Close,
+		"Check":      rt.Check,
+		"ForceStart": rt.ForceStart,
+		"SetLabel":   func(ts ...*rtapi.Torrent) error { return rt.SetLabel("Software", ts...) },
+	}
+	for name, action := range actions {
+		err := action(arch, gone)
+		if !errors.Is(err, rtapi.ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound, got: %v", name, err)
+			continue
+		}
+		if n := strings.Count(err.Error(), gone.Hash); n != 1 {
+			t.Errorf("%s: expected the unknown hash once, got: %v", name, err)
+		}
+		if strings.Contains(err.Error(), arch.Hash) {
+			t.Errorf("%s: expected no error for the known torrent, got: %v", name, err)
+		}
+	}
+
+	srv.SetFault("d.custom1.set", -503, "Wrong object type.")
+	var fault *rtapi.Fault
+	if err := rt.SetLabel("Linux", arch); !errors.As(err, &fault) || fault.Code != -503 || errors.Is(err, rtapi.ErrNotFound) {
+		t.Errorf("Expected the fault, got: %v", err)
+	}
+	srv.ClearFaults()
+
+	arch.Path, gone.Path = t.TempDir(), t.TempDir()
+	err = rt.Delete(true, arch, gone)
+	if !errors.Is(err, rtapi.ErrNotFound) || !strings.Contains(err.Error(), gone.Hash) {
+		t.Errorf("Expected ErrNotFound for the unknown hash, got: %v", err)
+	}
+	if srv.Torrent(archHash) != nil {
+		t.Error("Expected the torrent to be erased")
+	}
+	if _, err := os.Stat(arch.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected the data of the erased torrent to be deleted, got: %v", err)
+	}
+	if _, err := os.Stat(gone.Path); err != nil {
+		t.Errorf("Expected the data of the unknown torrent to be kept, got: %v", err)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	srv, rt := newTestServer(t)
+
+	err := rt.DownloadWithOptions(&rtapi.DotTorrentWithOptions{
+		Link:  "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=debian.iso",
+		Dir:   `/data/my "files"`,
+		Label: "Linux, BSD",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := srv.Torrent("0123456789ABCDEF0123456789ABCDEF01234567")
+	if got == nil {
+		t.Fatal("Expected the magnet link to be loaded")
+	}
+	if got.Name != "debian.iso" || got.Directory != `/data/my "files"` || got.Custom1 != "Linux, BSD" || !got.Started {
+		t.Errorf("Unexpected torrent: %+v", got)
+	}
+
+	if err := rt.Download("http://example.com/arch.torrent"); err != nil {
+		t.Fatal(err)
+	}
+	if ts := srv.Torrents(); len(ts) != 4 || ts[3].Name != "arch" {
+		t.Errorf("Expected the URL to be loaded, got: %d torrents", len(ts))
+	}
+}
+
+func TestLoadRaw(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	info := "d6:lengthi1000e4:name8:file.iso12:piece lengthi512e6:pieces0:e"
+	meta := []byte("d8:announce0:4:info" + info + "e")
+
+	srv.mu.Lock()
+	_, err := srv.call("load.raw_start", []interface{}{"", meta, "d.custom1.set=Linux"})
+	srv.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha1.Sum([]byte(info))
+	got := srv.Torrent(hex.EncodeToString(sum[:]))
+	if got == nil {
+		t.Fatal("Expected the torrent to be loaded by its info hash")
+	}
+	if got.Name != "file.iso" || got.Size != 1000 || got.ChunkSize != 512 || got.Custom1 != "Linux" {
+		t.Errorf("Unexpected torrent: %+v", got)
+	}
+	if len(got.Files) != 1 || got.Files[0].SizeChunks != 2 {
+		t.Errorf("Unexpected files: %+v", got.Files)
+	}
+
+	srv.mu.Lock()
+	_, err = srv.call("load.raw", []interface{}{"", []byte("not a torrent")})
+	srv.mu.Unlock()
+	if _, ok := err.(*Fault); !ok {
+		t.Errorf("Expected a fault for invalid data, got: %v", err)
+	}
+}
+
+func TestSession(t *testing.T) {
+	srv, rt := newTestServer(t)
+	srv.SetSession(Session{ClientVersion: "0.9.6", LibraryVersion: "0.13.6", Port: 6980, Directory: "/downloads", UpTotal: 6841, DownTotal: 7476,
+		MaxPeers: 40, DHTMode: "on", DHTNodes: 90, FreeDiskSpace: 5 << 30, StartupTime: time.Now().Add(-time.Hour).Unix()})
+
+	down, up := rt.Speeds()
+	if down != 997035 || up != 593 {
+		t.Errorf("Expected 997035/593, got: %d/%d", down, up)
+	}
+
+	srv.SetFault("throttle.global_up.rate", -501, "Unreachable.")
+	if _, err := rt.Transfer(context.Background()); err == nil {
+		t.Error("Expected the fault to be returned by Transfer")
+	}
+	if down, up := rt.Speeds(); down != 0 || up != 0 {
+		t.Errorf("Expected 0/0 from Speeds, got: %d/%d", down, up)
+	}
+	srv.ClearFaults()
+
+	srv.ResetCalls()
+	st, err := rt.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.CallCount("system.multicall"); n != 1 {
+		t.Errorf("Expected Stats to make a single multicall, got: %v", srv.Calls())
+	}
+	if st.Port != 6980 || st.Directory != "/downloads" || st.TotalUp != 6841 || st.TotalDown != 7476 {
+		t.Errorf("Unexpected stats: %+v", st)
+	}
+	if st.MaxPeers != 40 || !st.DHT.Active || st.DHT.Nodes != 90 || st.FreeDiskSpace != 5<<30 || st.Uptime < time.Hour {
+		t.Errorf("Unexpected stats: %+v", st)
+	}
+	if st.Torrents.Total != len(srv.Torrents()) {
+		t.Errorf("Expected %d torrents, got: %+v", len(srv.Torrents()), st.Torrents)
+	}
+
+	version, err := rt.Call("system.client_version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "0.9.6" {
+		t.Errorf("Expected 0.9.6, got: %v", version)
+	}
+}
+
+func TestDetails(t *testing.T) {
+	srv, rt := newTestServer(t)
+	srv.UpdateTorrent(archHash, func(t *Torrent) {
+		t.Files = []File{{Path: "arch.iso", Size: 956 * 524288, SizeChunks: 956, CompletedChunks: 115, Priority: 1}}
+		t.Peers = []Peer{{Address: "10.0.0.2", Port: 51413, Client: "Transmission 2.94", DownRate: 1024, Percent: 100}}
+	})
+
+	arch := &rtapi.Torrent{Hash: archHash}
+	files, err := rt.Files(arch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "arch.iso" || files[0].CompletedChunks != 115 {
+		t.Errorf("Unexpected files: %+v", files)
+	}
+
+	peers, err := rt.Peers(arch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0].Address != "10.0.0.2" || peers[0].Percent != 100 {
+		t.Errorf("Unexpected peers: %+v", peers)
+	}
+
+	trackers, err := rt.Trackers(&rtapi.Torrent{Hash: ubuntuHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trackers) != 1 || !trackers[0].Enabled || trackers[0].Seeders != 12 {
+		t.Errorf("Unexpected trackers: %+v", trackers)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	srv, rt := newTestServer(t)
+
+	srv.SetFault("d.multicall2", -501, "Could not find view")
+	if _, err := rt.Torrents(); err == nil {
+		t.Error("Expected an error for a faulty d.multicall2")
+	}
+
+	srv.ClearFaults()
+	srv.SetFault("d.ratio", -506, "Method 'd.ratio' not defined")
+	if _, err := rt.Torrents(); err == nil {
+		t.Error("Expected an error for a faulty field")
+	}
+
+	srv.ClearFaults()
+	srv.SetFault("t.url", -501, "Could not find info-hash.")
+	srv.mu.Lock()
+	result, _ := srv.call("system.multicall", []interface{}{[]interface{}{
+		map[string]interface{}{"methodName": "t.url", "params": []interface{}{ubuntuHash + ":t0"}},
+		map[string]interface{}{"methodName": "d.name", "params": []interface{}{ubuntuHash}},
+	}})
+	srv.mu.Unlock()
+
+	results := result.([]interface{})
+	if f, ok := results[0].(map[string]interface{}); !ok || f["faultCode"] != int64(-501) {
+		t.Errorf("Expected a fault struct, got: %v", results[0])
+	}
+	if v, ok := results[1].([]interface{}); !ok || v[0] != "ubuntu-17.04-server-amd64.iso" {
+		t.Errorf("Expected the name, got: %v", results[1])
+	}
+
+	srv.ClearFaults()
+	if _, err := rt.Call("d.name", "DEADBEEF"); err == nil {
+		t.Error("Expected an error for an unknown hash")
+	}
+}
+
+func TestLatencyAndHangup(t *testing.T) {
+	srv, rt := newTestServer(t)
+
+	srv.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	if _, err := rt.Torrents(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected at least 50ms, got: %s", elapsed)
+	}
+
+	srv.SetLatency(0)
+	srv.Hangup(1)
+	if _, err := rt.Torrents(); err == nil {
+		t.Error("Expected an error when the connection is closed")
+	}
+	if _, err := rt.Torrents(); err != nil {
+		t.Errorf("Expected the next call to succeed, got: %v", err)
+	}
+}
+
+func TestUnixServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rtorrent.sock")
+	srv := NewUnixServer(path)
+	defer srv.Close()
+
+	if srv.Network != "unix" || srv.Addr != path {
+		t.Errorf("Expected unix %s, got: %s %s", path, srv.Network, srv.Addr)
+	}
+
+	rt, err := rtapi.NewRtorrent(srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Download("magnet:?xt=urn:btih:ALFHPJVAI76TP4CDG5BX2GHYFZQYMEEE"); err != nil {
+		t.Fatal(err)
+	}
+	if ts := srv.Torrents(); len(ts) != 1 || ts[0].Hash != "02CA77A6A047FD37F04337437D18F82E61861084" {
+		t.Errorf("Expected the base32 magnet to be loaded, got: %+v", ts)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	srv, _ := newTestServer(t)
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	rt, err := rtapi.NewRtorrent(hs.URL + "/RPC2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	torrents, err := rt.Torrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 2 {
+		t.Errorf("Expected 2 torrents over HTTP, got: %d", len(torrents))
+	}
+
+	srv.Hangup(1)
+	if _, err := rt.Call("system.client_version"); err == nil {
+		t.Error("Expected an error when the connection is closed")
+	}
+
+	resp, err := http.Get(hs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for GET, got: %d", resp.StatusCode)
+	}
+}
+
+func TestJSONRPC(t *testing.T) {
+	srv, _ := newTestServer(t)
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	post := func(body string) (string, string) {
+		t.Helper()
+		resp, err := http.Post(hs.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Header.Get("Content-Type"), string(data)
+	}
+
+	// stock rTorrent reads the request as XML.
+	req := `{"jsonrpc":"2.0","method":"d.name","params":["` + ubuntuHash + `"],"id":7}`
+	if ct, body := post(req); ct != "text/xml" || !strings.Contains(body, "<fault>") {
+		t.Errorf("Expected an XML-RPC fault, got %s: %s", ct, body)
+	}
+
+	srv.SetJSONRPC(true)
+	testCases := []struct {
+		req      string
+		expected string
+	}{
+		{req, `{"id":7,"jsonrpc":"2.0","result":"ubuntu-17.04-server-amd64.iso"}`},
+		{
+			`{"jsonrpc":"2.0","method":"system.multicall","params":[[{"methodName":"d.up.rate","params":["` + ubuntuHash + `"]}]],"id":"a"}`,
+			`{"id":"a","jsonrpc":"2.0","result":[[593]]}`,
+		},
+		{
+			`{"jsonrpc":"2.0","method":"d.name","params":["0000"],"id":1}`,
+			`{"error":{"code":-501,"message":"Could not find info-hash."},"id":1,"jsonrpc":"2.0"}`,
+		},
+		{`{"jsonrpc":`, `{"error":{"code":-32700,"message":"parse error: unexpected EOF"},"id":null,"jsonrpc":"2.0"}`},
+	}
+
+	for i, test := range testCases {
+		if ct, body := post(test.req); ct != "application/json" || body != test.expected {
+			t.Errorf("Case %d: Expected %s, got %s: %s", i, test.expected, ct, body)
+		}
+	}
+}
+
+func TestCodec(t *testing.T) {
+	when := time.Date(2017, 4, 12, 21, 20, 19, 0, time.UTC)
+	values := []interface{}{
+		"a < b & c",
+		int64(-42),
+		3.5,
+		true,
+		[]byte{0, 1, 2},
+		when,
+		nil,
+		[]interface{}{"x", int64(1)},
+		map[string]interface{}{"name": "value"},
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("<methodCall><methodName>test</methodName><params>")
+	for _, v := range values {
+		buf.WriteString("<param>")
+		encodeValue(buf, v)
+		buf.WriteString("</param>")
+	}
+	buf.WriteString("<param><value>untyped</value></param>")
+	buf.WriteString(`<param><value><ex:i8 xmlns:ex="http://ws.apache.org/xmlrpc/namespaces/extensions">7</ex:i8></value></param>`)
+	buf.WriteString("</params></methodCall>")
+
+	method, params, err := decodeMethodCall(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != "test" || len(params) != len(values)+2 {
+		t.Fatalf("Unexpected call %s with %d params", method, len(params))
+	}
+
+	for i, v := range values {
+		got, want := params[i], v
+		switch want := want.(type) {
+		case []byte:
+			if !bytes.Equal(got.([]byte), want) {
+				t.Errorf("Param %d: expected %v, got: %v", i, want, got)
+			}
+		case time.Time:
+			if !got.(time.Time).Equal(want) {
+				t.Errorf("Param %d: expected %v, got: %v", i, want, got)
+			}
+		case []interface{}, map[string]interface{}:
+			if toString(got) != toString(want) {
+				t.Errorf("Param %d: expected %v, got: %v", i, want, got)
+			}
+		default:
+			if got != want {
+				t.Errorf("Param %d: expected %v, got: %v", i, want, got)
+			}
+		}
+	}
+	if params[len(values)] != "untyped" || params[len(values)+1] != int64(7) {
+		t.Errorf("Unexpected extension values: %v", params[len(values):])
+	}
+}
+
+func toString(v interface{}) string {
+	buf := new(bytes.Buffer)
+	encodeValue(buf, v)
+	return buf.String()
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv, _ := newTestServer(t)
+	dir := t.TempDir()
+
+	rec := &Recorder{
+		Transport:   &rtapi.SCGITransport{Network: srv.Network, Address: srv.Addr},
+		Dir:         dir,
+		ScrubHashes: true,
+		ScrubPaths:  map[string]string{"/downloads": "/data"},
+	}
+	rt, err := rtapi.NewRtorrent(srv.Addr, rtapi.WithTransport(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, err := rt.Torrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live[0].Hash != ubuntuHash {
+		t.Errorf("Expected the caller to get real hashes, got: %s", live[0].Hash)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 6 {
+		t.Fatalf("Expected 3 recorded pairs, got: %v", files)
+	}
+	for _, name := range files {
+		data, _ := os.ReadFile(name)
+		if bytes.Contains(data, []byte(ubuntuHash)) || bytes.Contains(data, []byte("/downloads/")) {
+			t.Errorf("Expected %s to be scrubbed", name)
+		}
+	}
+
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err = rtapi.NewRtorrent("", rtapi.WithTransport(replayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := rt.Torrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 2 || replayed[0].Hash != "0000000000000000000000000000000000000001" || replayed[0].Path != "/data/ubuntu-17.04-server-amd64.iso" {
+		t.Errorf("Unexpected replayed torrent: %+v", replayed[0])
+	}
+	if replayed[1].Percent != live[1].Percent || replayed[1].Label != live[1].Label {
+		t.Errorf("Expected %+v, got: %+v", live[1], replayed[1])
+	}
+
+	// requests are matched by their fields, whatever their order.
+	rows, err := rt.Call("d.multicall2", "", "main", "d.custom1=", "d.hash=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{
+		[]interface{}{"", "0000000000000000000000000000000000000001"},
+		[]interface{}{live[1].Label, "0000000000000000000000000000000000000002"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected %v, got: %v", expected, rows)
+	}
+	if _, err := rt.Call("d.multicall2", "", "main", "d.hash=", "d.peers_connected="); err != ErrNoRecording {
+		t.Errorf("Expected ErrNoRecording for a field which wasn't recorded, got: %v", err)
+	}
+
+	if _, err := rt.Call("d.name", ubuntuHash); err != ErrNoRecording {
+		t.Errorf("Expected ErrNoRecording, got: %v", err)
+	}
+}
+
+func FuzzReadRequest(f *testing.F) {
+	f.Add([]byte("24:CONTENT_LENGTH\x002\x00SCGI\x001\x00,ab"))
+	f.Add([]byte("0:,"))
+	f.Add([]byte("5:CONTENT_LENGTH,"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		body, _, err := readRequest(bufio.NewReader(bytes.NewReader(data)))
+		if err == nil && !bytes.Contains(data, body) {
+			t.Errorf("Body %q is not part of the request", body)
+		}
+	})
+}
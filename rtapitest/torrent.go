@@ -0,0 +1,262 @@
+package rtapitest
+
+// Torrent is a torrent held by the fake. Fields map onto rTorrent's d.*
+// commands; values like d.complete, d.ratio or d.size_chunks are derived
+// from them the way rTorrent does.
+type Torrent struct {
+	Hash      string // d.hash, upper case hex
+	Name      string // d.name
+	Directory string // d.directory, d.base_path is Directory/Name
+	Size      int64  // d.size_bytes
+	Completed int64  // d.completed_bytes
+	ChunkSize int64  // d.chunk_size, 256 KiB if zero
+
+	DownRate  int64 // d.down.rate
+	UpRate    int64 // d.up.rate
+	DownTotal int64 // d.down.total
+	UpTotal   int64 // d.up.total
+	Skipped   int64 // d.skip.total
+
+	// Open, Active and Started are d.is_open, d.is_active and d.state.
+	Open    bool
+	Active  bool
+	Started bool
+	Hashing int64  // d.hashing
+	Message string // d.message
+
+	Priority  int64  // d.priority, 0 off to 3 high
+	Private   bool   // d.is_private
+	MultiFile bool   // d.is_multi_file
+	Throttle  string // d.throttle_name
+
+	LoadDate     int64 // d.load_date
+	CreationDate int64 // d.creation_date
+	StartedAt    int64 // d.timestamp.started
+	FinishedAt   int64 // d.timestamp.finished
+
+	PeersConnected int64 // d.peers_connected
+	PeersComplete  int64 // d.peers_complete
+	PeersAccounted int64 // d.peers_accounted
+
+	// Custom1 to Custom5 are d.custom1..5, Custom1 is ruTorrent's label.
+	Custom1, Custom2, Custom3, Custom4, Custom5 string
+	// Custom holds the keyed d.custom values.
+	Custom map[string]string
+
+	Files    []File
+	Trackers []Tracker
+	Peers    []Peer
+}
+
+// File is a file of a torrent, reported by f.multicall.
+type File struct {
+	Path            string
+	Size            int64
+	SizeChunks      int64
+	CompletedChunks int64
+	Priority        int64
+}
+
+// Tracker is a tracker of a torrent, reported by t.multicall and t.url.
+type Tracker struct {
+	URL      string
+	Enabled  bool
+	Seeders  int64 // t.scrape_complete
+	Leechers int64 // t.scrape_incomplete
+}
+
+// Peer is a peer of a torrent, reported by p.multicall.
+type Peer struct {
+	Address  string
+	Port     int64
+	Client   string
+	DownRate int64
+	UpRate   int64
+	Percent  int64
+}
+
+const defaultChunkSize = 256 << 10
+
+// clone returns a deep copy of t.
+func (t *Torrent) clone() *Torrent {
+	c := *t
+	if t.Custom != nil {
+		c.Custom = make(map[string]string, len(t.Custom))
+		for k, v := range t.Custom {
+			c.Custom[k] = v
+		}
+	}
+	c.Files = append([]File(nil), t.Files...)
+	c.Trackers = append([]Tracker(nil), t.Trackers...)
+	c.Peers = append([]Peer(nil), t.Peers...)
+	return &c
+}
+
+func (t *Torrent) chunkSize() int64 {
+	if t.ChunkSize > 0 {
+		return t.ChunkSize
+	}
+	return defaultChunkSize
+}
+
+func (t *Torrent) complete() bool {
+	return t.Completed >= t.Size
+}
+
+func (t *Torrent) sizeChunks() int64 {
+	return (t.Size + t.chunkSize() - 1) / t.chunkSize()
+}
+
+func (t *Torrent) completedChunks() int64 {
+	if t.complete() {
+		return t.sizeChunks()
+	}
+	return t.Completed / t.chunkSize()
+}
+
+func (t *Torrent) basePath() string {
+	if t.Directory == "" {
+		return t.Name
+	}
+	return t.Directory + "/" + t.Name
+}
+
+// ratio is d.ratio, in thousandths.
+func (t *Torrent) ratio() int64 {
+	if t.Completed == 0 {
+		return 0
+	}
+	return t.UpTotal * 1000 / t.Completed
+}
+
+func (t *Torrent) connection() string {
+	if !t.Open {
+		return ""
+	}
+	if t.complete() {
+		return "seed"
+	}
+	return "leech"
+}
+
+func (t *Torrent) custom(key string) string {
+	return t.Custom[key]
+}
+
+func (t *Torrent) setCustom(key, value string) {
+	if t.Custom == nil {
+		t.Custom = make(map[string]string)
+	}
+	t.Custom[key] = value
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// getters are the d.* commands answered for a torrent.
+var getters = map[string]func(t *Torrent) interface{}{
+	"d.hash":               func(t *Torrent) interface{} { return t.Hash },
+	"d.name":               func(t *Torrent) interface{} { return t.Name },
+	"d.directory":          func(t *Torrent) interface{} { return t.Directory },
+	"d.directory_base":     func(t *Torrent) interface{} { return t.Directory },
+	"d.base_path":          func(t *Torrent) interface{} { return t.basePath() },
+	"d.size_bytes":         func(t *Torrent) interface{} { return t.Size },
+	"d.completed_bytes":    func(t *Torrent) interface{} { return t.Completed },
+	"d.bytes_done":         func(t *Torrent) interface{} { return t.Completed },
+	"d.left_bytes":         func(t *Torrent) interface{} { return t.Size - t.Completed },
+	"d.chunk_size":         func(t *Torrent) interface{} { return t.chunkSize() },
+	"d.size_chunks":        func(t *Torrent) interface{} { return t.sizeChunks() },
+	"d.completed_chunks":   func(t *Torrent) interface{} { return t.completedChunks() },
+	"d.down.rate":          func(t *Torrent) interface{} { return t.DownRate },
+	"d.up.rate":            func(t *Torrent) interface{} { return t.UpRate },
+	"d.down.total":         func(t *Torrent) interface{} { return t.DownTotal },
+	"d.skip.total":         func(t *Torrent) interface{} { return t.Skipped },
+	"d.up.total":           func(t *Torrent) interface{} { return t.UpTotal },
+	"d.ratio":              func(t *Torrent) interface{} { return t.ratio() },
+	"d.is_open":            func(t *Torrent) interface{} { return boolInt(t.Open) },
+	"d.is_active":          func(t *Torrent) interface{} { return boolInt(t.Active) },
+	"d.state":              func(t *Torrent) interface{} { return boolInt(t.Started) },
+	"d.complete":           func(t *Torrent) interface{} { return boolInt(t.complete()) },
+	"d.incomplete":         func(t *Torrent) interface{} { return boolInt(!t.complete()) },
+	"d.hashing":            func(t *Torrent) interface{} { return t.Hashing },
+	"d.is_hash_checking":   func(t *Torrent) interface{} { return boolInt(t.Hashing != 0) },
+	"d.message":            func(t *Torrent) interface{} { return t.Message },
+	"d.connection_current": func(t *Torrent) interface{} { return t.connection() },
+	"d.priority":           func(t *Torrent) interface{} { return t.Priority },
+	"d.is_private":         func(t *Torrent) interface{} { return boolInt(t.Private) },
+	"d.is_multi_file":      func(t *Torrent) interface{} { return boolInt(t.MultiFile) },
+	"d.throttle_name":      func(t *Torrent) interface{} { return t.Throttle },
+	"d.load_date":          func(t *Torrent) interface{} { return t.LoadDate },
+	"d.creation_date":      func(t *Torrent) interface{} { return t.CreationDate },
+	"d.timestamp.started":  func(t *Torrent) interface{} { return t.StartedAt },
+	"d.timestamp.finished": func(t *Torrent) interface{} { return t.FinishedAt },
+	"d.peers_connected":    func(t *Torrent) interface{} { return t.PeersConnected },
+	"d.peers_complete":     func(t *Torrent) interface{} { return t.PeersComplete },
+	"d.peers_accounted":    func(t *Torrent) interface{} { return t.PeersAccounted },
+	"d.custom1":            func(t *Torrent) interface{} { return t.Custom1 },
+	"d.custom2":            func(t *Torrent) interface{} { return t.Custom2 },
+	"d.custom3":            func(t *Torrent) interface{} { return t.Custom3 },
+	"d.custom4":            func(t *Torrent) interface{} { return t.Custom4 },
+	"d.custom5":            func(t *Torrent) interface{} { return t.Custom5 },
+	"d.tracker_size":       func(t *Torrent) interface{} { return int64(len(t.Trackers)) },
+	"d.size_files":         func(t *Torrent) interface{} { return int64(len(t.Files)) },
+}
+
+// setters are the d.*.set commands taking a single value.
+var setters = map[string]func(t *Torrent, value string){
+	"d.directory.set":      func(t *Torrent, v string) { t.Directory = v },
+	"d.directory_base.set": func(t *Torrent, v string) { t.Directory = v },
+	"d.message.set":        func(t *Torrent, v string) { t.Message = v },
+	"d.throttle_name.set":  func(t *Torrent, v string) { t.Throttle = v },
+	"d.custom1.set":        func(t *Torrent, v string) { t.Custom1 = v },
+	"d.custom2.set":        func(t *Torrent, v string) { t.Custom2 = v },
+	"d.custom3.set":        func(t *Torrent, v string) { t.Custom3 = v },
+	"d.custom4.set":        func(t *Torrent, v string) { t.Custom4 = v },
+	"d.custom5.set":        func(t *Torrent, v string) { t.Custom5 = v },
+}
+
+// actions are the d.* commands changing the state of a torrent.
+var actions = map[string]func(t *Torrent){
+	"d.start": func(t *Torrent) {
+		t.Open, t.Active, t.Started = true, true, true
+	},
+	"d.stop": func(t *Torrent) {
+		t.Active, t.Started = false, false
+	},
+	"d.open": func(t *Torrent) {
+		t.Open = true
+	},
+	"d.close": func(t *Torrent) {
+		t.Open, t.Active = false, false
+	},
+	"d.pause": func(t *Torrent) {
+		t.Active = false
+	},
+	"d.resume": func(t *Torrent) {
+		if t.Open && t.Started {
+			t.Active = true
+		}
+	},
+	// checks are instant, d.hashing stays as the test set it.
+	"d.check_hash": func(t *Torrent) {},
+}
+
+// views are the d.multicall2 views.
+var views = map[string]func(t *Torrent) bool{
+	"":           func(t *Torrent) bool { return true },
+	"main":       func(t *Torrent) bool { return true },
+	"default":    func(t *Torrent) bool { return true },
+	"name":       func(t *Torrent) bool { return true },
+	"started":    func(t *Torrent) bool { return t.Started },
+	"stopped":    func(t *Torrent) bool { return !t.Started },
+	"complete":   func(t *Torrent) bool { return t.complete() },
+	"incomplete": func(t *Torrent) bool { return !t.complete() },
+	"hashing":    func(t *Torrent) bool { return t.Hashing != 0 },
+	"seeding":    func(t *Torrent) bool { return t.Started && t.complete() },
+	"leeching":   func(t *Torrent) bool { return t.Started && !t.complete() },
+	"active":     func(t *Torrent) bool { return t.Active && (t.DownRate > 0 || t.UpRate > 0) },
+}
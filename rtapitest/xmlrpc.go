@@ -0,0 +1,295 @@
+package rtapitest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values are decoded to and encoded from plain Go types: string, int64,
+// float64, bool, []byte (base64), time.Time (dateTime.iso8601), nil,
+// []interface{} (array) and map[string]interface{} (struct).
+
+const iso8601 = "20060102T15:04:05"
+
+// decodeMethodCall parses an XML-RPC methodCall.
+func decodeMethodCall(r io.Reader) (method string, params []interface{}, err error) {
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "methodCall", "params", "param":
+			case "methodName":
+				var name string
+				if err := d.DecodeElement(&name, &tok); err != nil {
+					return "", nil, err
+				}
+				method = strings.TrimSpace(name)
+			case "value":
+				v, err := decodeValue(d)
+				if err != nil {
+					return "", nil, err
+				}
+				params = append(params, v)
+			default:
+				return "", nil, fmt.Errorf("unexpected element <%s>", tok.Name.Local)
+			}
+		case xml.EndElement:
+			if tok.Name.Local == "methodCall" {
+				if method == "" {
+					return "", nil, fmt.Errorf("missing methodName")
+				}
+				return method, params, nil
+			}
+		}
+	}
+}
+
+// decodeMethodResponse parses an XML-RPC methodResponse, the value of a
+// fault is returned like any other.
+func decodeMethodResponse(r io.Reader) (interface{}, error) {
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "value" {
+			return decodeValue(d)
+		}
+	}
+}
+
+// decodeValue decodes the content of a <value> element whose start has
+// already been read, including its end.
+func decodeValue(d *xml.Decoder) (interface{}, error) {
+	var (
+		text  strings.Builder
+		value interface{}
+		typed bool
+	)
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.CharData:
+			text.Write(tok)
+		case xml.StartElement:
+			if typed {
+				return nil, fmt.Errorf("multiple types in <value>")
+			}
+			typed = true
+			if value, err = decodeTyped(d, tok); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			if !typed {
+				// untyped values are strings.
+				return text.String(), nil
+			}
+			return value, nil
+		}
+	}
+}
+
+func decodeTyped(d *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "array":
+		return decodeArray(d)
+	case "struct":
+		return decodeStruct(d)
+	case "nil":
+		return nil, d.Skip()
+	}
+
+	var s string
+	if err := d.DecodeElement(&s, &start); err != nil {
+		return nil, err
+	}
+
+	switch start.Name.Local {
+	case "string":
+		return s, nil
+	case "int", "i4", "i8":
+		return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	case "double":
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	case "boolean":
+		switch strings.TrimSpace(s) {
+		case "1":
+			return true, nil
+		case "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid boolean %q", s)
+	case "base64":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	case "dateTime.iso8601":
+		return time.Parse(iso8601, strings.TrimSpace(s))
+	}
+	return nil, fmt.Errorf("unknown type <%s>", start.Name.Local)
+}
+
+func decodeArray(d *xml.Decoder) ([]interface{}, error) {
+	values := []interface{}{}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "data":
+			case "value":
+				v, err := decodeValue(d)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, v)
+			default:
+				return nil, fmt.Errorf("unexpected element <%s> in array", tok.Name.Local)
+			}
+		case xml.EndElement:
+			if tok.Name.Local == "array" {
+				return values, nil
+			}
+		}
+	}
+}
+
+func decodeStruct(d *xml.Decoder) (map[string]interface{}, error) {
+	members := make(map[string]interface{})
+	var name string
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			switch tok.Name.Local {
+			case "member":
+			case "name":
+				if err := d.DecodeElement(&name, &tok); err != nil {
+					return nil, err
+				}
+			case "value":
+				v, err := decodeValue(d)
+				if err != nil {
+					return nil, err
+				}
+				members[name] = v
+			default:
+				return nil, fmt.Errorf("unexpected element <%s> in struct", tok.Name.Local)
+			}
+		case xml.EndElement:
+			if tok.Name.Local == "struct" {
+				return members, nil
+			}
+		}
+	}
+}
+
+// encodeResponse returns a methodResponse holding v.
+func encodeResponse(v interface{}) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+	buf.WriteString("<methodResponse><params><param>")
+	encodeValue(buf, v)
+	buf.WriteString("</param></params></methodResponse>")
+	return buf.Bytes()
+}
+
+// encodeFault returns a methodResponse holding the fault.
+func encodeFault(f *Fault) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+	buf.WriteString("<methodResponse><fault>")
+	encodeValue(buf, f.value())
+	buf.WriteString("</fault></methodResponse>")
+	return buf.Bytes()
+}
+
+func encodeValue(buf *bytes.Buffer, v interface{}) {
+	buf.WriteString("<value>")
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("<nil/>")
+	case string:
+		buf.WriteString("<string>")
+		xml.EscapeText(buf, []byte(v))
+		buf.WriteString("</string>")
+	case int:
+		fmt.Fprintf(buf, "<i8>%d</i8>", v)
+	case int64:
+		fmt.Fprintf(buf, "<i8>%d</i8>", v)
+	case float64:
+		buf.WriteString("<double>" + strconv.FormatFloat(v, 'f', -1, 64) + "</double>")
+	case bool:
+		if v {
+			buf.WriteString("<boolean>1</boolean>")
+		} else {
+			buf.WriteString("<boolean>0</boolean>")
+		}
+	case []byte:
+		buf.WriteString("<base64>" + base64.StdEncoding.EncodeToString(v) + "</base64>")
+	case time.Time:
+		buf.WriteString("<dateTime.iso8601>" + v.Format(iso8601) + "</dateTime.iso8601>")
+	case []interface{}:
+		buf.WriteString("<array><data>")
+		for _, item := range v {
+			encodeValue(buf, item)
+		}
+		buf.WriteString("</data></array>")
+	case []string:
+		buf.WriteString("<array><data>")
+		for _, item := range v {
+			encodeValue(buf, item)
+		}
+		buf.WriteString("</data></array>")
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		buf.WriteString("<struct>")
+		for _, name := range names {
+			buf.WriteString("<member><name>")
+			xml.EscapeText(buf, []byte(name))
+			buf.WriteString("</name>")
+			encodeValue(buf, v[name])
+			buf.WriteString("</member>")
+		}
+		buf.WriteString("</struct>")
+	default:
+		panic(fmt.Sprintf("rtapitest: can't encode %T", v))
+	}
+	buf.WriteString("</value>")
+}
@@ -0,0 +1,384 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+// maxUploadSize limits the size of uploaded .torrent files.
+const maxUploadSize = 10 << 20
+
+// Torrent is the JSON representation of *rtapi.Torrent.
+type Torrent struct {
+	Name       string      `json:"name"`
+	Hash       string      `json:"hash"`
+	DownRate   uint64      `json:"down_rate"`
+	UpRate     uint64      `json:"up_rate"`
+	Size       uint64      `json:"size"`
+	Completed  uint64      `json:"completed"`
+	Percent    string      `json:"percent"`
+	Progress   float64     `json:"progress"`
+	ETA        uint64      `json:"eta"`
+	Ratio      float64     `json:"ratio"`
+	Age        uint64      `json:"age"`
+	FinishedAt int64       `json:"finished_at"`
+	CreatedAt  int64       `json:"created_at"`
+	UpTotal    uint64      `json:"up_total"`
+	DownTotal  uint64      `json:"down_total"`
+	State      rtapi.State `json:"state"`
+	Message    string      `json:"message"`
+	Tracker    string      `json:"tracker"`
+	Path       string      `json:"path"`
+	Label      string      `json:"label"`
+
+	Extended *Extended `json:"extended,omitempty"` // only for a single torrent
+}
+
+// Extended is the JSON representation of rtapi.Extended.
+type Extended struct {
+	Seeders       uint64    `json:"seeders"`
+	Leechers      uint64    `json:"leechers"`
+	SeedersTotal  uint64    `json:"seeders_total"`
+	LeechersTotal uint64    `json:"leechers_total"`
+	Priority      int64     `json:"priority"`
+	Private       bool      `json:"private"`
+	MultiFile     bool      `json:"multi_file"`
+	Directory     string    `json:"directory"`
+	Left          uint64    `json:"left"`
+	Done          uint64    `json:"done"`
+	Skipped       uint64    `json:"skipped"`
+	Throttle      string    `json:"throttle"`
+	Custom        [5]string `json:"custom"`
+}
+
+func newTorrent(t *rtapi.Torrent) *Torrent {
+	v := &Torrent{
+		Name:      t.Name,
+		Hash:      t.Hash,
+		DownRate:  t.DownRate,
+		UpRate:    t.UpRate,
+		Size:      t.Size,
+		Completed: t.Completed,
+		Percent:   t.Percent,
+		Progress:  t.Progress,
+		ETA:       t.ETA,
+		Ratio:     t.Ratio,
+		Age:       t.Age,
+		UpTotal:   t.UpTotal,
+		DownTotal: t.DownTotal,
+		State:     t.State,
+		Message:   t.Message,
+		Path:      t.Path,
+		Label:     t.Label,
+	}
+	if !t.FinishedAt.IsZero() {
+		v.FinishedAt = t.FinishedAt.Unix()
+	}
+	if !t.CreatedAt.IsZero() {
+		v.CreatedAt = t.CreatedAt.Unix()
+	}
+	if t.Tracker != nil {
+		v.Tracker = t.Tracker.String()
+	}
+	if ext := t.Extended; ext != nil {
+		v.Extended = &Extended{
+			Seeders:       ext.Seeders,
+			Leechers:      ext.Leechers,
+			SeedersTotal:  ext.SeedersTotal,
+			LeechersTotal: ext.LeechersTotal,
+			Priority:      ext.Priority,
+			Private:       ext.Private,
+			MultiFile:     ext.MultiFile,
+			Directory:     ext.Directory,
+			Left:          ext.Left,
+			Done:          ext.Done,
+			Skipped:       ext.Skipped,
+			Throttle:      ext.Throttle,
+			Custom:        ext.Custom,
+		}
+	}
+	return v
+}
+
+// Stats is the JSON representation of the session statistics and speeds.
+type Stats struct {
+	DownRate     uint64 `json:"down_rate"`
+	UpRate       uint64 `json:"up_rate"`
+	ThrottleDown uint64 `json:"throttle_down"`
+	ThrottleUp   uint64 `json:"throttle_up"`
+	TotalDown    uint64 `json:"total_down"`
+	TotalUp      uint64 `json:"total_up"`
+	Port         int    `json:"port"`
+	Directory    string `json:"directory"`
+
+	// zero when rTorrent doesn't report them.
+	OpenSockets    int           `json:"open_sockets"`
+	MaxOpenSockets int           `json:"max_open_sockets"`
+	MaxPeers       int           `json:"max_peers"`
+	MaxPeersSeed   int           `json:"max_peers_seed"`
+	DHT            DHTStats      `json:"dht"`
+	MemoryUsage    uint64        `json:"memory_usage"`
+	MaxMemory      uint64        `json:"max_memory"`
+	FreeDiskSpace  uint64        `json:"free_disk_space"`
+	Uptime         int64         `json:"uptime"` // seconds
+	Torrents       TorrentCounts `json:"torrents"`
+}
+
+// DHTStats is the JSON representation of the DHT node.
+type DHTStats struct {
+	Mode   string `json:"mode"`
+	Active bool   `json:"active"`
+	Nodes  int    `json:"nodes"`
+}
+
+// TorrentCounts is the JSON representation of the torrents in each view.
+type TorrentCounts struct {
+	Total      int `json:"total"`
+	Started    int `json:"started"`
+	Stopped    int `json:"stopped"`
+	Complete   int `json:"complete"`
+	Incomplete int `json:"incomplete"`
+	Seeding    int `json:"seeding"`
+	Leeching   int `json:"leeching"`
+	Hashing    int `json:"hashing"`
+	Active     int `json:"active"`
+}
+
+// Health is the JSON body of GET /health.
+type Health struct {
+	Status  string `json:"status"`  // "ok" or "unavailable"
+	Breaker string `json:"breaker"` // state of the client's circuit breaker
+	Error   string `json:"error,omitempty"`
+}
+
+// AddRequest is the JSON body of POST /torrents.
+type AddRequest struct {
+	URL   string `json:"url"` // http(s) URL to a .torrent file, or a magnet link
+	Dir   string `json:"dir"`
+	Label string `json:"label"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) handleTorrents(w http.ResponseWriter, r *http.Request) {
+	torrents, err := s.rt.Torrents()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	state, label := r.URL.Query().Get("state"), r.URL.Query().Get("label")
+
+	resp := make([]*Torrent, 0, len(torrents))
+	for _, t := range torrents {
+		if state != "" && !strings.EqualFold(t.State.String(), state) {
+			continue
+		}
+		if label != "" && t.Label != label {
+			continue
+		}
+		resp = append(resp, newTorrent(t))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// lookup returns the torrent named by the {hash} path value, it writes an
+// error response and returns nil if there's none.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) *rtapi.Torrent {
+	hash := strings.ToUpper(r.PathValue("hash"))
+
+	t, err := s.rt.GetTorrent(hash)
+	switch {
+	case errors.Is(err, rtapi.ErrNotFound):
+		writeError(w, http.StatusNotFound, "no torrent with hash: "+hash)
+		return nil
+	case err != nil:
+		writeError(w, http.StatusBadGateway, err.Error())
+		return nil
+	}
+
+	return t
+}
+
+func (s *Server) handleTorrent(w http.ResponseWriter, r *http.Request) {
+	t := s.lookup(w, r)
+	if t == nil {
+		return
+	}
+
+	if err := s.rt.Extend(t); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, newTorrent(t))
+}
+
+func (s *Server) handleAction(action func(...*rtapi.Torrent) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := s.lookup(w, r)
+		if t == nil {
+			return
+		}
+
+		if err := action(t); err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	t := s.lookup(w, r)
+	if t == nil {
+		return
+	}
+
+	withData := r.URL.Query().Get("data") == "true"
+	if err := s.rt.Delete(withData, t); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAdd(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var (
+		req  AddRequest
+		data []byte
+		err  error
+	)
+	switch mediaType {
+	case "application/json":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+	case "multipart/form-data":
+		req, data, err = s.readUpload(w, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, "expected application/json or multipart/form-data")
+		return
+	}
+
+	if req.URL == "" && data == nil {
+		writeError(w, http.StatusBadRequest, "url or file is required")
+		return
+	}
+
+	switch {
+	case req.Dir != "" || req.Label != "":
+		err = s.rt.DownloadWithOptions(&rtapi.DotTorrentWithOptions{
+			Link:  req.URL,
+			Data:  data,
+			Dir:   req.Dir,
+			Label: req.Label,
+		})
+	case data != nil:
+		err = s.rt.DownloadRaw(data)
+	default:
+		err = s.rt.Download(req.URL)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// readUpload reads a multipart form with either a "url" field or a "file"
+// upload, whose content is returned as data.
+func (s *Server) readUpload(w http.ResponseWriter, r *http.Request) (req AddRequest, data []byte, err error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		return req, nil, err
+	}
+
+	req = AddRequest{
+		URL:   r.FormValue("url"),
+		Dir:   r.FormValue("dir"),
+		Label: r.FormValue("label"),
+	}
+
+	file, _, err := r.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) {
+		return req, nil, nil
+	}
+	if err != nil {
+		return req, nil, err
+	}
+	defer file.Close()
+
+	data, err = io.ReadAll(file)
+	return req, data, err
+}
+
+// handleHealth reports whether rTorrent answers, without calling it while
+// the circuit breaker is open.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	state := s.rt.BreakerState()
+	h := &Health{Status: "ok", Breaker: state.String()}
+
+	err := rtapi.ErrCircuitOpen
+	if state != rtapi.BreakerOpen {
+		_, err = s.rt.Call("system.client_version")
+	}
+	if err != nil {
+		h.Status, h.Error = "unavailable", err.Error()
+		h.Breaker = s.rt.BreakerState().String()
+		writeJSON(w, http.StatusServiceUnavailable, h)
+		return
+	}
+	writeJSON(w, http.StatusOK, h)
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	st, err := s.rt.Stats()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	tr, err := s.rt.Transfer(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, &Stats{
+		DownRate:     tr.DownRate,
+		UpRate:       tr.UpRate,
+		ThrottleDown: st.ThrottleDown,
+		ThrottleUp:   st.ThrottleUp,
+		TotalDown:    st.TotalDown,
+		TotalUp:      st.TotalUp,
+		Port:         st.Port,
+		Directory:    st.Directory,
+
+		OpenSockets:    st.OpenSockets,
+		MaxOpenSockets: st.MaxOpenSockets,
+		MaxPeers:       st.MaxPeers,
+		MaxPeersSeed:   st.MaxPeersSeed,
+		DHT:            DHTStats(st.DHT),
+		MemoryUsage:    st.MemoryUsage,
+		MaxMemory:      st.MaxMemory,
+		FreeDiskSpace:  st.FreeDiskSpace,
+		Uptime:         int64(st.Uptime / time.Second),
+		Torrents:       TorrentCounts(st.Torrents),
+	})
+}
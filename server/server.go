@@ -0,0 +1,178 @@
+// Package server exposes an rTorrent instance as a JSON REST API, for
+// clients which can't speak SCGI or XML-RPC, e.g. web frontends.
+//
+//	rt, err := rtapi.NewRtorrent("localhost:5000")
+//	if err != nil {
+//		// ...
+//	}
+//
+//	srv := server.New(rt, server.WithToken("secret"), server.WithCORS("https://example.com"))
+//	log.Fatal(http.ListenAndServe(":8080", srv))
+//
+// The API is described by the OpenAPI document served at /openapi.json.
+// Changes to the torrents are streamed from /stream, see Stream. /health
+// answers 503 while rTorrent is unreachable, it needs no token.
+package server
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Server is an http.Handler serving the REST API.
+type Server struct {
+	rt       *rtapi.Rtorrent
+	token    string
+	origins  []string
+	interval time.Duration
+	mux      *http.ServeMux
+}
+
+// Option configures a *Server created by New.
+type Option func(*Server)
+
+// WithToken requires every request to carry the token, either as
+// "Authorization: Bearer <token>" or as the "token" query parameter.
+func WithToken(token string) Option {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+// WithCORS allows browsers on the given origins to call the API, "*" allows
+// any origin.
+func WithCORS(origins ...string) Option {
+	return func(s *Server) {
+		s.origins = append(s.origins, origins...)
+	}
+}
+
+// WithStreamInterval sets how often /stream polls rTorrent, 2 seconds by default.
+func WithStreamInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.interval = interval
+	}
+}
+
+// New returns a *Server serving rt.
+func New(rt *rtapi.Rtorrent, opts ...Option) *Server {
+	s := &Server{rt: rt, interval: 2 * time.Second, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.mux.HandleFunc("GET /openapi.json", s.handleOpenAPI)
+	s.mux.HandleFunc("GET /health", s.handleHealth)
+	s.handle("GET /torrents", s.handleTorrents)
+	s.handle("POST /torrents", s.handleAdd)
+	s.handle("GET /torrents/{hash}", s.handleTorrent)
+	s.handle("DELETE /torrents/{hash}", s.handleDelete)
+	s.handle("POST /torrents/{hash}/start", s.handleAction(s.rt.Start))
+	s.handle("POST /torrents/{hash}/stop", s.handleAction(s.rt.Stop))
+	s.handle("POST /torrents/{hash}/pause", s.handleAction(s.rt.Pause))
+	s.handle("POST /torrents/{hash}/resume", s.handleAction(s.rt.Resume))
+	s.handle("POST /torrents/{hash}/force-start", s.handleAction(s.rt.ForceStart))
+	s.handle("POST /torrents/{hash}/check", s.handleAction(s.rt.Check))
+	s.handle("GET /stats", s.handleStats)
+	stream := NewStream(rt, s.interval)
+	stream.CheckOrigin = s.checkOrigin
+	s.handle("GET /stream", stream.ServeHTTP)
+
+	return s
+}
+
+// handle registers an authenticated handler.
+func (s *Server) handle(pattern string, h http.HandlerFunc) {
+	s.mux.Handle(pattern, s.authenticate(h))
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.cors(w, r) {
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// cors sets the CORS headers for allowed origins, and reports whether the
+// request was a preflight request which has been answered.
+func (s *Server) cors(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || !s.allowedOrigin(origin) {
+		return false
+	}
+
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Add("Vary", "Origin")
+
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+
+	h.Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+	h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	h.Set("Access-Control-Max-Age", "86400")
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// checkOrigin allows WebSocket upgrades from the same host and from the
+// origins allowed by WithCORS.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	return sameOrigin(r) || s.allowedOrigin(r.Header.Get("Origin"))
+}
+
+func (s *Server) allowedOrigin(origin string) bool {
+	for _, o := range s.origins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) authenticate(h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token == "" {
+			h(w, r)
+			return
+		}
+
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="rtapi"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		h(w, r)
+	})
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPI)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
@@ -0,0 +1,308 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyed/rtapi"
+	"github.com/pyed/rtapi/rtapitest"
+)
+
+func newTestServer(t *testing.T, opts ...Option) (*Server, *rtapitest.Server) {
+	t.Helper()
+
+	fake := rtapitest.NewServer()
+	t.Cleanup(fake.Close)
+	fake.SetSession(rtapitest.Session{
+		ClientVersion:  "0.9.6",
+		LibraryVersion: "0.13.6",
+		Port:           6980,
+		Directory:      "/home/Downloads",
+		UpTotal:        6841,
+		DownTotal:      7476,
+		OpenSockets:    12,
+		MaxPeers:       50,
+		DHTMode:        "on",
+		DHTNodes:       143,
+		FreeDiskSpace:  100 << 30,
+	})
+	fake.AddTorrent(
+		&rtapitest.Torrent{
+			Hash:      "8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648",
+			Name:      "ubuntu-17.04-server-amd64.iso",
+			Directory: "/home/Downloads",
+			Size:      1370 * 524288,
+			Completed: 1370 * 524288,
+			ChunkSize: 524288,
+			UpRate:    593,
+			LoadDate:  1492032019,
+			Open:      true,
+			Active:    true,
+			Started:   true,
+			Trackers:  []rtapitest.Tracker{{URL: "http://torrent.ubuntu.com:6969/announce"}},
+		},
+		&rtapitest.Torrent{
+			Hash:      "02CA77A6A047FD37F04337437D18F82E61861084",
+			Name:      "archlinux-2017.04.01-x86_64.iso",
+			Directory: "/home/Downloads",
+			Size:      956 * 524288,
+			Completed: 115 * 524288,
+			ChunkSize: 524288,
+			DownRate:  997035,
+			LoadDate:  1492031149,
+			Open:      true,
+			Active:    true,
+			Started:   true,
+			Custom1:   "Linux",
+			Trackers:  []rtapitest.Tracker{{URL: "udp://tracker.archlinux.org:6969"}},
+		},
+	)
+
+	rt, err := rtapi.NewRtorrent(fake.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(rt, opts...), fake
+}
+
+func do(srv http.Handler, method, target string, body io.Reader, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTorrents(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec := do(srv, "GET", "/torrents?state=seeding", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got: %d %s", rec.Code, rec.Body)
+	}
+
+	var torrents []Torrent
+	if err := json.NewDecoder(rec.Body).Decode(&torrents); err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 1 {
+		t.Fatalf("Expected 1 seeding torrent, got: %d", len(torrents))
+	}
+	if torrents[0].Name != "ubuntu-17.04-server-amd64.iso" || torrents[0].Tracker != "http://torrent.ubuntu.com:6969/announce" {
+		t.Errorf("Unexpected torrent: %+v", torrents[0])
+	}
+}
+
+func TestTorrent(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec := do(srv, "GET", "/torrents/02ca77a6a047fd37f04337437d18f82e61861084", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got: %d %s", rec.Code, rec.Body)
+	}
+
+	var torrent Torrent
+	json.NewDecoder(rec.Body).Decode(&torrent)
+	if torrent.State != rtapi.Leeching || torrent.Percent != "12.0%" {
+		t.Errorf("Unexpected torrent: %+v", torrent)
+	}
+	if torrent.Extended == nil || torrent.Extended.Directory != "/home/Downloads" || torrent.Extended.Custom[0] != "Linux" {
+		t.Errorf("Expected the extended fields, got: %+v", torrent.Extended)
+	}
+
+	if rec := do(srv, "GET", "/torrents/DEADBEEF", nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got: %d", rec.Code)
+	}
+}
+
+func TestActions(t *testing.T) {
+	srv, fake := newTestServer(t)
+
+	for _, action := range []string{"start", "stop", "pause", "resume", "force-start", "check"} {
+		rec := do(srv, "POST", "/torrents/02CA77A6A047FD37F04337437D18F82E61861084/"+action, nil, nil)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s: Expected status 204, got: %d %s", action, rec.Code, rec.Body)
+		}
+	}
+
+	rec := do(srv, "DELETE", "/torrents/02CA77A6A047FD37F04337437D18F82E61861084", nil, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got: %d %s", rec.Code, rec.Body)
+	}
+
+	calls := map[string]int{"d.start": 2, "d.stop": 1, "d.pause": 1, "d.resume": 2, "d.open": 1, "d.check_hash": 1, "d.erase": 1}
+	for method, expected := range calls {
+		if n := fake.CallCount(method); n != expected {
+			t.Errorf("Expected %s to be called %d times, got: %d", method, expected, n)
+		}
+	}
+	if fake.Torrent("02CA77A6A047FD37F04337437D18F82E61861084") != nil {
+		t.Error("Expected the torrent to be erased")
+	}
+
+	if rec := do(srv, "POST", "/torrents/DEADBEEF/start", nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got: %d", rec.Code)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	srv, fake := newTestServer(t)
+
+	rec := do(srv, "POST", "/torrents", strings.NewReader(`{"url": "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567", "label": "Software"}`),
+		map[string]string{"Content-Type": "application/json"})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got: %d %s", rec.Code, rec.Body)
+	}
+	if got := fake.Torrent("0123456789ABCDEF0123456789ABCDEF01234567"); got == nil || got.Custom1 != "Software" {
+		t.Errorf("Expected the magnet link to be loaded with its label, got: %+v", got)
+	}
+
+	rec = do(srv, "POST", "/torrents", strings.NewReader(`{}`), map[string]string{"Content-Type": "application/json"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without url, got: %d", rec.Code)
+	}
+
+	rec = do(srv, "POST", "/torrents", strings.NewReader(`url=x`), map[string]string{"Content-Type": "text/plain"})
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415, got: %d", rec.Code)
+	}
+}
+
+func TestAddUpload(t *testing.T) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "debian.torrent")
+	fw.Write([]byte("d8:announce0:4:infod6:lengthi1e4:name10:debian.iso12:piece lengthi1e6:pieces0:ee"))
+	mw.WriteField("label", "Software")
+	mw.Close()
+	header := map[string]string{"Content-Type": mw.FormDataContentType()}
+
+	srv, fake := newTestServer(t)
+	rec := do(srv, "POST", "/torrents", bytes.NewReader(body.Bytes()), header)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got: %d %s", rec.Code, rec.Body)
+	}
+	ts := fake.Torrents()
+	if len(ts) != 3 || ts[2].Name != "debian.iso" || ts[2].Custom1 != "Software" {
+		t.Error("Expected the upload to be loaded with its label")
+	}
+}
+
+func TestStats(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	rec := do(srv, "GET", "/stats", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got: %d %s", rec.Code, rec.Body)
+	}
+
+	var st Stats
+	json.NewDecoder(rec.Body).Decode(&st)
+	expected := Stats{DownRate: 997035, UpRate: 593, TotalUp: 6841, TotalDown: 7476, Port: 6980, Directory: "/home/Downloads",
+		OpenSockets: 12, MaxPeers: 50, DHT: DHTStats{Mode: "on", Active: true, Nodes: 143}, FreeDiskSpace: 100 << 30,
+		Torrents: TorrentCounts{Total: 2, Started: 2, Complete: 1, Incomplete: 1, Seeding: 1, Leeching: 1, Active: 2}}
+	if st != expected {
+		t.Errorf("Expected %+v, got: %+v", expected, st)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	srv, fake := newTestServer(t)
+
+	rec := do(srv, "GET", "/health", nil, nil)
+	var h Health
+	json.NewDecoder(rec.Body).Decode(&h)
+	if rec.Code != http.StatusOK || h != (Health{Status: "ok", Breaker: "closed"}) {
+		t.Errorf("Expected a healthy status, got: %d %+v", rec.Code, h)
+	}
+
+	rt, err := rtapi.NewRtorrent(fake.Addr, rtapi.WithCircuitBreaker(1, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv = New(rt)
+	fake.Close()
+
+	// the first check opens the breaker, the second one fails fast.
+	for i := 0; i < 2; i++ {
+		rec := do(srv, "GET", "/health", nil, nil)
+		var h Health
+		json.NewDecoder(rec.Body).Decode(&h)
+		if rec.Code != http.StatusServiceUnavailable || h.Status != "unavailable" || h.Breaker != "open" || h.Error == "" {
+			t.Errorf("Check %d: Expected an unavailable status with the breaker open, got: %d %+v", i, rec.Code, h)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	srv, _ := newTestServer(t, WithToken("secret"))
+
+	testCases := []struct {
+		target string
+		header map[string]string
+		code   int
+	}{
+		{"/stats", nil, http.StatusUnauthorized},
+		{"/stats", map[string]string{"Authorization": "Bearer wrong"}, http.StatusUnauthorized},
+		{"/stats", map[string]string{"Authorization": "Bearer secret"}, http.StatusOK},
+		{"/stats?token=secret", nil, http.StatusOK},
+		{"/openapi.json", nil, http.StatusOK},
+		{"/health", nil, http.StatusOK},
+	}
+
+	for i, test := range testCases {
+		if rec := do(srv, "GET", test.target, nil, test.header); rec.Code != test.code {
+			t.Errorf("Case %d: Expected status %d, got: %d", i, test.code, rec.Code)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	srv := New(&rtapi.Rtorrent{}, WithToken("secret"), WithCORS("https://example.com"))
+
+	rec := do(srv, "OPTIONS", "/torrents", nil, map[string]string{
+		"Origin":                        "https://example.com",
+		"Access-Control-Request-Method": "DELETE",
+	})
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected preflight status 204, got: %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+		t.Errorf("Expected allowed origin, got: %q", got)
+	}
+
+	rec = do(srv, "GET", "/torrents", nil, map[string]string{"Origin": "https://evil.example"})
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no CORS headers for other origins, got: %q", got)
+	}
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got: %d", rec.Code)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	srv := New(&rtapi.Rtorrent{})
+
+	rec := do(srv, "GET", "/openapi.json", nil, nil)
+	var doc struct {
+		Paths map[string]interface{} `json:"paths"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/torrents", "/torrents/{hash}", "/torrents/{hash}/start", "/torrents/{hash}/pause", "/stats", "/health", "/stream"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("Expected %s to be documented", path)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+// subscriberBuffer is how many events may be queued for a subscriber, a
+// subscriber falling further behind is disconnected and has to reconnect to
+// get a fresh snapshot.
+const subscriberBuffer = 16
+
+// keepAlive is how often an idle SSE connection gets a comment, so proxies
+// don't time it out.
+const keepAlive = 30 * time.Second
+
+// Event is sent to stream subscribers as JSON. The first event of every
+// subscription is a "snapshot" with all the torrents, the following ones are
+// "patch" events holding only what changed since the previous poll: the
+// changed fields of existing torrents, whole added torrents and the hashes
+// of removed ones. Failed polls are reported by "error" events.
+type Event struct {
+	Type     string                                `json:"type"`
+	Torrents map[string]map[string]json.RawMessage `json:"torrents,omitempty"`
+	Changed  map[string]map[string]json.RawMessage `json:"changed,omitempty"`
+	Added    map[string]map[string]json.RawMessage `json:"added,omitempty"`
+	Removed  []string                              `json:"removed,omitempty"`
+	Error    string                                `json:"error,omitempty"`
+}
+
+// Stream is an http.Handler streaming torrent changes to browsers over
+// Server-Sent Events or WebSocket. A single poll of rTorrent is shared by all
+// the subscribers, and only runs while there is at least one.
+type Stream struct {
+	// CheckOrigin reports whether a WebSocket upgrade may be accepted, as
+	// browsers don't apply CORS to WebSockets. If nil, only requests without
+	// an Origin or from the same host are accepted.
+	CheckOrigin func(r *http.Request) bool
+
+	rt       *rtapi.Rtorrent
+	interval time.Duration
+
+	mu   sync.Mutex
+	subs map[chan []byte]struct{}
+	last map[string]map[string]json.RawMessage // fields by hash, as of the last poll
+	stop chan struct{}                         // closes the running poller, nil if none
+}
+
+// NewStream returns a *Stream polling rt every interval.
+func NewStream(rt *rtapi.Rtorrent, interval time.Duration) *Stream {
+	return &Stream{
+		rt:       rt,
+		interval: interval,
+		subs:     make(map[chan []byte]struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving encoded events, and a function to
+// unsubscribe. The channel is closed once unsubscribed, or if the
+// subscriber falls behind.
+func (s *Stream) Subscribe() (<-chan []byte, func()) {
+	ch := make(chan []byte, subscriberBuffer)
+
+	s.mu.Lock()
+	s.subs[ch] = struct{}{}
+	if s.last != nil {
+		ch <- encodeEvent(&Event{Type: "snapshot", Torrents: s.last})
+	}
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+		go s.run(s.stop)
+	}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.remove(ch)
+			s.mu.Unlock()
+		})
+	}
+}
+
+// remove drops the subscriber ch, and stops polling if it was the last one,
+// s.mu must be held.
+func (s *Stream) remove(ch chan []byte) {
+	if _, ok := s.subs[ch]; !ok {
+		return
+	}
+	delete(s.subs, ch)
+	close(ch)
+
+	if len(s.subs) == 0 && s.stop != nil {
+		close(s.stop)
+		s.stop, s.last = nil, nil
+	}
+}
+
+func (s *Stream) run(stop chan struct{}) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.poll(stop)
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll fetches the torrents and broadcasts what changed, unless the poller
+// has been stopped meanwhile.
+func (s *Stream) poll(stop chan struct{}) {
+	torrents, err := s.rt.Torrents()
+
+	var current map[string]map[string]json.RawMessage
+	if err == nil {
+		current, err = torrentFields(torrents)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != stop {
+		return
+	}
+
+	if err != nil {
+		s.broadcast(&Event{Type: "error", Error: err.Error()})
+		return
+	}
+
+	if s.last == nil {
+		s.last = current
+		s.broadcast(&Event{Type: "snapshot", Torrents: current})
+		return
+	}
+
+	patch := diff(s.last, current)
+	s.last = current
+	if patch != nil {
+		s.broadcast(patch)
+	}
+}
+
+// broadcast sends ev to every subscriber, s.mu must be held.
+func (s *Stream) broadcast(ev *Event) {
+	data := encodeEvent(ev)
+	for ch := range s.subs {
+		select {
+		case ch <- data:
+		default:
+			s.remove(ch)
+		}
+	}
+}
+
+func encodeEvent(ev *Event) []byte {
+	data, _ := json.Marshal(ev)
+	return data
+}
+
+// torrentFields returns the JSON encoded fields of every torrent, by hash.
+func torrentFields(ts rtapi.Torrents) (map[string]map[string]json.RawMessage, error) {
+	fields := make(map[string]map[string]json.RawMessage, len(ts))
+	for _, t := range ts {
+		data, err := json.Marshal(newTorrent(t))
+		if err != nil {
+			return nil, err
+		}
+
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		fields[t.Hash] = m
+	}
+	return fields, nil
+}
+
+// diff returns a "patch" event turning prev into cur, or nil if they're equal.
+func diff(prev, cur map[string]map[string]json.RawMessage) *Event {
+	ev := &Event{Type: "patch"}
+
+	for hash, fields := range cur {
+		old, ok := prev[hash]
+		if !ok {
+			if ev.Added == nil {
+				ev.Added = make(map[string]map[string]json.RawMessage)
+			}
+			ev.Added[hash] = fields
+			continue
+		}
+
+		for name, value := range fields {
+			if bytes.Equal(old[name], value) {
+				continue
+			}
+			if ev.Changed == nil {
+				ev.Changed = make(map[string]map[string]json.RawMessage)
+			}
+			if ev.Changed[hash] == nil {
+				ev.Changed[hash] = make(map[string]json.RawMessage)
+			}
+			ev.Changed[hash][name] = value
+		}
+	}
+
+	for hash := range prev {
+		if _, ok := cur[hash]; !ok {
+			ev.Removed = append(ev.Removed, hash)
+		}
+	}
+
+	if ev.Added == nil && ev.Changed == nil && ev.Removed == nil {
+		return nil
+	}
+	return ev
+}
+
+// ServeHTTP implements http.Handler, WebSocket upgrade requests get a
+// WebSocket with a text message per event, others get Server-Sent Events.
+func (s *Stream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if isWebSocketUpgrade(r) {
+		s.serveWebSocket(w, r)
+		return
+	}
+	s.serveSSE(w, r)
+}
+
+func (s *Stream) serveSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	events, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ping := time.NewTicker(keepAlive)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case data, ok := <-events:
+			if !ok {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *Stream) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	checkOrigin := s.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		writeError(w, http.StatusForbidden, "origin not allowed")
+		return
+	}
+
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	events, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	closed := make(chan struct{})
+	go func() {
+		conn.readLoop()
+		close(closed)
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case data, ok := <-events:
+			if !ok {
+				conn.writeClose(wsCloseGoingAway)
+				return
+			}
+			if err := conn.writeText(data); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+func TestDiff(t *testing.T) {
+	prev, _ := torrentFields(rtapi.Torrents{
+		&rtapi.Torrent{Hash: "A", Name: "archlinux", DownRate: 10, Percent: "1.0%"},
+		&rtapi.Torrent{Hash: "D", Name: "debian"},
+	})
+	cur, _ := torrentFields(rtapi.Torrents{
+		&rtapi.Torrent{Hash: "A", Name: "archlinux", DownRate: 20, Percent: "2.0%"},
+		&rtapi.Torrent{Hash: "U", Name: "ubuntu"},
+	})
+
+	ev := diff(prev, cur)
+	if ev == nil || ev.Type != "patch" {
+		t.Fatalf("Expected a patch, got: %+v", ev)
+	}
+
+	changed := ev.Changed["A"]
+	if len(changed) != 2 || string(changed["down_rate"]) != "20" || string(changed["percent"]) != `"2.0%"` {
+		t.Errorf("Expected only down_rate and percent to change, got: %s", encodeEvent(ev))
+	}
+	if _, ok := ev.Added["U"]; !ok || len(ev.Added) != 1 {
+		t.Errorf("Expected U to be added, got: %v", ev.Added)
+	}
+	if len(ev.Removed) != 1 || ev.Removed[0] != "D" {
+		t.Errorf("Expected D to be removed, got: %v", ev.Removed)
+	}
+
+	if ev := diff(cur, cur); ev != nil {
+		t.Errorf("Expected no patch for equal snapshots, got: %s", encodeEvent(ev))
+	}
+}
+
+func TestStreamSharedPoll(t *testing.T) {
+	srv, fake := newTestServer(t)
+	stream := NewStream(srv.rt, time.Hour)
+
+	first, unsubscribeFirst := stream.Subscribe()
+	expectSnapshot(t, first)
+
+	second, unsubscribeSecond := stream.Subscribe()
+	expectSnapshot(t, second)
+
+	if n := fake.CallCount("d.multicall2"); n != 1 {
+		t.Errorf("Expected subscribers to share a single poll, got %d polls", n)
+	}
+
+	unsubscribeFirst()
+	unsubscribeSecond()
+	if _, ok := <-first; ok {
+		t.Error("Expected the channel to be closed once unsubscribed")
+	}
+
+	third, unsubscribe := stream.Subscribe()
+	defer unsubscribe()
+	expectSnapshot(t, third)
+	if n := fake.CallCount("d.multicall2"); n != 2 {
+		t.Errorf("Expected polling to restart after all subscribers left, got %d polls", n)
+	}
+}
+
+func expectSnapshot(t *testing.T, events <-chan []byte) {
+	t.Helper()
+
+	select {
+	case data := <-events:
+		var ev Event
+		if err := json.Unmarshal(data, &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Type != "snapshot" || len(ev.Torrents) != 2 {
+			t.Fatalf("Expected a snapshot of 2 torrents, got: %s", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a snapshot")
+	}
+}
+
+func TestStreamSSE(t *testing.T) {
+	srv, _ := newTestServer(t, WithToken("secret"))
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/stream?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got: %s", ct)
+	}
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan []byte, 1)
+	events <- []byte(strings.TrimPrefix(strings.TrimSpace(line), "data: "))
+	expectSnapshot(t, events)
+}
+
+// dialWebSocket sends a WebSocket handshake for /stream to addr, with the
+// Origin header if origin isn't empty.
+func dialWebSocket(t *testing.T, addr, origin string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+
+	header := ""
+	if origin != "" {
+		header = "Origin: " + origin + "\r\n"
+	}
+	// the example key and accept value of RFC 6455.
+	nc.Write([]byte("GET /stream HTTP/1.1\r\n" +
+		"Host: " + addr + "\r\n" +
+		header +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"))
+
+	br := bufio.NewReader(nc)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nc, br, resp
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	srv, _ := newTestServer(t)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	nc, br, resp := dialWebSocket(t, ts.Listener.Addr().String(), "")
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got: %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Unexpected Sec-WebSocket-Accept: %s", got)
+	}
+
+	conn := &wsConn{conn: nc, rw: bufio.NewReadWriter(br, bufio.NewWriter(nc))}
+	opcode, payload, err := conn.readFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode != wsOpText {
+		t.Fatalf("Expected a text frame, got opcode %d", opcode)
+	}
+	events := make(chan []byte, 1)
+	events <- payload
+	expectSnapshot(t, events)
+
+	// clients must mask their frames.
+	mask := []byte{1, 2, 3, 4}
+	closeFrame := []byte{0x80 | wsOpClose, 0x80 | 2}
+	closeFrame = append(closeFrame, mask...)
+	closeFrame = append(closeFrame, 0x03^mask[0], 0xE8^mask[1])
+	nc.Write(closeFrame)
+
+	if opcode, _, err := conn.readFrame(); err != nil || opcode != wsOpClose {
+		t.Errorf("Expected a close frame back, got opcode %d, %v", opcode, err)
+	}
+}
+
+func TestStreamWebSocketOrigin(t *testing.T) {
+	srv, _ := newTestServer(t, WithCORS("https://example.com"))
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	addr := ts.Listener.Addr().String()
+
+	testCases := []struct {
+		origin   string
+		expected int
+	}{
+		{"http://" + addr, http.StatusSwitchingProtocols},
+		{"https://example.com", http.StatusSwitchingProtocols},
+		{"https://evil.example", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+	for _, test := range testCases {
+		if _, _, resp := dialWebSocket(t, addr, test.origin); resp.StatusCode != test.expected {
+			t.Errorf("%s: Expected status %d, got: %d", test.origin, test.expected, resp.StatusCode)
+		}
+	}
+
+	// a bare Stream only accepts its own host.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://rtorrent.lan/stream", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Origin", "https://example.com")
+	NewStream(nil, time.Second).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got: %d", rec.Code)
+	}
+}
@@ -1,6 +1,13 @@
 package rtapi
 
-import "sort"
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
 
 // Sorting method on Torrents
 
@@ -22,82 +29,156 @@ const (
 	ByAgeRev
 	ByUpTotal
 	ByUpTotalRev
+	ByPercent
+	ByPercentRev
+	ByETA
+	ByETARev
+	ByState
+	ByStateRev
+	ByLabel
+	ByLabelRev
+	ByTracker
+	ByTrackerRev
+	ByCompleted
+	ByCompletedRev
+	ByPath
+	ByPathRev
 )
 
 // CurrentSorting holds the sorting in use.
 var CurrentSorting = DefaultSorting
 
-func (t Torrents) Sort(aSorting sorting) {
-	switch aSorting {
-	case ByName:
-		sort.Sort(byName(t))
-	case ByNameRev:
-		sort.Sort(sort.Reverse(byName(t)))
-	case ByDownRate:
-		sort.Sort(byDownRate(t))
-	case ByDownRateRev:
-		sort.Sort(sort.Reverse(byDownRate(t)))
-	case ByUpRate:
-		sort.Sort(byUpRate(t))
-	case ByUpRateRev:
-		sort.Sort(sort.Reverse(byUpRate(t)))
-	case BySize:
-		sort.Sort(bySize(t))
-	case BySizeRev:
-		sort.Sort(sort.Reverse(bySize(t)))
-	case ByRatio:
-		sort.Sort(byRatio(t))
-	case ByRatioRev:
-		sort.Sort(sort.Reverse(byRatio(t)))
-	case ByAge:
-		sort.Sort(byAge(t))
-	case ByAgeRev:
-		sort.Sort(sort.Reverse(byAge(t)))
-	case ByUpTotal:
-		sort.Sort(byUpTotal(t))
-	case ByUpTotalRev:
-		sort.Sort(sort.Reverse(byUpTotal(t)))
-	}
-}
-
-type byName Torrents
-
-func (s byName) Len() int           { return len(s) }
-func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s byName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+// Comparator compares two torrents like cmp.Compare, it returns a negative
+// number when a sorts before b, a positive one when after and 0 if equal.
+type Comparator func(a, b *Torrent) int
+
+// The comparators of the sort keys, all ascending.
+var (
+	CompareName      Comparator = func(a, b *Torrent) int { return cmp.Compare(a.Name, b.Name) }
+	CompareDownRate  Comparator = func(a, b *Torrent) int { return cmp.Compare(a.DownRate, b.DownRate) }
+	CompareUpRate    Comparator = func(a, b *Torrent) int { return cmp.Compare(a.UpRate, b.UpRate) }
+	CompareSize      Comparator = func(a, b *Torrent) int { return cmp.Compare(a.Size, b.Size) }
+	CompareRatio     Comparator = func(a, b *Torrent) int { return cmp.Compare(a.Ratio, b.Ratio) }
+	CompareAge       Comparator = func(a, b *Torrent) int { return cmp.Compare(a.Age, b.Age) }
+	CompareUpTotal   Comparator = func(a, b *Torrent) int { return cmp.Compare(a.UpTotal, b.UpTotal) }
+	ComparePercent   Comparator = func(a, b *Torrent) int { return cmp.Compare(a.Progress, b.Progress) }
+	CompareETA       Comparator = func(a, b *Torrent) int { return cmp.Compare(sortETA(a), sortETA(b)) }
+	CompareState     Comparator = func(a, b *Torrent) int { return cmp.Compare(a.State, b.State) }
+	CompareLabel     Comparator = func(a, b *Torrent) int { return cmp.Compare(a.Label, b.Label) }
+	CompareTracker   Comparator = func(a, b *Torrent) int { return cmp.Compare(trackerHost(a), trackerHost(b)) }
+	CompareCompleted Comparator = func(a, b *Torrent) int { return cmp.Compare(a.Completed, b.Completed) }
+	ComparePath      Comparator = func(a, b *Torrent) int { return cmp.Compare(a.Path, b.Path) }
+)
 
-type byDownRate Torrents
+type sortKey struct {
+	name string
+	cmp  Comparator
+}
 
-func (s byDownRate) Len() int           { return len(s) }
-func (s byDownRate) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s byDownRate) Less(i, j int) bool { return s[i].DownRate < s[j].DownRate }
+// sortKeys are the keys of ParseSort, in the order of the sorting constants.
+var sortKeys = []sortKey{
+	{"name", CompareName},
+	{"down", CompareDownRate},
+	{"up", CompareUpRate},
+	{"size", CompareSize},
+	{"ratio", CompareRatio},
+	{"age", CompareAge},
+	{"uptotal", CompareUpTotal},
+	{"percent", ComparePercent},
+	{"eta", CompareETA},
+	{"state", CompareState},
+	{"label", CompareLabel},
+	{"tracker", CompareTracker},
+	{"completed", CompareCompleted},
+	{"path", ComparePath},
+}
 
-type byUpRate Torrents
+// SortKeys returns the keys understood by ParseSort.
+func SortKeys() []string {
+	keys := make([]string, len(sortKeys))
+	for i := range sortKeys {
+		keys[i] = sortKeys[i].name
+	}
+	return keys
+}
 
-func (s byUpRate) Len() int           { return len(s) }
-func (s byUpRate) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s byUpRate) Less(i, j int) bool { return s[i].UpRate < s[j].UpRate }
+// Reverse returns a Comparator sorting in the opposite order of c.
+func (c Comparator) Reverse() Comparator {
+	return func(a, b *Torrent) int { return c(b, a) }
+}
 
-type bySize Torrents
+// Compare returns a Comparator comparing with each of cs in turn, the first
+// which doesn't find the torrents equal decides.
+func Compare(cs ...Comparator) Comparator {
+	return func(a, b *Torrent) int {
+		for _, c := range cs {
+			if n := c(a, b); n != 0 {
+				return n
+			}
+		}
+		return 0
+	}
+}
 
-func (s bySize) Len() int           { return len(s) }
-func (s bySize) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s bySize) Less(i, j int) bool { return s[i].Size < s[j].Size }
+// ParseSort parses a comma separated list of sort keys, e.g. "-ratio,name",
+// into a Comparator. A key prefixed with "-" sorts in descending order, keys
+// are compared in turn and are listed by SortKeys.
+func ParseSort(spec string) (Comparator, error) {
+	var cs []Comparator
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		name, desc := strings.CutPrefix(key, "-")
+		i := slices.IndexFunc(sortKeys, func(k sortKey) bool { return k.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("rtapi: unknown sort key %q", key)
+		}
+
+		c := sortKeys[i].cmp
+		if desc {
+			c = c.Reverse()
+		}
+		cs = append(cs, c)
+	}
+	return Compare(cs...), nil
+}
 
-type byRatio Torrents
+// Sort sorts t by aSorting. Torrents which compare equal keep their order.
+func (t Torrents) Sort(aSorting sorting) {
+	if aSorting <= DefaultSorting || int(aSorting) > len(sortKeys)*2 {
+		return
+	}
 
-func (s byRatio) Len() int           { return len(s) }
-func (s byRatio) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s byRatio) Less(i, j int) bool { return s[i].Ratio < s[j].Ratio }
+	c := sortKeys[(aSorting-1)/2].cmp
+	if aSorting%2 == 0 { // the Rev sortings are even
+		c = c.Reverse()
+	}
+	t.SortFunc(c)
+}
 
-type byAge Torrents
+// SortBy sorts t by each of cs in turn, see Compare. Torrents which compare
+// equal keep their order.
+func (t Torrents) SortBy(cs ...Comparator) {
+	t.SortFunc(Compare(cs...))
+}
 
-func (s byAge) Len() int           { return len(s) }
-func (s byAge) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s byAge) Less(i, j int) bool { return s[i].Age < s[j].Age }
+// SortFunc sorts t by c, which returns a negative number when a sorts before
+// b, a positive one when after and 0 if equal. Torrents which compare equal
+// keep their order.
+func (t Torrents) SortFunc(c func(a, b *Torrent) int) {
+	slices.SortStableFunc(t, c)
+}
 
-type byUpTotal Torrents
+// sortETA is the ETA of t, unknown for stalled downloads, which sort last.
+func sortETA(t *Torrent) time.Duration {
+	if t.TimeLeft == 0 && t.Progress < 1 {
+		return math.MaxInt64
+	}
+	return t.TimeLeft
+}
 
-func (s byUpTotal) Len() int           { return len(s) }
-func (s byUpTotal) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
-func (s byUpTotal) Less(i, j int) bool { return s[i].UpTotal < s[j].UpTotal }
+func trackerHost(t *Torrent) string {
+	if t.Tracker == nil {
+		return ""
+	}
+	return t.Tracker.Hostname()
+}
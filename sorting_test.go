@@ -1,7 +1,10 @@
 package rtapi
 
 import (
+	"net/url"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestSorting(t *testing.T) {
@@ -83,5 +86,78 @@ func TestSorting(t *testing.T) {
 		t.Errorf("byUpTotal: Expected: 93413, 993413, 9176445, got: %d, %d, %d",
 			torrents[0].UpTotal, torrents[1].UpTotal, torrents[2].UpTotal)
 	}
+}
+
+func sortedNames(ts Torrents) []string {
+	names := make([]string, len(ts))
+	for i, t := range ts {
+		names[i] = t.Name
+	}
+	return names
+}
+
+func TestSortStable(t *testing.T) {
+	torrents := Torrents{
+		&Torrent{Name: "Debian", State: Seeding, Ratio: 1},
+		&Torrent{Name: "Ubuntu", State: Leeching, Progress: 0.5, TimeLeft: time.Hour},
+		&Torrent{Name: "Fedora", State: Seeding, Ratio: 1},
+		&Torrent{Name: "Gentoo", State: Leeching, Progress: 0.2},
+		&Torrent{Name: "Archlinux", State: Leeching, Progress: 0.9, TimeLeft: time.Minute},
+	}
+
+	torrents.Sort(ByRatioRev)
+	if got := sortedNames(torrents); !reflect.DeepEqual(got, []string{"Debian", "Fedora", "Ubuntu", "Gentoo", "Archlinux"}) {
+		t.Errorf("Expected equal ratios to keep their order, got: %v", got)
+	}
+
+	// stalled downloads have no ETA and sort last.
+	torrents.SortBy(CompareState, CompareETA)
+	if got := sortedNames(torrents); !reflect.DeepEqual(got, []string{"Archlinux", "Ubuntu", "Gentoo", "Debian", "Fedora"}) {
+		t.Errorf("Expected torrents sorted by state then ETA, got: %v", got)
+	}
 
+	torrents.SortFunc(func(a, b *Torrent) int { return len(a.Name) - len(b.Name) })
+	if got := sortedNames(torrents); !reflect.DeepEqual(got, []string{"Ubuntu", "Gentoo", "Debian", "Fedora", "Archlinux"}) {
+		t.Errorf("Expected torrents sorted by the length of their names, got: %v", got)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	tracker := func(host string) *url.URL { return &url.URL{Scheme: "udp", Host: host} }
+	torrents := Torrents{
+		&Torrent{Name: "Debian", Ratio: 2, Tracker: tracker("bttracker.debian.org:6969")},
+		&Torrent{Name: "Ubuntu", Ratio: 0.5, Tracker: tracker("torrent.ubuntu.com:6969")},
+		&Torrent{Name: "Archlinux", Ratio: 2},
+	}
+
+	testCases := []struct {
+		spec     string
+		expected []string
+	}{
+		{"-ratio,name", []string{"Archlinux", "Debian", "Ubuntu"}},
+		{"-ratio, -name", []string{"Debian", "Archlinux", "Ubuntu"}},
+		{"Tracker", []string{"Archlinux", "Debian", "Ubuntu"}},
+		{"-tracker", []string{"Ubuntu", "Debian", "Archlinux"}},
+	}
+	for _, test := range testCases {
+		c, err := ParseSort(test.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", test.spec, err)
+		}
+		torrents.SortFunc(c)
+		if got := sortedNames(torrents); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%q: Expected %v, got: %v", test.spec, test.expected, got)
+		}
+	}
+
+	for _, spec := range []string{"", "colour", "name,", "--name"} {
+		if _, err := ParseSort(spec); err == nil {
+			t.Errorf("%q: Expected an error", spec)
+		}
+	}
+	for _, key := range SortKeys() {
+		if _, err := ParseSort("-" + key); err != nil {
+			t.Errorf("Expected %q to be a known sort key, got: %v", key, err)
+		}
+	}
 }
@@ -0,0 +1,121 @@
+package rtapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// State is the state of a torrent, derived from its StateFlags. It marshals
+// to its name, the string the State constants held before they were typed,
+// so JSON and text output are unchanged for the states which existed then.
+// The zero State is unknown and its name is empty.
+type State uint8
+
+const (
+	Leeching     State = iota + 1 // started and downloading
+	Seeding                       // started and complete
+	Complete                      // stopped and complete
+	Stopped                       // stopped and incomplete
+	Hashing                       // checking its data
+	Error                         // started, with a message from rTorrent or a tracker
+	Paused                        // open but not active, peers are kept
+	Queued                        // started but closed, waiting to be opened
+	HashQueued                    // waiting for the check of another torrent
+	PartialSeed                   // seeding, with the remaining files skipped
+	StoppedError                  // stopped, with a message
+)
+
+var stateNames = [...]string{
+	Leeching:     "Leeching",
+	Seeding:      "Seeding",
+	Complete:     "Complete",
+	Stopped:      "Stopped",
+	Hashing:      "Hashing",
+	Error:        "Error",
+	Paused:       "Paused",
+	Queued:       "Queued",
+	HashQueued:   "HashQueued",
+	PartialSeed:  "PartialSeed",
+	StoppedError: "StoppedError",
+}
+
+// States lists every known State, in the order of their values.
+var States = []State{
+	Leeching, Seeding, Complete, Stopped, Hashing, Error,
+	Paused, Queued, HashQueued, PartialSeed, StoppedError,
+}
+
+func (s State) String() string {
+	if int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return fmt.Sprintf("State(%d)", s)
+}
+
+// ParseState returns the State named name, ignoring case. The empty string
+// is the zero State.
+func ParseState(name string) (State, error) {
+	if name == "" {
+		return 0, nil
+	}
+	for _, s := range States {
+		if strings.EqualFold(stateNames[s], name) {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("rtapi: unknown state %q", name)
+}
+
+func (s State) MarshalText() ([]byte, error) {
+	if int(s) >= len(stateNames) {
+		return nil, fmt.Errorf("rtapi: unknown state %d", s)
+	}
+	return []byte(stateNames[s]), nil
+}
+
+func (s *State) UnmarshalText(text []byte) error {
+	state, err := ParseState(string(text))
+	if err != nil {
+		return err
+	}
+	*s = state
+	return nil
+}
+
+// StateFlags are the flags of rTorrent a torrent's State is derived from.
+type StateFlags struct {
+	Open     bool  // d.is_open, the files are open and peers may connect
+	Active   bool  // d.is_active, false while closed or paused
+	Started  bool  // d.state, the torrent should be running
+	Complete bool  // d.complete
+	Hashing  int64 // d.hashing, 0 none, 1 initial check, 2 after finishing, 3 rehash
+	Checking bool  // d.is_hash_checking, false while the check is queued
+}
+
+// state derives the State from f, the message and the connection type
+// (d.connection_current) of the torrent.
+func (f StateFlags) state(message, connection string) State {
+	switch {
+	case f.Active && message != "":
+		return Error
+	case f.Hashing != 0 && !f.Checking:
+		return HashQueued
+	case f.Hashing != 0:
+		return Hashing
+	case !f.Started && message != "":
+		return StoppedError
+	case !f.Started && f.Complete:
+		return Complete
+	case !f.Started:
+		return Stopped
+	case !f.Open:
+		return Queued
+	case !f.Active:
+		return Paused
+	case f.Complete:
+		return Seeding
+	case connection == "seed":
+		return PartialSeed
+	}
+	return Leeching
+}
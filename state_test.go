@@ -0,0 +1,128 @@
+package rtapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pyed/rtapi/rtapitest"
+)
+
+func TestStateFlags(t *testing.T) {
+	testCases := []struct {
+		flags      StateFlags
+		message    string
+		connection string
+		expected   State
+	}{
+		{StateFlags{Open: true, Active: true, Started: true}, "", "leech", Leeching},
+		{StateFlags{Open: true, Active: true, Started: true, Complete: true}, "", "seed", Seeding},
+		{StateFlags{Open: true, Active: true, Started: true}, "", "seed", PartialSeed},
+		{StateFlags{Open: true, Started: true}, "", "leech", Paused},
+		{StateFlags{Started: true}, "", "", Queued},
+		{StateFlags{Open: true, Complete: true}, "", "", Complete},
+		{StateFlags{}, "", "", Stopped},
+		{StateFlags{}, "Tracker: [Timeout was reached]", "", StoppedError},
+		{StateFlags{Open: true, Active: true, Started: true}, "Tracker: [Timeout was reached]", "leech", Error},
+		{StateFlags{Open: true, Active: true, Started: true, Hashing: 3, Checking: true}, "", "leech", Hashing},
+		{StateFlags{Open: true, Started: true, Hashing: 1}, "", "", HashQueued},
+	}
+
+	for i, test := range testCases {
+		if got := test.flags.state(test.message, test.connection); got != test.expected {
+			t.Errorf("Case %d: Expected %s, got: %s", i, test.expected, got)
+		}
+	}
+}
+
+func TestStateMarshal(t *testing.T) {
+	data, err := json.Marshal(map[string]State{"state": PartialSeed, "old": Leeching})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"old":"Leeching","state":"PartialSeed"}` {
+		t.Errorf("Expected the state names, got: %s", data)
+	}
+
+	var v struct{ State State }
+	if err := json.Unmarshal([]byte(`{"State":"seeding"}`), &v); err != nil || v.State != Seeding {
+		t.Errorf("Expected Seeding, got: %s, %v", v.State, err)
+	}
+	if err := json.Unmarshal([]byte(`{"State":"Sleeping"}`), &v); err == nil {
+		t.Error("Expected an error for an unknown state")
+	}
+
+	if s, err := ParseState(""); err != nil || s != 0 || s.String() != "" {
+		t.Errorf("Expected the empty string to be the zero state, got: %q, %v", s, err)
+	}
+	if s := State(200); s.String() != "State(200)" {
+		t.Errorf("Expected State(200), got: %s", s)
+	}
+}
+
+func TestPausedState(t *testing.T) {
+	fake := newRetryServer(t)
+	fake.AddTorrent(&rtapitest.Torrent{
+		Hash: "02CA77A6A047FD37F04337437D18F82E61861084", Name: "archlinux.iso", Size: 2048, Completed: 1024,
+		Open: true, Active: true, Started: true,
+	})
+	rt, err := NewRtorrent(fake.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rt.Call("d.pause", "02CA77A6A047FD37F04337437D18F82E61861084"); err != nil {
+		t.Fatal(err)
+	}
+	arch, err := rt.GetTorrent("02CA77A6A047FD37F04337437D18F82E61861084")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := StateFlags{Open: true, Started: true}
+	if arch.State != Paused || arch.Flags != expected {
+		t.Errorf("Expected a paused torrent with %+v, got: %s %+v", expected, arch.State, arch.Flags)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	const hash = "02CA77A6A047FD37F04337437D18F82E61861084"
+	fake := newRetryServer(t)
+	fake.AddTorrent(&rtapitest.Torrent{
+		Hash: hash, Name: "archlinux.iso", Size: 2048, Completed: 1024,
+		Open: true, Active: true, Started: true,
+	})
+	rt, err := NewRtorrent(fake.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arch, err := rt.GetTorrent(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		action   func(...*Torrent) error
+		expected State
+	}{
+		{rt.Pause, Paused},
+		{rt.Resume, Leeching},
+		{rt.Close, Queued},
+		{rt.Resume, Queued},
+		{rt.Open, Paused},
+		{rt.Stop, Stopped},
+		{rt.Resume, Stopped},
+		{rt.Close, Stopped},
+		{rt.ForceStart, Leeching},
+	}
+	for i, step := range steps {
+		if err := step.action(arch); err != nil {
+			t.Fatalf("Step %d: %v", i, err)
+		}
+		got, err := rt.GetTorrent(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.State != step.expected {
+			t.Errorf("Step %d: Expected %s, got: %s", i, step.expected, got.State)
+		}
+	}
+}
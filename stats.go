@@ -0,0 +1,284 @@
+package rtapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Transfer holds the global transfer rates of rTorrent, in bytes/s, and
+// the bytes transferred since it started. rTorrent doesn't report the
+// protocol overhead apart from the payload.
+type Transfer struct {
+	DownRate, UpRate   uint64
+	DownLimit, UpLimit uint64 // zero is unlimited
+	DownTotal, UpTotal uint64
+}
+
+func buildTransferRequest() xmlrpcMethodCall {
+	request := xmlrpcMethodCall{
+		MethodName: "system.multicall",
+		Params: []xmlrpcParam{
+			{
+				Value: newArrayValue(
+					newMethodCall("throttle.global_down.rate", ""),
+					newMethodCall("throttle.global_up.rate", ""),
+					newMethodCall("throttle.global_down.max_rate", ""),
+					newMethodCall("throttle.global_up.max_rate", ""),
+					newMethodCall("throttle.global_down.total", ""),
+					newMethodCall("throttle.global_up.total", ""),
+				),
+			},
+		},
+	}
+
+	return request
+}
+
+// Transfer returns the global rates, limits and totals, fetched in one
+// multicall.
+func (r *Rtorrent) Transfer(ctx context.Context) (*Transfer, error) {
+	resp, err := r.execute(ctx, buildTransferRequest())
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := resp.arrayParam()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) < 6 {
+		return nil, &ProtocolError{Msg: fmt.Sprintf("expected 6 transfer values, got %d", len(values))}
+	}
+
+	t := new(Transfer)
+	for i, field := range []struct {
+		name string
+		dst  *uint64
+	}{
+		{"down rate", &t.DownRate},
+		{"up rate", &t.UpRate},
+		{"down limit", &t.DownLimit},
+		{"up limit", &t.UpLimit},
+		{"down total", &t.DownTotal},
+		{"up total", &t.UpTotal},
+	} {
+		v, err := values[i].firstArrayValue()
+		if err != nil {
+			return nil, &DecodeError{Field: field.name, Index: i, Err: err}
+		}
+		if *field.dst, err = v.uint64Value(); err != nil {
+			return nil, &DecodeError{Field: field.name, Index: i, Err: err}
+		}
+	}
+
+	return t, nil
+}
+
+// SessionStats holds the global statistics of rTorrent.
+type SessionStats struct {
+	ThrottleUp, ThrottleDown uint64 // global rate limits in bytes/s, zero is unlimited
+	TotalUp, TotalDown       uint64 // bytes transferred since rTorrent started
+	Port                     int    // listening port
+	Directory                string // default download directory
+
+	// The fields below are left zero when rTorrent doesn't report them,
+	// e.g. versions without the command or DHT support.
+	OpenSockets    int
+	MaxOpenSockets int
+	MaxPeers       int // per torrent while leeching
+	MaxPeersSeed   int // per torrent while seeding
+	DHT            DHTStats
+	MemoryUsage    uint64 // bytes used by the piece cache
+	MaxMemory      uint64 // cap of the piece cache
+	FreeDiskSpace  uint64 // bytes available in Directory, see Stats
+	Uptime         time.Duration
+	Torrents       TorrentCounts
+}
+
+// DHTStats is the state of the DHT node, as reported by dht.statistics.
+type DHTStats struct {
+	Mode   string // "disable", "off", "auto" or "on"
+	Active bool
+	Nodes  int
+}
+
+// TorrentCounts counts the torrents in each of rTorrent's built-in views.
+type TorrentCounts struct {
+	Total      int
+	Started    int
+	Stopped    int
+	Complete   int
+	Incomplete int
+	Seeding    int
+	Leeching   int
+	Hashing    int
+	Active     int // transferring data
+}
+
+// countViews are the views counted into TorrentCounts, in field order.
+var countViews = []string{"main", "started", "stopped", "complete", "incomplete", "seeding", "leeching", "hashing", "active"}
+
+func (c *TorrentCounts) fields() []*int {
+	return []*int{&c.Total, &c.Started, &c.Stopped, &c.Complete, &c.Incomplete, &c.Seeding, &c.Leeching, &c.Hashing, &c.Active}
+}
+
+func buildStatsRequest() xmlrpcMethodCall {
+	calls := []xmlrpcValue{
+		newMethodCall("throttle.up.max", "", ""),
+		newMethodCall("throttle.down.max", "", ""),
+		newMethodCall("throttle.global_up.total"),
+		newMethodCall("throttle.global_down.total"),
+		newMethodCall("network.listen.port"),
+		newMethodCall("directory.default"),
+		newMethodCall("network.open_sockets"),
+		newMethodCall("network.max_open_sockets"),
+		newMethodCall("throttle.max_peers.normal"),
+		newMethodCall("throttle.max_peers.seed"),
+		newMethodCall("dht.statistics"),
+		newMethodCall("pieces.memory.current"),
+		newMethodCall("pieces.memory.max"),
+		newMethodCall("system.startup_time"),
+		newMethodCall("system.time_seconds"),
+		// rTorrent only reports the free disk space of a torrent's files.
+		newMethodCall("d.multicall2", "", "main", "d.directory=", "d.free_diskspace="),
+	}
+	for _, view := range countViews {
+		calls = append(calls, newMethodCall("view.size", "", view))
+	}
+
+	request := xmlrpcMethodCall{
+		MethodName: "system.multicall",
+		Params: []xmlrpcParam{
+			{
+				Value: newArrayValue(calls...),
+			},
+		},
+	}
+
+	return request
+}
+
+// Stats returns the session statistics, fetched in one multicall.
+// FreeDiskSpace is read from the first torrent saved in Directory, as
+// rTorrent has no global command for it: it stays zero without one, and
+// the call costs two values per torrent.
+func (r *Rtorrent) Stats() (*SessionStats, error) {
+	resp, err := r.execute(context.Background(), buildStatsRequest())
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := resp.arrayParam()
+	if err != nil {
+		return nil, err
+	}
+
+	expected := 16 + len(countViews)
+	if len(values) < expected {
+		return nil, &ProtocolError{Msg: fmt.Sprintf("expected %d stats values, got %d", expected, len(values))}
+	}
+
+	results := make([]xmlrpcValue, len(values))
+	for i := range values {
+		// the first six commands are required, faults of the optional
+		// ones are zero values.
+		results[i], err = values[i].firstArrayValue()
+		var fault *Fault
+		if i < 6 && errors.As(err, &fault) {
+			return nil, fault
+		}
+	}
+
+	st := new(SessionStats)
+	if st.ThrottleUp, err = results[0].uint64Value(); err != nil {
+		return nil, &DecodeError{Field: "throttle up", Index: 0, Err: err}
+	}
+	if st.ThrottleDown, err = results[1].uint64Value(); err != nil {
+		return nil, &DecodeError{Field: "throttle down", Index: 1, Err: err}
+	}
+	if st.TotalUp, err = results[2].uint64Value(); err != nil {
+		return nil, &DecodeError{Field: "total up", Index: 2, Err: err}
+	}
+	if st.TotalDown, err = results[3].uint64Value(); err != nil {
+		return nil, &DecodeError{Field: "total down", Index: 3, Err: err}
+	}
+	port, err := results[4].int64Value()
+	if err != nil {
+		return nil, &DecodeError{Field: "port", Index: 4, Err: err}
+	}
+	st.Port = int(port)
+	if st.Directory, err = results[5].stringValue(); err != nil {
+		return nil, &DecodeError{Field: "directory", Index: 5, Err: err}
+	}
+
+	st.OpenSockets = results[6].intOrZero()
+	st.MaxOpenSockets = results[7].intOrZero()
+	st.MaxPeers = results[8].intOrZero()
+	st.MaxPeersSeed = results[9].intOrZero()
+	st.DHT = parseDHTStats(results[10])
+	st.MemoryUsage = uint64(results[11].intOrZero())
+	st.MaxMemory = uint64(results[12].intOrZero())
+	if started := results[13].intOrZero(); started > 0 {
+		st.Uptime = time.Duration(results[14].intOrZero()-started) * time.Second
+	}
+	st.FreeDiskSpace = freeDiskSpace(results[15], st.Directory)
+	for i, n := range st.Torrents.fields() {
+		*n = results[16+i].intOrZero()
+	}
+
+	return st, nil
+}
+
+// intOrZero returns v as an int, zero if it isn't a non-negative integer.
+func (v xmlrpcValue) intOrZero() int {
+	n, err := v.uint64Value()
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// parseDHTStats reads the struct returned by dht.statistics, which only
+// holds "dht" and "active" while the node isn't running.
+func parseDHTStats(v xmlrpcValue) DHTStats {
+	var dht DHTStats
+	if v.Struct == nil {
+		return dht
+	}
+	for _, m := range v.Struct.Members {
+		switch m.Name {
+		case "dht":
+			dht.Mode, _ = m.Value.stringValue()
+		case "active":
+			dht.Active = m.Value.intOrZero() != 0
+		case "nodes":
+			dht.Nodes = m.Value.intOrZero()
+		}
+	}
+	return dht
+}
+
+// freeDiskSpace returns the free disk space of the first torrent in dir from
+// the rows of d.directory and d.free_diskspace, zero if there is none.
+func freeDiskSpace(v xmlrpcValue, dir string) uint64 {
+	if v.Array == nil {
+		return 0
+	}
+	dir = strings.TrimSuffix(dir, "/")
+	for _, row := range v.Array.Values {
+		if row.Array == nil || len(row.Array.Values) < 2 {
+			continue
+		}
+		d, err := row.Array.Values[0].stringValue()
+		if err != nil || d != dir && !strings.HasPrefix(d, dir+"/") {
+			continue
+		}
+		if free, err := row.Array.Values[1].uint64Value(); err == nil {
+			return free
+		}
+	}
+	return 0
+}
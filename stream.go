@@ -0,0 +1,864 @@
+package rtapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// trackersBatch is how many torrents TorrentsIter decodes before it fetches
+// their trackers and hands them to the callback.
+const trackersBatch = 256
+
+// TorrentsIter calls fn for every torrent, in the order of the main view,
+// while the answer of rTorrent is being decoded. Unlike Torrents, only a
+// batch of torrents is held in memory at a time, which matters with tens of
+// thousands of torrents. Iteration stops at the first error returned by fn,
+// and that error is returned. CurrentSorting is not applied.
+func (r *Rtorrent) TorrentsIter(ctx context.Context, fn func(*Torrent) error) error {
+	req := buildTorrentsRequest()
+
+	// a failed attempt is only retried before torrents were handed out.
+	var handed bool
+	err := r.do(ctx, req, true, func(body io.Reader) error {
+		batch := make(Torrents, 0, trackersBatch)
+		var parsed int // torrents decoded so far, the index of the next one
+		flush := func() error {
+			if err := r.getTrackers(nested(ctx), batch); err != nil {
+				var decodeErr *DecodeError
+				if errors.As(err, &decodeErr) {
+					decodeErr.Index += parsed - len(batch)
+				}
+				return err
+			}
+			for _, t := range batch {
+				handed = true
+				if err := fn(t); err != nil {
+					return &finalError{err}
+				}
+			}
+			batch = batch[:0]
+			return nil
+		}
+
+		err := decodeArrayResponse(body, func(v xmlrpcValue) error {
+			t, err := parseTorrent(v)
+			if err != nil {
+				var decodeErr *DecodeError
+				if errors.As(err, &decodeErr) {
+					decodeErr.Index = parsed
+				}
+				return err
+			}
+			parsed++
+			batch = append(batch, t)
+			if len(batch) == trackersBatch {
+				return flush()
+			}
+			return nil
+		})
+		if err == nil {
+			err = flush()
+		}
+		var final *finalError
+		if err != nil && handed && !errors.As(err, &final) {
+			return &finalError{err}
+		}
+		return err
+	})
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	}
+	return nil
+}
+
+// decodeArrayResponse reads a method response whose param is an array, and
+// calls fn with each of its values as soon as it is decoded. The values share
+// buffers with the next ones, fn must not keep them. JSON-RPC responses are
+// handed to decodeJSONArray.
+//
+// It reads what decodeMethodResponse does and arrayParam returns: as with
+// encoding/xml, elements are matched by their local name and unknown ones
+// are skipped.
+func decodeArrayResponse(r io.Reader, fn func(xmlrpcValue) error) error {
+	br := bufio.NewReader(r)
+	b, err := skipToPayload(br)
+	if err != nil {
+		return err
+	}
+	if b == '{' {
+		return decodeJSONArray(br, fn)
+	}
+
+	s := &scanner{br: br}
+	var fnErr error
+	err = s.response(func(v xmlrpcValue) error {
+		fnErr = fn(v)
+		return fnErr
+	})
+	var fault *Fault
+	var protoErr *ProtocolError
+	switch {
+	case err == nil || err == fnErr || errors.As(err, &fault) || errors.As(err, &protoErr):
+		return err
+	}
+	return &ProtocolError{Msg: "decode xmlrpc response", Err: err}
+}
+
+// response reads the root element, whatever its name, and calls fn with the
+// values of the arrays of its first param. A fault is returned as a *Fault.
+func (s *scanner) response(fn func(xmlrpcValue) error) error {
+	if err := s.next(); err != nil {
+		return err
+	}
+	if s.end {
+		return fmt.Errorf("unexpected </%s>", s.name)
+	}
+
+	var param, array bool // the first param, and an array in it, were read
+	err := s.children(func() error {
+		switch string(s.name) {
+		case "fault":
+			return s.fault()
+		case "params":
+		default:
+			return s.skip()
+		}
+
+		return s.children(func() error {
+			if string(s.name) != "param" || param {
+				return s.skip()
+			}
+			param = true
+
+			return s.children(func() error {
+				if string(s.name) != "value" {
+					return s.skip()
+				}
+				return s.children(func() error {
+					if string(s.name) != "array" {
+						return s.skip()
+					}
+					array = true
+					return s.children(func() error {
+						if string(s.name) != "data" {
+							return s.skip()
+						}
+						return s.rows(fn)
+					})
+				})
+			})
+		})
+	})
+	switch {
+	case err != nil:
+		return err
+	case !param:
+		return &ProtocolError{Msg: "xmlrpc response missing params"}
+	case !array:
+		return &ProtocolError{Msg: "expected array value in response param"}
+	}
+	return nil
+}
+
+// rows calls fn with each value of the <data> element whose start was just
+// read.
+func (s *scanner) rows(fn func(xmlrpcValue) error) error {
+	if s.empty {
+		return nil
+	}
+
+	var v xmlrpcValue
+	for {
+		if err := s.next(); err != nil {
+			return err
+		}
+		if s.end {
+			return nil
+		}
+		if string(s.name) != "value" {
+			if err := s.skip(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		s.reset()
+		v = xmlrpcValue{}
+		if err := s.value(&v); err != nil {
+			return err
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+}
+
+// fault decodes the <fault> element whose start was just read. A fault
+// without a value isn't one.
+func (s *scanner) fault() error {
+	var v xmlrpcValue
+	var found bool
+	err := s.children(func() error {
+		if string(s.name) != "value" {
+			return s.skip()
+		}
+		found = true
+		// the fault outlives the pooled buffers.
+		if err := s.value(&v); err != nil {
+			return err
+		}
+		v = detach(v)
+		return nil
+	})
+	switch {
+	case err != nil:
+		return &ProtocolError{Msg: "decode xmlrpc fault", Err: err}
+	case !found:
+		return nil
+	}
+	if f := v.fault(); f != nil {
+		return f
+	}
+	return &ProtocolError{Msg: "invalid xmlrpc fault"}
+}
+
+// scanner reads XML-RPC values straight from the bytes of a response,
+// without the tokens and reflection of encoding/xml. It knows what XML-RPC
+// uses: elements, whose attributes are ignored, text with the predefined
+// and numeric entities, and CDATA sections. Comments, processing
+// instructions and declarations are skipped. Unlike encoding/xml, it doesn't
+// check that the end tags match.
+//
+// The scalars and arrays of a value are kept in buffers which reset reuses
+// for the next value.
+type scanner struct {
+	br *bufio.Reader
+
+	// the local name of the last tag read by next, and the text before it.
+	name  []byte
+	end   bool // </name>
+	empty bool // <name/>
+	text  []byte
+
+	raw   []byte // text or markup spanning reads
+	tag   []byte // a tag spanning reads
+	cdata []byte
+	buf   []byte        // the text of a scalar
+	chars []byte        // the text of the values being read, see value
+	stack []xmlrpcValue // the values of the arrays being read, see array
+	depth int           // of nested values
+
+	ints    []int64
+	strings []string
+	values  []xmlrpcValue
+	arrays  []xmlrpcArray
+}
+
+// reset lets the buffers of the previous value be reused.
+func (s *scanner) reset() {
+	s.ints = s.ints[:0]
+	s.strings = s.strings[:0]
+	s.values = s.values[:0]
+	s.arrays = s.arrays[:0]
+}
+
+// next reads up to and including the next tag, the text before it is left
+// in s.text.
+func (s *scanner) next() error {
+	s.text = s.text[:0]
+	for {
+		raw, err := s.readUntil('<')
+		if err != nil {
+			return err
+		}
+		if s.text, err = appendUnescaped(s.text, raw[:len(raw)-1]); err != nil {
+			return err
+		}
+
+		b, err := s.br.Peek(1)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		switch b[0] {
+		case '?':
+			if err := s.skipPast("?>"); err != nil {
+				return err
+			}
+			continue
+		case '!':
+			if err := s.markup(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tag, err := s.readTag()
+		if err != nil {
+			return err
+		}
+		tag = tag[:len(tag)-1]
+		s.end = len(tag) > 0 && tag[0] == '/'
+		if s.end {
+			tag = tag[1:]
+		}
+		s.empty = !s.end && len(tag) > 0 && tag[len(tag)-1] == '/'
+		if s.empty {
+			tag = tag[:len(tag)-1]
+		}
+		if i := bytes.IndexAny(tag, " \t\r\n"); i >= 0 {
+			tag = tag[:i]
+		}
+		// the prefix of a namespace is dropped, as encoding/xml does.
+		if i := bytes.IndexByte(tag, ':'); i > 0 && i < len(tag)-1 {
+			tag = tag[i+1:]
+		}
+		if len(tag) == 0 {
+			return errors.New("empty tag name")
+		}
+		s.name = append(s.name[:0], tag...)
+		return nil
+	}
+}
+
+// readTag reads the rest of a tag, up to and including its '>', which
+// quoted attribute values may contain.
+func (s *scanner) readTag() ([]byte, error) {
+	b, err := s.readUntil('>')
+	if err != nil || quotesClosed(b) {
+		return b, err
+	}
+
+	s.tag = append(s.tag[:0], b...)
+	for !quotesClosed(s.tag) {
+		if b, err = s.readUntil('>'); err != nil {
+			return nil, err
+		}
+		s.tag = append(s.tag, b...)
+	}
+	return s.tag, nil
+}
+
+func quotesClosed(b []byte) bool {
+	var quote byte
+	for _, c := range b {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		}
+	}
+	return quote == 0
+}
+
+// markup handles what starts with "<!": CDATA sections are added to the
+// text, comments and declarations are skipped.
+func (s *scanner) markup() error {
+	if b, _ := s.br.Peek(3); string(b) == "!--" {
+		return s.skipPast("-->")
+	}
+	if b, _ := s.br.Peek(8); string(b) == "![CDATA[" {
+		s.br.Discard(8)
+		s.cdata = s.cdata[:0]
+		for !bytes.HasSuffix(s.cdata, []byte("]]>")) {
+			b, err := s.readUntil('>')
+			if err != nil {
+				return err
+			}
+			s.cdata = append(s.cdata, b...)
+		}
+		s.text = appendText(s.text, s.cdata[:len(s.cdata)-3])
+		return nil
+	}
+
+	// a declaration, e.g. <!DOCTYPE>, may nest others in brackets.
+	var depth int
+	var quote byte
+	for {
+		b, err := s.br.ReadByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		switch {
+		case quote != 0:
+			if b == quote {
+				quote = 0
+			}
+		case b == '"' || b == '\'':
+			quote = b
+		case b == '<':
+			depth++
+		case b == '>':
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		}
+	}
+}
+
+// readUntil reads up to and including delim, the bytes are valid until the
+// next read.
+func (s *scanner) readUntil(delim byte) ([]byte, error) {
+	b, err := s.br.ReadSlice(delim)
+	if err == nil {
+		return b, nil
+	}
+
+	s.raw = append(s.raw[:0], b...)
+	for err == bufio.ErrBufferFull {
+		b, err = s.br.ReadSlice(delim)
+		s.raw = append(s.raw, b...)
+	}
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return s.raw, nil
+}
+
+// skipPast discards the input up to and including end.
+func (s *scanner) skipPast(end string) error {
+	last := end[len(end)-1]
+	var tail []byte
+	for {
+		b, err := s.readUntil(last)
+		if err != nil {
+			return err
+		}
+		tail = append(tail, b...)
+		if bytes.HasSuffix(tail, []byte(end)) {
+			return nil
+		}
+		tail = tail[max(0, len(tail)-len(end)):]
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// children calls fn for each child of the element whose start was just
+// read, fn must read the child up to its end. The text is dropped.
+func (s *scanner) children(fn func() error) error {
+	if s.empty {
+		return nil
+	}
+	for {
+		if err := s.next(); err != nil {
+			return err
+		}
+		if s.end {
+			return nil
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+}
+
+// skip reads past the end of the element whose start was just read.
+func (s *scanner) skip() error {
+	if s.empty {
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		if err := s.next(); err != nil {
+			return err
+		}
+		switch {
+		case s.end:
+			depth--
+		case !s.empty:
+			depth++
+		}
+	}
+	return nil
+}
+
+// maxDepth is how deep values may nest, encoding/xml stops sooner.
+const maxDepth = 10000
+
+// value decodes the content of the <value> element whose start was just
+// read, up to and including its end. Like encoding/xml, it adds to what v
+// holds: a second array adds its values, a second int replaces the first.
+func (s *scanner) value(v *xmlrpcValue) error {
+	if s.empty {
+		if v.untyped() {
+			v.Text = ""
+		}
+		return nil
+	}
+	if s.depth++; s.depth > maxDepth {
+		return errors.New("exceeded max depth")
+	}
+	defer func() { s.depth-- }()
+
+	// the text of nested values is gathered after this one's, and dropped
+	// once they are read.
+	start := len(s.chars)
+	defer func() { s.chars = s.chars[:start] }()
+	for {
+		if err := s.next(); err != nil {
+			return err
+		}
+		s.chars = append(s.chars, s.text...)
+		if s.end {
+			break
+		}
+
+		var err error
+		switch string(s.name) {
+		case "array":
+			err = s.array(v)
+		case "struct":
+			err = s.structValue(v)
+		case "nil":
+			v.Nil = &struct{}{}
+			err = s.skip()
+		case "string":
+			err = s.scalar(v, "string")
+		case "int":
+			err = s.scalar(v, "int")
+		case "i4":
+			err = s.scalar(v, "i4")
+		case "i8":
+			err = s.scalar(v, "i8")
+		case "double":
+			err = s.scalar(v, "double")
+		case "boolean":
+			err = s.scalar(v, "boolean")
+		case "base64":
+			err = s.scalar(v, "base64")
+		case "dateTime.iso8601":
+			err = s.scalar(v, "dateTime.iso8601")
+		default:
+			err = s.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// untyped values are strings.
+	if v.untyped() {
+		v.Text = string(s.chars[start:])
+	}
+	return nil
+}
+
+// chardata reads the text of the element whose start was just read, up to
+// its end. The elements within are skipped, as encoding/xml does.
+func (s *scanner) chardata() ([]byte, error) {
+	if s.empty {
+		return nil, nil
+	}
+	if err := s.next(); err != nil {
+		return nil, err
+	}
+	if s.end {
+		return s.text, nil
+	}
+
+	s.buf = append(s.buf[:0], s.text...)
+	for {
+		if err := s.skip(); err != nil {
+			return nil, err
+		}
+		if err := s.next(); err != nil {
+			return nil, err
+		}
+		s.buf = append(s.buf, s.text...)
+		if s.end {
+			return s.buf, nil
+		}
+	}
+}
+
+// scalar decodes the kind element whose start was just read into v. As
+// with encoding/xml, empty numbers and booleans are zero.
+func (s *scanner) scalar(v *xmlrpcValue, kind string) error {
+	text, err := s.chardata()
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case "string":
+		s.strings = append(s.strings, string(text))
+		v.String = &s.strings[len(s.strings)-1]
+	case "int", "i4", "i8":
+		var n int64
+		if len(text) > 0 {
+			if n, err = parseInt(text); err != nil {
+				return err
+			}
+		}
+		s.ints = append(s.ints, n)
+		switch kind {
+		case "int":
+			v.Int = &s.ints[len(s.ints)-1]
+		case "i4":
+			v.I4 = &s.ints[len(s.ints)-1]
+		default:
+			v.I8 = &s.ints[len(s.ints)-1]
+		}
+	case "double":
+		var f float64
+		if len(text) > 0 {
+			if f, err = strconv.ParseFloat(string(bytes.TrimSpace(text)), 64); err != nil {
+				return err
+			}
+		}
+		v.Double = &f
+	case "boolean":
+		var b bool
+		if len(text) > 0 {
+			if b, err = strconv.ParseBool(string(bytes.TrimSpace(text))); err != nil {
+				return err
+			}
+		}
+		v.Boolean = &b
+	case "base64":
+		v.Base64 = new(xmlrpcBase64)
+		return v.Base64.UnmarshalText(text)
+	case "dateTime.iso8601":
+		v.DateTime = new(xmlrpcTime)
+		return v.DateTime.UnmarshalText(text)
+	}
+	return nil
+}
+
+// array decodes the <array> element whose start was just read into v.
+func (s *scanner) array(v *xmlrpcValue) error {
+	// the values are gathered on the stack, nested arrays push theirs
+	// above, and copied to s.values once complete.
+	base := len(s.stack)
+	defer func() { s.stack = s.stack[:base] }()
+
+	if !s.empty {
+		for {
+			if err := s.next(); err != nil {
+				return err
+			}
+			if s.end {
+				break
+			}
+			var err error
+			if string(s.name) == "data" {
+				err = s.data()
+			} else {
+				err = s.skip()
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if v.Array != nil {
+		// a second array in the value, rare enough not to be pooled.
+		v.Array = &xmlrpcArray{Values: append(v.Array.Values[:len(v.Array.Values):len(v.Array.Values)], s.stack[base:]...)}
+		return nil
+	}
+	start := len(s.values)
+	s.values = append(s.values, s.stack[base:]...)
+	s.arrays = append(s.arrays, xmlrpcArray{Values: s.values[start:len(s.values):len(s.values)]})
+	v.Array = &s.arrays[len(s.arrays)-1]
+	return nil
+}
+
+// data pushes the values of the <data> element whose start was just read.
+func (s *scanner) data() error {
+	if s.empty {
+		return nil
+	}
+	for {
+		if err := s.next(); err != nil {
+			return err
+		}
+		if s.end {
+			return nil
+		}
+		if string(s.name) != "value" {
+			if err := s.skip(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var v xmlrpcValue
+		if err := s.value(&v); err != nil {
+			return err
+		}
+		s.stack = append(s.stack, v)
+	}
+}
+
+// structValue decodes the <struct> element whose start was just read into
+// v. Structs are only used by faults, they aren't pooled.
+func (s *scanner) structValue(v *xmlrpcValue) error {
+	if v.Struct == nil {
+		v.Struct = new(xmlrpcStruct)
+	}
+	return s.children(func() error {
+		if string(s.name) != "member" {
+			return s.skip()
+		}
+
+		var m xmlrpcMember
+		err := s.children(func() error {
+			switch string(s.name) {
+			case "name":
+				text, err := s.chardata()
+				m.Name = string(text)
+				return err
+			case "value":
+				if err := s.value(&m.Value); err != nil {
+					return err
+				}
+				// the member outlives the pooled buffers.
+				m.Value = detach(m.Value)
+				return nil
+			}
+			return s.skip()
+		})
+		v.Struct.Members = append(v.Struct.Members, m)
+		return err
+	})
+}
+
+// detach copies the pooled scalars and arrays of v.
+func detach(v xmlrpcValue) xmlrpcValue {
+	if v.String != nil {
+		str := *v.String
+		v.String = &str
+	}
+	for _, p := range []**int64{&v.Int, &v.I4, &v.I8} {
+		if *p != nil {
+			n := **p
+			*p = &n
+		}
+	}
+	if v.Array != nil {
+		values := make([]xmlrpcValue, len(v.Array.Values))
+		for i := range values {
+			values[i] = detach(v.Array.Values[i])
+		}
+		v.Array = &xmlrpcArray{Values: values}
+	}
+	return v
+}
+
+// parseInt is strconv.ParseInt for the bytes of an integer, surrounded by
+// spaces, without converting them to a string.
+func parseInt(b []byte) (int64, error) {
+	b = bytes.TrimSpace(b)
+	neg := len(b) > 0 && b[0] == '-'
+	digits := b
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		digits = b[1:]
+	}
+	if len(digits) == 0 || len(digits) > 18 {
+		// empty, or maybe out of range.
+		return strconv.ParseInt(string(b), 10, 64)
+	}
+
+	var n int64
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return strconv.ParseInt(string(b), 10, 64)
+		}
+		n = n*10 + int64(c-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, nil
+}
+
+// appendText appends raw text to dst, with its line ends turned into "\n"
+// as XML requires.
+func appendText(dst, text []byte) []byte {
+	for {
+		i := bytes.IndexByte(text, '\r')
+		if i < 0 {
+			return append(dst, text...)
+		}
+		dst = append(append(dst, text[:i]...), '\n')
+		text = text[i+1:]
+		if len(text) > 0 && text[0] == '\n' {
+			text = text[1:]
+		}
+	}
+}
+
+// appendUnescaped appends text to dst, with its entities replaced and its
+// line ends turned into "\n".
+func appendUnescaped(dst, text []byte) ([]byte, error) {
+	for {
+		i := bytes.IndexByte(text, '&')
+		if i < 0 {
+			return appendText(dst, text), nil
+		}
+		dst = appendText(dst, text[:i])
+		text = text[i+1:]
+
+		j := bytes.IndexByte(text, ';')
+		if j < 0 {
+			return nil, errors.New("unterminated entity")
+		}
+		entity := text[:j]
+		text = text[j+1:]
+
+		switch string(entity) {
+		case "amp":
+			dst = append(dst, '&')
+		case "lt":
+			dst = append(dst, '<')
+		case "gt":
+			dst = append(dst, '>')
+		case "quot":
+			dst = append(dst, '"')
+		case "apos":
+			dst = append(dst, '\'')
+		default:
+			r, ok := charRef(entity)
+			if !ok {
+				return nil, fmt.Errorf("invalid entity &%s;", entity)
+			}
+			dst = utf8.AppendRune(dst, r)
+		}
+	}
+}
+
+// charRef decodes the character reference "#65" or "#x41". Like
+// encoding/xml, surrogates become utf8.RuneError once appended.
+func charRef(entity []byte) (rune, bool) {
+	if len(entity) < 2 || entity[0] != '#' {
+		return 0, false
+	}
+	base, digits := 10, entity[1:]
+	if digits[0] == 'x' {
+		base, digits = 16, digits[1:]
+	}
+	n, err := strconv.ParseUint(string(digits), base, 64)
+	if err != nil || n > unicode.MaxRune {
+		return 0, false
+	}
+	return rune(n), true
+}
@@ -0,0 +1,454 @@
+package transmission
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+// Transmission's tr_torrent_activity.
+const (
+	statusStopped      = 0
+	statusCheckWait    = 1
+	statusCheck        = 2
+	statusDownloadWait = 3
+	statusDownload     = 4
+	statusSeedWait     = 5
+	statusSeed         = 6
+)
+
+// Transmission's tr_stat_errtype.
+const (
+	errorNone           = 0
+	errorTrackerWarning = 1
+	errorTracker        = 2
+	errorLocal          = 3
+)
+
+// selector picks torrents from the "ids" argument: all of them if it's
+// absent, the ones with traffic for "recently-active", or the listed ids
+// and hashes.
+type selector struct {
+	all, recent bool
+	ids         map[int]bool
+	hashes      map[string]bool
+}
+
+func parseIDs(raw json.RawMessage) (*selector, error) {
+	sel := &selector{ids: make(map[int]bool), hashes: make(map[string]bool)}
+	if len(raw) == 0 || string(raw) == "null" {
+		sel.all = true
+		return sel, nil
+	}
+
+	var list []json.RawMessage
+	if raw[0] == '[' {
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, fmt.Errorf("invalid ids: %w", err)
+		}
+	} else {
+		list = []json.RawMessage{raw}
+	}
+
+	for _, item := range list {
+		var id int
+		if err := json.Unmarshal(item, &id); err == nil {
+			sel.ids[id] = true
+			continue
+		}
+
+		var s string
+		if err := json.Unmarshal(item, &s); err != nil {
+			return nil, fmt.Errorf("invalid id: %s", item)
+		}
+		if s == "recently-active" {
+			sel.recent = true
+			continue
+		}
+		sel.hashes[strings.ToUpper(s)] = true
+	}
+	return sel, nil
+}
+
+// selectTorrents returns the torrents picked by the "ids" argument.
+func (h *Handler) selectTorrents(raw json.RawMessage) (rtapi.Torrents, error) {
+	sel, err := parseIDs(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	torrents, err := h.rt.Torrents()
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(rtapi.Torrents, 0, len(torrents))
+	for _, t := range torrents {
+		id := h.id(t.Hash)
+		switch {
+		case sel.all,
+			sel.recent && (t.DownRate > 0 || t.UpRate > 0),
+			sel.ids[id],
+			sel.hashes[t.Hash]:
+			selected = append(selected, t)
+		}
+	}
+	return selected, nil
+}
+
+func (h *Handler) torrentGet(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		IDs    json.RawMessage `json:"ids"`
+		Fields []string        `json:"fields"`
+	}
+	if err := unmarshalArgs(raw, &args); err != nil {
+		return nil, err
+	}
+
+	torrents, err := h.selectTorrents(args.IDs)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]map[string]interface{}, 0, len(torrents))
+	for _, t := range torrents {
+		id := h.id(t.Hash)
+		m := make(map[string]interface{}, len(args.Fields))
+		for _, name := range args.Fields {
+			if v, ok := torrentField(t, id, name); ok {
+				m[name] = v
+			}
+		}
+		list = append(list, m)
+	}
+
+	return map[string]interface{}{"torrents": list}, nil
+}
+
+// torrentField returns the value of the Transmission field name for t, it reports false
+// for fields that aren't supported.
+func torrentField(t *rtapi.Torrent, id int, name string) (interface{}, bool) {
+	switch name {
+	case "id":
+		return id, true
+	case "hashString":
+		return strings.ToLower(t.Hash), true
+	case "name":
+		return t.Name, true
+	case "status":
+		return status(t), true
+	case "error":
+		if t.State == rtapi.Error || t.State == rtapi.StoppedError {
+			return errorTracker, true
+		}
+		return errorNone, true
+	case "errorString":
+		if t.State == rtapi.Error || t.State == rtapi.StoppedError {
+			return t.Message, true
+		}
+		return "", true
+	case "totalSize", "sizeWhenDone":
+		return t.Size, true
+	case "leftUntilDone":
+		if t.Completed >= t.Size {
+			return 0, true
+		}
+		return t.Size - t.Completed, true
+	case "haveValid":
+		return t.Completed, true
+	case "downloadedEver":
+		return t.DownTotal, true
+	case "percentDone":
+		if t.Size == 0 {
+			return 0, true
+		}
+		return float64(t.Completed) / float64(t.Size), true
+	case "rateDownload":
+		return t.DownRate, true
+	case "rateUpload":
+		return t.UpRate, true
+	case "uploadRatio":
+		return t.Ratio, true
+	case "uploadedEver":
+		return t.UpTotal, true
+	case "eta":
+		if t.State == rtapi.Leeching && t.ETA > 0 {
+			return int64(t.ETA), true
+		}
+		return -1, true
+	case "downloadDir":
+		if t.Path == "" {
+			return "", true
+		}
+		return filepath.Dir(t.Path), true
+	case "addedDate":
+		return t.Age, true
+	case "doneDate":
+		return unixOrZero(t.FinishedAt), true
+	case "dateCreated":
+		return unixOrZero(t.CreatedAt), true
+	case "secondsSeeding":
+		return int64(t.SeedingTime / time.Second), true
+	case "isFinished":
+		return t.State == rtapi.Complete, true
+	case "isStalled":
+		return (t.State == rtapi.Leeching || t.State == rtapi.Seeding || t.State == rtapi.PartialSeed) && t.DownRate == 0 && t.UpRate == 0, true
+	case "labels":
+		if t.Label == "" {
+			return []string{}, true
+		}
+		return []string{t.Label}, true
+	case "trackers":
+		trackers := []map[string]interface{}{}
+		if t.Tracker != nil && t.Tracker.String() != "" {
+			trackers = append(trackers, map[string]interface{}{
+				"announce": t.Tracker.String(),
+				"id":       0,
+				"tier":     0,
+			})
+		}
+		return trackers, true
+	case "queuePosition":
+		return 0, true
+	}
+	return nil, false
+}
+
+// unixOrZero returns t as a unix timestamp, Transmission's 0 for unknown
+// dates.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// status maps the torrent state to Transmission's tr_torrent_activity.
+func status(t *rtapi.Torrent) int {
+	switch t.State {
+	case rtapi.Leeching:
+		return statusDownload
+	case rtapi.Seeding, rtapi.PartialSeed:
+		return statusSeed
+	case rtapi.Hashing:
+		return statusCheck
+	case rtapi.HashQueued:
+		return statusCheckWait
+	case rtapi.Queued:
+		if t.Size > 0 && t.Completed >= t.Size {
+			return statusSeedWait
+		}
+		return statusDownloadWait
+	case rtapi.Error: // still active
+		if t.Size > 0 && t.Completed >= t.Size {
+			return statusSeed
+		}
+		return statusDownload
+	}
+	return statusStopped
+}
+
+func (h *Handler) torrentAdd(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Filename    string   `json:"filename"`
+		Metainfo    string   `json:"metainfo"`
+		DownloadDir string   `json:"download-dir"`
+		Labels      []string `json:"labels"`
+	}
+	if err := unmarshalArgs(raw, &args); err != nil {
+		return nil, err
+	}
+
+	var metainfo []byte
+	if args.Metainfo != "" {
+		data, err := base64.StdEncoding.DecodeString(args.Metainfo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metainfo: %w", err)
+		}
+		metainfo = data
+	} else if args.Filename == "" {
+		return nil, errors.New("no filename or metainfo specified")
+	}
+
+	var label string
+	if len(args.Labels) > 0 {
+		label = args.Labels[0]
+	}
+
+	var err error
+	switch {
+	case args.DownloadDir != "" || label != "":
+		err = h.rt.DownloadWithOptions(&rtapi.DotTorrentWithOptions{
+			Link:  args.Filename,
+			Data:  metainfo,
+			Dir:   args.DownloadDir,
+			Label: label,
+		})
+	case metainfo != nil:
+		err = h.rt.DownloadRaw(metainfo)
+	default:
+		err = h.rt.Download(args.Filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// rTorrent fetches URLs in the background, the hash is only known
+	// upfront for magnet links.
+	added := map[string]interface{}{}
+	if hash, name, ok := parseMagnet(args.Filename); ok {
+		added["hashString"] = strings.ToLower(hash)
+		added["id"] = h.id(hash)
+		added["name"] = name
+	}
+	return map[string]interface{}{"torrent-added": added}, nil
+}
+
+// parseMagnet returns the upper-case hex info hash and display name of a
+// magnet link.
+func parseMagnet(link string) (hash, name string, ok bool) {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "magnet" {
+		return "", "", false
+	}
+
+	q := u.Query()
+	for _, xt := range q["xt"] {
+		btih, found := strings.CutPrefix(xt, "urn:btih:")
+		if !found {
+			continue
+		}
+
+		switch len(btih) {
+		case 40:
+			if _, err := hex.DecodeString(btih); err == nil {
+				return strings.ToUpper(btih), q.Get("dn"), true
+			}
+		case 32:
+			b, err := base32.StdEncoding.DecodeString(strings.ToUpper(btih))
+			if err == nil {
+				return strings.ToUpper(hex.EncodeToString(b)), q.Get("dn"), true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func (h *Handler) torrentAction(raw json.RawMessage, action func(...*rtapi.Torrent) error) error {
+	var args struct {
+		IDs json.RawMessage `json:"ids"`
+	}
+	if err := unmarshalArgs(raw, &args); err != nil {
+		return err
+	}
+
+	torrents, err := h.selectTorrents(args.IDs)
+	if err != nil || len(torrents) == 0 {
+		return err
+	}
+	return action(torrents...)
+}
+
+func (h *Handler) torrentRemove(raw json.RawMessage) error {
+	var args struct {
+		IDs             json.RawMessage `json:"ids"`
+		DeleteLocalData bool            `json:"delete-local-data"`
+	}
+	if err := unmarshalArgs(raw, &args); err != nil {
+		return err
+	}
+
+	torrents, err := h.selectTorrents(args.IDs)
+	if err != nil || len(torrents) == 0 {
+		return err
+	}
+	return h.rt.Delete(args.DeleteLocalData, torrents...)
+}
+
+func (h *Handler) sessionGet() (interface{}, error) {
+	st, err := h.rt.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"version":                  "2.94 (rtorrent " + h.rt.Version + ")",
+		"rpc-version":              15,
+		"rpc-version-minimum":      1,
+		"session-id":               h.sessionID,
+		"download-dir":             st.Directory,
+		"peer-port":                st.Port,
+		"speed-limit-down":         st.ThrottleDown / 1024,
+		"speed-limit-down-enabled": st.ThrottleDown > 0,
+		"speed-limit-up":           st.ThrottleUp / 1024,
+		"speed-limit-up-enabled":   st.ThrottleUp > 0,
+		"units": map[string]interface{}{
+			"speed-units":  []string{"kB/s", "MB/s", "GB/s", "TB/s"},
+			"speed-bytes":  1024,
+			"size-units":   []string{"KiB", "MiB", "GiB", "TiB"},
+			"size-bytes":   1024,
+			"memory-units": []string{"KiB", "MiB", "GiB", "TiB"},
+			"memory-bytes": 1024,
+		},
+	}, nil
+}
+
+func (h *Handler) sessionStats() (interface{}, error) {
+	torrents, err := h.rt.Torrents()
+	if err != nil {
+		return nil, err
+	}
+	tr, err := h.rt.Transfer(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	st, err := h.rt.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	var active int
+	for _, t := range torrents {
+		if status(t) != statusStopped {
+			active++
+		}
+	}
+
+	totals := map[string]interface{}{
+		"uploadedBytes":   tr.UpTotal,
+		"downloadedBytes": tr.DownTotal,
+		"filesAdded":      0,
+		"sessionCount":    1,
+		"secondsActive":   int64(st.Uptime / time.Second),
+	}
+
+	return map[string]interface{}{
+		"activeTorrentCount": active,
+		"pausedTorrentCount": len(torrents) - active,
+		"torrentCount":       len(torrents),
+		"downloadSpeed":      tr.DownRate,
+		"uploadSpeed":        tr.UpRate,
+		"cumulative-stats":   totals,
+		"current-stats":      totals,
+	}, nil
+}
+
+func unmarshalArgs(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Package transmission serves rTorrent over Transmission's JSON RPC
+// protocol, so tools which only speak Transmission can drive rTorrent.
+//
+//	rt, err := rtapi.NewRtorrent("localhost:5000")
+//	if err != nil {
+//		// ...
+//	}
+//
+//	http.Handle("/transmission/rpc", transmission.New(rt, transmission.WithAuth("user", "pass")))
+//	log.Fatal(http.ListenAndServe(":9091", nil))
+//
+// Supported methods are torrent-get, torrent-add, torrent-start,
+// torrent-start-now, torrent-stop, torrent-verify, torrent-remove,
+// session-get and session-stats. Torrents are given ids in the order they
+// are first seen, ids are stable for the life of the Handler.
+package transmission
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/pyed/rtapi"
+)
+
+// SessionIDHeader carries the CSRF token clients must echo back.
+const SessionIDHeader = "X-Transmission-Session-Id"
+
+// Handler is an http.Handler serving the Transmission RPC protocol.
+type Handler struct {
+	rt                 *rtapi.Rtorrent
+	username, password string
+	sessionID          string
+
+	mu     sync.Mutex
+	ids    map[string]int // by hash
+	hashes []string       // by id-1
+}
+
+// Option configures a *Handler created by New.
+type Option func(*Handler)
+
+// WithAuth requires HTTP basic authentication, like Transmission's
+// rpc-authentication-required.
+func WithAuth(username, password string) Option {
+	return func(h *Handler) {
+		h.username, h.password = username, password
+	}
+}
+
+// New returns a *Handler serving rt.
+func New(rt *rtapi.Rtorrent, opts ...Option) *Handler {
+	h := &Handler{
+		rt:        rt,
+		sessionID: newSessionID(),
+		ids:       make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func newSessionID() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// request is a Transmission RPC request.
+type request struct {
+	Method    string          `json:"method"`
+	Arguments json.RawMessage `json:"arguments"`
+	Tag       *int64          `json:"tag,omitempty"`
+}
+
+// response is a Transmission RPC response, Result is "success" or an error
+// message.
+type response struct {
+	Result    string      `json:"result"`
+	Arguments interface{} `json:"arguments"`
+	Tag       *int64      `json:"tag,omitempty"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.username != "" || h.password != "" {
+		user, pass, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(user), []byte(h.username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(h.password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Transmission"`)
+			http.Error(w, "401: Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	// the CSRF handshake: clients retry with the id from the 409 response.
+	if r.Header.Get(SessionIDHeader) != h.sessionID {
+		w.Header().Set(SessionIDHeader, h.sessionID)
+		http.Error(w, "409: Conflict, invalid or missing "+SessionIDHeader, http.StatusConflict)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "405: Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "400: Bad Request, "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := response{Result: "success", Arguments: struct{}{}, Tag: req.Tag}
+	args, err := h.call(req.Method, req.Arguments)
+	if err != nil {
+		resp.Result = err.Error()
+	} else if args != nil {
+		resp.Arguments = args
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Handler) call(method string, args json.RawMessage) (interface{}, error) {
+	switch method {
+	case "torrent-get":
+		return h.torrentGet(args)
+	case "torrent-add":
+		return h.torrentAdd(args)
+	case "torrent-start":
+		return nil, h.torrentAction(args, h.rt.Start)
+	case "torrent-start-now":
+		return nil, h.torrentAction(args, h.rt.ForceStart)
+	case "torrent-stop":
+		return nil, h.torrentAction(args, h.rt.Stop)
+	case "torrent-verify":
+		return nil, h.torrentAction(args, h.rt.Check)
+	case "torrent-remove":
+		return nil, h.torrentRemove(args)
+	case "session-get":
+		return h.sessionGet()
+	case "session-stats":
+		return h.sessionStats()
+	}
+	return nil, fmt.Errorf("method name not recognized: %s", method)
+}
+
+// id returns the id of the torrent with the given hash, assigning one if needed.
+func (h *Handler) id(hash string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if id, ok := h.ids[hash]; ok {
+		return id
+	}
+	h.hashes = append(h.hashes, hash)
+	h.ids[hash] = len(h.hashes)
+	return len(h.hashes)
+}
+
+// hash returns the hash of the torrent with the given id, or "".
+func (h *Handler) hash(id int) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if id < 1 || id > len(h.hashes) {
+		return ""
+	}
+	return h.hashes[id-1]
+}
@@ -0,0 +1,290 @@
+package transmission
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pyed/rtapi"
+	"github.com/pyed/rtapi/rtapitest"
+)
+
+func newTestHandler(t *testing.T, opts ...Option) (*Handler, *rtapitest.Server) {
+	t.Helper()
+
+	fake := rtapitest.NewServer()
+	t.Cleanup(fake.Close)
+	fake.SetSession(rtapitest.Session{
+		ClientVersion:  "0.9.6",
+		LibraryVersion: "0.13.6",
+		Port:           6980,
+		Directory:      "/home/Downloads",
+		UpTotal:        6841,
+		DownTotal:      7476,
+	})
+	fake.AddTorrent(
+		&rtapitest.Torrent{
+			Hash:      "8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648",
+			Name:      "ubuntu-17.04-server-amd64.iso",
+			Directory: "/home/Downloads",
+			Size:      1370 * 524288,
+			Completed: 1370 * 524288,
+			ChunkSize: 524288,
+			LoadDate:  1492032019,
+			Open:      true,
+			Active:    true,
+			Started:   true,
+			Trackers:  []rtapitest.Tracker{{URL: "http://torrent.ubuntu.com:6969/announce"}},
+		},
+		&rtapitest.Torrent{
+			Hash:      "02CA77A6A047FD37F04337437D18F82E61861084",
+			Name:      "archlinux-2017.04.01-x86_64.iso",
+			Directory: "/home/Downloads",
+			Size:      956 * 524288,
+			Completed: 115 * 524288,
+			ChunkSize: 524288,
+			DownRate:  997035,
+			LoadDate:  1492031149,
+			Open:      true,
+			Active:    true,
+			Started:   true,
+			Custom1:   "Linux",
+			Trackers:  []rtapitest.Tracker{{URL: "udp://tracker.archlinux.org:6969"}},
+		},
+	)
+
+	rt, err := rtapi.NewRtorrent(fake.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(rt, opts...), fake
+}
+
+// rpc calls method on h, completing the session id handshake first.
+func rpc(t *testing.T, h *Handler, method string, args interface{}) (result string, arguments map[string]json.RawMessage) {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]interface{}{"method": method, "arguments": args, "tag": 7})
+	rec := post(h, body, "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Expected the handshake status 409, got: %d", rec.Code)
+	}
+
+	rec = post(h, body, rec.Header().Get(SessionIDHeader))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got: %d %s", rec.Code, rec.Body)
+	}
+
+	var resp struct {
+		Result    string                     `json:"result"`
+		Arguments map[string]json.RawMessage `json:"arguments"`
+		Tag       int                        `json:"tag"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Tag != 7 {
+		t.Errorf("Expected the tag to be echoed, got: %d", resp.Tag)
+	}
+	return resp.Result, resp.Arguments
+}
+
+func post(h http.Handler, body []byte, sessionID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/transmission/rpc", bytes.NewReader(body))
+	if sessionID != "" {
+		req.Header.Set(SessionIDHeader, sessionID)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuth(t *testing.T) {
+	h := New(&rtapi.Rtorrent{}, WithAuth("user", "pass"))
+
+	req := httptest.NewRequest("POST", "/transmission/rpc", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got: %d", rec.Code)
+	}
+
+	req.SetBasicAuth("user", "pass")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict || rec.Header().Get(SessionIDHeader) == "" {
+		t.Errorf("Expected the session id handshake, got: %d", rec.Code)
+	}
+}
+
+func TestTorrentGet(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	result, args := rpc(t, h, "torrent-get", map[string]interface{}{
+		"fields": []string{"id", "hashString", "name", "status", "percentDone", "eta", "downloadDir", "labels", "unknownField"},
+	})
+	if result != "success" {
+		t.Fatalf("Expected success, got: %s", result)
+	}
+
+	var torrents []map[string]interface{}
+	json.Unmarshal(args["torrents"], &torrents)
+	if len(torrents) != 2 {
+		t.Fatalf("Expected 2 torrents, got: %d", len(torrents))
+	}
+
+	arch := torrents[1]
+	expected := map[string]interface{}{
+		"id":          2.0,
+		"hashString":  "02ca77a6a047fd37f04337437d18f82e61861084",
+		"name":        "archlinux-2017.04.01-x86_64.iso",
+		"status":      4.0,
+		"percentDone": 115.0 / 956.0,
+		"eta":         442.0,
+		"downloadDir": "/home/Downloads",
+		"labels":      []interface{}{"Linux"},
+	}
+	if len(arch) != len(expected) {
+		t.Errorf("Expected only the supported requested fields, got: %v", arch)
+	}
+	for k, v := range expected {
+		if got, _ := json.Marshal(arch[k]); string(got) != string(mustMarshal(v)) {
+			t.Errorf("Expected %s to be %v, got: %v", k, v, arch[k])
+		}
+	}
+
+	// select by id and by hash.
+	_, args = rpc(t, h, "torrent-get", map[string]interface{}{
+		"ids":    []interface{}{1, "02ca77a6a047fd37f04337437d18f82e61861084"},
+		"fields": []string{"id"},
+	})
+	json.Unmarshal(args["torrents"], &torrents)
+	if len(torrents) != 2 {
+		t.Errorf("Expected 2 torrents, got: %v", torrents)
+	}
+
+	_, args = rpc(t, h, "torrent-get", map[string]interface{}{"ids": "recently-active", "fields": []string{"id"}})
+	json.Unmarshal(args["torrents"], &torrents)
+	if len(torrents) != 1 || torrents[0]["id"] != 2.0 {
+		t.Errorf("Expected only the downloading torrent, got: %v", torrents)
+	}
+}
+
+func mustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestTorrentAdd(t *testing.T) {
+	h, fake := newTestHandler(t)
+
+	magnet := "magnet:?xt=urn:btih:02ca77a6a047fd37f04337437d18f82e61861084&dn=archlinux"
+	result, args := rpc(t, h, "torrent-add", map[string]interface{}{"filename": magnet, "labels": []string{"Linux"}})
+	if result != "success" {
+		t.Fatalf("Expected success, got: %s", result)
+	}
+	if got := fake.Torrent("02CA77A6A047FD37F04337437D18F82E61861084"); got == nil || got.Name != "archlinux" || got.Custom1 != "Linux" {
+		t.Errorf("Expected the magnet link to be loaded with its label, got: %+v", got)
+	}
+
+	var added map[string]interface{}
+	json.Unmarshal(args["torrent-added"], &added)
+	if added["hashString"] != "02ca77a6a047fd37f04337437d18f82e61861084" || added["name"] != "archlinux" {
+		t.Errorf("Unexpected torrent-added: %v", added)
+	}
+
+	if result, _ := rpc(t, h, "torrent-add", map[string]interface{}{}); result == "success" {
+		t.Error("Expected an error without a filename")
+	}
+}
+
+func TestTorrentAddMetainfo(t *testing.T) {
+	h, fake := newTestHandler(t)
+
+	metainfo := base64.StdEncoding.EncodeToString([]byte("d4:infod6:lengthi1e4:name10:debian.iso12:piece lengthi1e6:pieces0:ee"))
+	result, _ := rpc(t, h, "torrent-add", map[string]interface{}{"metainfo": metainfo, "download-dir": "/data"})
+	if result != "success" {
+		t.Fatalf("Expected success, got: %s", result)
+	}
+	ts := fake.Torrents()
+	if len(ts) != 3 || ts[2].Name != "debian.iso" || ts[2].Directory != "/data" {
+		t.Errorf("Expected the metainfo to be loaded into /data, got: %+v", ts[len(ts)-1])
+	}
+
+	if result, _ := rpc(t, h, "torrent-add", map[string]interface{}{"metainfo": "not base64!"}); result == "success" {
+		t.Error("Expected an error for invalid metainfo")
+	}
+}
+
+func TestTorrentActions(t *testing.T) {
+	h, fake := newTestHandler(t)
+
+	testCases := []struct{ method, called string }{
+		{"torrent-start", "d.start"},
+		{"torrent-stop", "d.stop"},
+		{"torrent-start-now", "d.open"},
+		{"torrent-verify", "d.check_hash"},
+		{"torrent-remove", "d.erase"},
+	}
+	for _, test := range testCases {
+		if result, _ := rpc(t, h, test.method, map[string]interface{}{"ids": []string{"8856b93099408ae0ebb8cd7bc7bdb9a7f80ad648"}}); result != "success" {
+			t.Errorf("%s: Expected success, got: %s", test.method, result)
+		}
+		if n := fake.CallCount(test.called); n != 1 {
+			t.Errorf("%s: Expected %s to be called once, got: %d", test.method, test.called, n)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	h, fake := newTestHandler(t)
+	session := fake.Session()
+	session.StartupTime = time.Now().Add(-time.Hour).Unix()
+	fake.SetSession(session)
+
+	_, args := rpc(t, h, "session-get", nil)
+	if string(args["download-dir"]) != `"/home/Downloads"` || string(args["peer-port"]) != "6980" {
+		t.Errorf("Unexpected session-get: %v", args)
+	}
+
+	_, args = rpc(t, h, "session-stats", nil)
+	if string(args["torrentCount"]) != "2" || string(args["activeTorrentCount"]) != "2" || string(args["downloadSpeed"]) != "997035" {
+		t.Errorf("Unexpected session-stats: %v", args)
+	}
+	var current struct {
+		SecondsActive int64 `json:"secondsActive"`
+	}
+	if err := json.Unmarshal(args["current-stats"], &current); err != nil || current.SecondsActive < 3600 {
+		t.Errorf("Expected an hour active, got: %s", args["current-stats"])
+	}
+
+	if result, _ := rpc(t, h, "blocklist-update", nil); result == "success" {
+		t.Error("Expected an error for an unsupported method")
+	}
+}
+
+func TestParseMagnet(t *testing.T) {
+	testCases := []struct {
+		link, hash string
+		ok         bool
+	}{
+		{"magnet:?xt=urn:btih:02ca77a6a047fd37f04337437d18f82e61861084", "02CA77A6A047FD37F04337437D18F82E61861084", true},
+		{"magnet:?xt=urn:btih:alfhpjvai76tp4cdg5bx2ghyfzqymeee", "02CA77A6A047FD37F04337437D18F82E61861084", true},
+		{"magnet:?dn=nothing", "", false},
+		{"http://example.com/a.torrent", "", false},
+	}
+
+	for i, test := range testCases {
+		hash, _, ok := parseMagnet(test.link)
+		if hash != test.hash || ok != test.ok {
+			t.Errorf("Case %d: Expected %q, %t, got: %q, %t", i, test.hash, test.ok, hash, ok)
+		}
+	}
+}
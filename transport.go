@@ -0,0 +1,243 @@
+package rtapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Transport carries an XML-RPC or JSON-RPC request to rTorrent and returns its raw
+// answer, which may start with SCGI or HTTP headers.
+type Transport interface {
+	RoundTrip(ctx context.Context, body []byte) (io.ReadCloser, error)
+}
+
+// SCGITransport sends every request over a new SCGI connection, since
+// rTorrent closes it once it answered.
+type SCGITransport struct {
+	Network string // "tcp" or "unix"
+	Address string
+
+	// MaxConns caps how many connections are open at once, requests over
+	// the cap wait for one to be closed. rTorrent answers one request at a
+	// time, so a burst of calls only piles up in its listen queue. Zero
+	// means no limit.
+	MaxConns int
+
+	limiter limiter
+}
+
+// RoundTrip dials rTorrent and writes the SCGI request, the connection is
+// the returned body.
+func (t *SCGITransport) RoundTrip(ctx context.Context, body []byte) (io.ReadCloser, error) {
+	release, err := t.limiter.acquire(ctx, t.MaxConns)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, t.Network, t.Address)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	if _, err := conn.Write(encode(string(body))); err != nil {
+		conn.Close()
+		release()
+		return nil, err
+	}
+
+	return &releasingBody{ReadCloser: conn, release: release}, nil
+}
+
+// limiter caps the requests in flight.
+type limiter struct {
+	once sync.Once
+	sem  chan struct{}
+}
+
+type nestedKey struct{}
+
+// nested marks ctx as coming from a caller which holds a response open,
+// like TorrentsIter fetching trackers while it decodes the torrents. Nested
+// requests skip the limiter, they would wait on their caller otherwise.
+func nested(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nestedKey{}, true)
+}
+
+// acquire takes a slot, waiting for one if max are in use. Zero max means
+// no limit.
+func (l *limiter) acquire(ctx context.Context, max int) (release func(), err error) {
+	if max <= 0 || ctx.Value(nestedKey{}) != nil {
+		return func() {}, nil
+	}
+
+	l.once.Do(func() {
+		l.sem = make(chan struct{}, max)
+	})
+	select {
+	case l.sem <- struct{}{}:
+		var once sync.Once
+		return func() { once.Do(func() { <-l.sem }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// releasingBody gives its slot back when closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// HTTPTransport POSTs requests to an XML-RPC endpoint served over HTTP, like
+// the /RPC2 mount of a web server in front of rTorrent. Connections are
+// kept alive and reused between requests.
+type HTTPTransport struct {
+	// URL of the endpoint, credentials in it are sent with basic auth.
+	URL string
+
+	// MaxConns caps the requests in flight, and is how many idle
+	// connections are kept for reuse. Zero keeps two idle connections and
+	// sets no cap.
+	MaxConns int
+
+	// Client is used instead of one built from MaxConns when set.
+	Client *http.Client
+
+	once    sync.Once
+	client  *http.Client
+	limiter limiter
+}
+
+// RoundTrip sends the request, the body of the HTTP response is returned.
+func (t *HTTPTransport) RoundTrip(ctx context.Context, body []byte) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType(body))
+
+	release, err := t.limiter.acquire(ctx, t.MaxConns)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.httpClient().Do(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		drain(resp.Body)
+		release()
+		return nil, &httpStatusError{url: req.URL.Redacted(), status: resp.Status, code: resp.StatusCode}
+	}
+
+	return &releasingBody{ReadCloser: &drainingBody{resp.Body}, release: release}, nil
+}
+
+// contentType tells rTorrent forks which accept JSON-RPC how to read body.
+func contentType(body []byte) string {
+	if len(body) > 0 && body[0] == '{' {
+		return "application/json"
+	}
+	return "text/xml"
+}
+
+// httpStatusError is returned for answers other than 200 OK, a proxy in
+// front of rTorrent answers 502 while it's down.
+type httpStatusError struct {
+	url, status string
+	code        int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("rtapi: %s %s", e.url, e.status)
+}
+
+func (t *HTTPTransport) httpClient() *http.Client {
+	if t.Client != nil {
+		return t.Client
+	}
+
+	t.once.Do(func() {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		if t.MaxConns > 0 {
+			tr.MaxIdleConnsPerHost = t.MaxConns
+		}
+		t.client = &http.Client{Transport: tr}
+	})
+	return t.client
+}
+
+// maxDrain is how much of an unread body is discarded to keep the
+// connection, bigger leftovers are cheaper to drop with it.
+const maxDrain = 64 << 10
+
+func drain(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, maxDrain))
+	body.Close()
+}
+
+// drainingBody reads what's left of the body on Close, net/http only reuses
+// connections whose body was read to the end.
+type drainingBody struct {
+	io.ReadCloser
+}
+
+func (b *drainingBody) Close() error {
+	io.Copy(io.Discard, io.LimitReader(b.ReadCloser, maxDrain))
+	return b.ReadCloser.Close()
+}
+
+// WithTransport makes the client use t instead of dialing the address over
+// SCGI, e.g. to record the traffic or to talk to an HTTP proxy.
+func WithTransport(t Transport) Option {
+	return func(r *Rtorrent) {
+		r.transport = t
+	}
+}
+
+// WithMaxConns caps the connections the default transport opens at once,
+// see SCGITransport.MaxConns and HTTPTransport.MaxConns. It has no effect
+// along WithTransport.
+func WithMaxConns(n int) Option {
+	return func(r *Rtorrent) {
+		r.maxConns = n
+	}
+}
+
+// defaultTransport picks HTTP for http(s) URLs and SCGI otherwise.
+func (r *Rtorrent) defaultTransport() Transport {
+	if strings.HasPrefix(r.address, "http://") || strings.HasPrefix(r.address, "https://") {
+		return &HTTPTransport{URL: r.address, MaxConns: r.maxConns}
+	}
+	return &SCGITransport{Network: r.network, Address: r.address, MaxConns: r.maxConns}
+}
+
+// roundTrip encodes req and sends it with the configured transport.
+func (r *Rtorrent) roundTrip(ctx context.Context, req xmlrpcMethodCall) (io.ReadCloser, error) {
+	body, err := r.encodeCall(r.rename(req))
+	if err != nil {
+		return nil, err
+	}
+
+	t := r.transport
+	if t == nil {
+		t = r.defaultTransport()
+	}
+	return t.RoundTrip(ctx, body)
+}
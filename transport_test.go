@@ -0,0 +1,129 @@
+package rtapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pyed/rtapi/rtapitest"
+)
+
+func TestHTTPTransport(t *testing.T) {
+	fake := rtapitest.NewServer()
+	defer fake.Close()
+	fake.AddTorrent(&rtapitest.Torrent{
+		Hash:     "8856B93099408AE0EBB8CD7BC7BDB9A7F80AD648",
+		Name:     "ubuntu.iso",
+		Size:     1 << 20,
+		Trackers: []rtapitest.Tracker{{URL: "http://torrent.ubuntu.com:6969/announce"}},
+	})
+
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(fake)
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	rt, err := NewRtorrent(srv.URL+"/RPC2", WithMaxConns(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.Version != "0.9.8/0.13.8" {
+		t.Errorf("Expected version 0.9.8/0.13.8, got: %s", rt.Version)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := rt.Call("system.client_version"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("Expected the connection to be reused, got %d connections", n)
+	}
+
+	// the trackers are fetched while the torrents are being read.
+	torrents, err := rt.Torrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 1 || torrents[0].Name != "ubuntu.iso" {
+		t.Errorf("Unexpected torrents: %v", torrents)
+	}
+
+	srv.Close()
+	if _, err := rt.Call("system.client_version"); err == nil {
+		t.Error("Expected an error once the server is gone")
+	}
+}
+
+func TestHTTPTransportStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	tr := &HTTPTransport{URL: srv.URL}
+	if _, err := tr.RoundTrip(context.Background(), []byte("<methodCall/>")); err == nil || err.Error() != "rtapi: "+srv.URL+" 403 Forbidden" {
+		t.Errorf("Expected a 403 error, got: %v", err)
+	}
+}
+
+func TestSCGITransportMaxConns(t *testing.T) {
+	fake := rtapitest.NewServer()
+	defer fake.Close()
+	fake.SetLatency(20 * time.Millisecond)
+
+	rt, err := NewRtorrent(fake.Addr, WithMaxConns(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rt.Call("system.client_version"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := fake.MaxConcurrency(); n != 2 {
+		t.Errorf("Expected at most 2 requests at once, got: %d", n)
+	}
+
+	// a waiting request gives up with its context.
+	tr := &SCGITransport{Network: fake.Network, Address: fake.Addr, MaxConns: 1}
+	body, err := tr.RoundTrip(context.Background(), []byte("<methodCall/>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := tr.RoundTrip(ctx, []byte("<methodCall/>")); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got: %v", err)
+	}
+
+	body.Close()
+	body.Close() // the slot is only given back once.
+	body, err = tr.RoundTrip(context.Background(), []byte("<methodCall/>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+
+	if _, err := NewRtorrent(fake.Addr, WithMaxConns(1)); err != nil {
+		t.Errorf("Expected a single connection to be enough, got: %v", err)
+	}
+}